@@ -1,10 +1,7 @@
-hosts = getFieldChoice("host", "host")
-for i, host in ipairs(hosts) do
-    setToken("host", host, "host")
-    events = { }
-    l = getLine(0)
-    l = replaceTokens(l)
-    table.insert(events, l)
+local nix = require("nix")
+
+nix.eachHost(function(events)
+    nix.addLine(events, 0)
 
     kbps = math.random(options["minKBPS"], options["maxKBPS"])
     packets = kbps / 65.535
@@ -16,13 +13,7 @@ for i, host in ipairs(hosts) do
         rx_kb = round(receivedPct * kbps, 2)
         tx_kb = round(kbps - rx_kb, 2)
 
-        tokens = { "nic", "rx_p", "tx_p", "rx_kb", "tx_kb" }
-        for i, t in ipairs(tokens) do
-            setToken(t, _G[t])
-        end
-        l = getLine(1)
-        l = replaceTokens(l)
-        table.insert(events, l)
+        nix.setTokens({ "nic", "rx_p", "tx_p", "rx_kb", "tx_kb" })
+        nix.addLine(events, 1)
     end
-    send(events)
-end
\ No newline at end of file
+end)
@@ -1,31 +1,23 @@
-hosts = getFieldChoice("host", "host")
+local nix = require("nix")
+
 mounts = getFieldChoice("disks", "mount")
 disks = getFieldChoice("disks", "disk")
-for i, host in ipairs(hosts) do
-    setToken("host", host, "host")
-    events = { }
-    l = getLine(0)
-    l = replaceTokens(l)
-    table.insert(events, l)
+nix.eachHost(function(events)
+    nix.addLine(events, 0)
 
     for i=1,#disks do
         usedPct = round(math.random() + math.random(options["minDiskUsedPct"], options["maxDiskUsedPct"]),2)
         usedGB = round((usedPct/100) * options["totalGBperDisk"])
         availGB = round(options["totalGBperDisk"] - usedGB)
-        setToken("usedPct", usedPct)
-        setToken("usedGB", usedGB)
-        setToken("availGB", availGB)
-        setToken("totalGB", options["totalGBperDisk"])
+        totalGB = options["totalGBperDisk"]
         if availGB < 1 then
-            setToken("fs", "/dev/sdb1")
-            setToken("mnt", "var")
+            fs = "/dev/sdb1"
+            mnt = "var"
         else
-            setToken("fs", disks[i])
-            setToken("mnt", mounts[i])
+            fs = disks[i]
+            mnt = mounts[i]
         end
-        l = getLine(1)
-        l = replaceTokens(l)
-        table.insert(events, l)
+        nix.setTokens({ "usedPct", "usedGB", "availGB", "totalGB", "fs", "mnt" })
+        nix.addLine(events, 1)
     end
-    send(events)
-end
+end)
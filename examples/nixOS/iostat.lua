@@ -1,15 +1,11 @@
-hosts = getFieldChoice("host", "host")
+local nix = require("nix")
+
 disks = getChoice("disks")
 maxOps = tonumber(options["maxOps"])
 avgKB = tonumber(options["avgKB"])
 maxTime = tonumber(options["maxTime"])
-for i, host in ipairs(hosts) do
-    setToken("host", host, "host")
-    
-    events = { }
-    l = getLine(0)
-    l = replaceTokens(l)
-    table.insert(events, l)
+nix.eachHost(function(events)
+    nix.addLine(events, 0)
 
     for i=1,#disks do
         if options["highWrites"] > 0 and optoins["highReads"] > 0 then
@@ -36,13 +32,7 @@ for i, host in ipairs(hosts) do
         avgwait = round(avgsvc + qtime, 2)
         bwutil = round(((rrps + wrps) * avgsvc / 1000) * 100, 2)
 
-        tokens = { "device", "rrps", "wrps", "rkbps", "wkbps", "avgwait", "avgsvc", "bwutil" }
-        for i, t in ipairs(tokens) do
-            setToken(t, _G[t])
-        end
-        l = getLine(1)
-        l = replaceTokens(l)
-        table.insert(events, l)
+        nix.setTokens({ "device", "rrps", "wrps", "rkbps", "wkbps", "avgwait", "avgsvc", "bwutil" })
+        nix.addLine(events, 1)
     end
-    send(events)
-end
\ No newline at end of file
+end)
\ No newline at end of file
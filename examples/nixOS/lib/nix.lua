@@ -0,0 +1,27 @@
+-- Helpers shared by the nixOS generators
+local nix = {}
+
+-- eachHost sets the host token to each host in turn, calls f to add that host's events and sends them
+function nix.eachHost(f)
+    for i, host in ipairs(getFieldChoice("host", "host")) do
+        setToken("host", host, "host")
+        local events = { }
+        f(events, host)
+        send(events)
+    end
+end
+
+-- addLine replaces the tokens in line n of the sample and adds it to events
+function nix.addLine(events, n)
+    local l = replaceTokens(getLine(n))
+    table.insert(events, l)
+end
+
+-- setTokens sets a token to the value of the global of the same name for each name in names
+function nix.setTokens(names)
+    for i, name in ipairs(names) do
+        setToken(name, _G[name])
+    end
+end
+
+return nix
@@ -1,10 +1,7 @@
-hosts = getFieldChoice("host", "host")
-for i, host in ipairs(hosts) do
-    setToken("host", host, "host")
-    events = { }
-    l = getLine(0)
-    l = replaceTokens(l)
-    table.insert(events, l)
+local nix = require("nix")
+
+nix.eachHost(function(events)
+    nix.addLine(events, 0)
 
     memTotalMB = options["totalMB"]
     memUsedPct = round(math.random() + math.random(options["minMemUsedPct"], options["maxMemUsedPct"]),1)
@@ -25,12 +22,6 @@ for i, host in ipairs(hosts) do
     pgPageInPS = math.random(1000, 15000) / 100
     pgPageOutPS = math.random(100000, 2000000) / 100
 
-    tokens = { "memTotalMB", "memUsedPct", "memFreePct", "memFreeMB", "memUsedMB", "pgPageOut", "swapUsedPct", "pgSwapOut", "cSwitches", "interrupts", "forks", "processes", "threads", "loadAvg1mi", "waitThreads", "interruptsPS", "pgPageInPS", "pgPageOutPS"}
-    for i, t in ipairs(tokens) do
-        setToken(t, _G[t])
-    end
-    l = getLine(1)
-    l = replaceTokens(l)
-    table.insert(events, l)
-    send(events)
-end
\ No newline at end of file
+    nix.setTokens({ "memTotalMB", "memUsedPct", "memFreePct", "memFreeMB", "memUsedMB", "pgPageOut", "swapUsedPct", "pgSwapOut", "cSwitches", "interrupts", "forks", "processes", "threads", "loadAvg1mi", "waitThreads", "interruptsPS", "pgPageInPS", "pgPageOutPS" })
+    nix.addLine(events, 1)
+end)
\ No newline at end of file
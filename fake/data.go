@@ -0,0 +1,40 @@
+package fake
+
+// Datasets which don't vary by locale
+
+var domainWords = []string{"acme", "globex", "initech", "umbrella", "stark", "wayne", "hooli", "vandelay", "soylent", "cyberdyne",
+	"northwind", "contoso", "fabrikam", "tailspin", "wingtip", "litware", "adventure", "blue", "red", "green",
+	"summit", "pioneer", "apex", "nova", "zenith", "vertex", "atlas", "orbit", "quantum", "silver"}
+
+var domainSuffixes = []string{"", "", "corp", "tech", "labs", "systems", "group", "soft", "net", "media"}
+
+var pathWords = []string{"api", "v1", "v2", "users", "account", "login", "logout", "search", "products", "cart",
+	"checkout", "orders", "static", "images", "css", "js", "admin", "settings", "profile", "help",
+	"docs", "blog", "news", "about", "contact", "download", "assets", "category", "item", "reviews"}
+
+var pathExtensions = []string{".html", ".php", ".jsp", ".js", ".css", ".png", ".jpg", ".json", ".xml", ".aspx"}
+
+var hostRoles = []string{"web", "app", "db", "mail", "dns", "proxy", "cache", "lb", "auth", "api", "worker", "build", "file", "vpn", "mon"}
+
+var hostEnvironments = []string{"prod", "prod", "prod", "stage", "dev", "qa", "dr"}
+
+var userAgents = []string{
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.0.0 Safari/537.36 Edg/123.0.2420.81",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:125.0) Gecko/20100101 Firefox/125.0",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4.1 Safari/605.1.15",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 14.4; rv:125.0) Gecko/20100101 Firefox/125.0",
+	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0",
+	"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4.1 Mobile/15E148 Safari/604.1",
+	"Mozilla/5.0 (iPad; CPU OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+	"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.6367.82 Mobile Safari/537.36",
+	"Mozilla/5.0 (Linux; Android 13; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.6312.99 Mobile Safari/537.36",
+	"Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/24.0 Chrome/117.0.0.0 Mobile Safari/537.36",
+	"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+	"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)",
+	"curl/8.4.0",
+	"python-requests/2.31.0",
+	"Go-http-client/1.1",
+}
@@ -0,0 +1,255 @@
+// Package fake generates realistic looking values like names, emails, addresses and card numbers
+// for the fake token type.  Datasets are compiled in and chosen by locale, and every value is drawn
+// from the *rand.Rand passed in so output is reproducible with a seed.
+package fake
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLocale is used when no locale is given
+const DefaultLocale = "en_US"
+
+// generators are the kinds of value we can generate
+var generators = map[string]func(l *locale, randgen *rand.Rand) string{
+	"firstName":  firstName,
+	"lastName":   lastName,
+	"name":       name,
+	"username":   username,
+	"email":      email,
+	"domain":     domain,
+	"url":        url,
+	"path":       path,
+	"userAgent":  userAgent,
+	"mac":        mac,
+	"hostname":   hostname,
+	"phone":      phone,
+	"address":    address,
+	"creditCard": creditCard,
+	"iban":       iban,
+}
+
+// Kinds returns the kinds of value we can generate
+func Kinds() []string {
+	ret := make([]string, 0, len(generators))
+	for k := range generators {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Locales returns the locales we have datasets for
+func Locales() []string {
+	ret := make([]string, 0, len(locales))
+	for k := range locales {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Valid returns an error if we can't generate kind for locale
+func Valid(kind string, loc string) error {
+	if _, ok := generators[kind]; !ok {
+		return fmt.Errorf("Unknown fake kind '%s', must be one of %s", kind, strings.Join(Kinds(), ", "))
+	}
+	if loc == "" {
+		loc = DefaultLocale
+	}
+	if _, ok := locales[loc]; !ok {
+		return fmt.Errorf("Unknown locale '%s', must be one of %s", loc, strings.Join(Locales(), ", "))
+	}
+	return nil
+}
+
+// Generate returns a random value of kind for locale, or the default locale if locale is empty
+func Generate(kind string, loc string, randgen *rand.Rand) (string, error) {
+	if err := Valid(kind, loc); err != nil {
+		return "", err
+	}
+	if loc == "" {
+		loc = DefaultLocale
+	}
+	return generators[kind](locales[loc], randgen), nil
+}
+
+func pick(randgen *rand.Rand, choices []string) string {
+	return choices[randgen.Intn(len(choices))]
+}
+
+// fill replaces every # in pattern with a random digit and every ? with a random capital letter
+func fill(randgen *rand.Rand, pattern string) string {
+	b := []byte(pattern)
+	for i := range b {
+		switch b[i] {
+		case '#':
+			b[i] = byte('0' + randgen.Intn(10))
+		case '?':
+			b[i] = byte('A' + randgen.Intn(26))
+		}
+	}
+	return string(b)
+}
+
+// asciiReplacer transliterates the accented letters in our datasets for use in usernames and domains
+var asciiReplacer = strings.NewReplacer(
+	"ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss", "Ä", "Ae", "Ö", "Oe", "Ü", "Ue",
+	"à", "a", "â", "a", "ç", "c", "é", "e", "è", "e", "ê", "e", "ë", "e", "î", "i", "ï", "i", "ô", "o", "ù", "u", "û", "u",
+	"É", "E", "È", "E", "'", "", " ", "",
+)
+
+func ascii(s string) string {
+	return strings.ToLower(asciiReplacer.Replace(s))
+}
+
+func firstName(l *locale, randgen *rand.Rand) string {
+	return pick(randgen, l.firstNames)
+}
+
+func lastName(l *locale, randgen *rand.Rand) string {
+	return pick(randgen, l.lastNames)
+}
+
+func name(l *locale, randgen *rand.Rand) string {
+	return firstName(l, randgen) + " " + lastName(l, randgen)
+}
+
+func username(l *locale, randgen *rand.Rand) string {
+	first := ascii(firstName(l, randgen))
+	last := ascii(lastName(l, randgen))
+	switch randgen.Intn(4) {
+	case 0:
+		return first + "." + last
+	case 1:
+		return first[:1] + last
+	case 2:
+		return first + "_" + last
+	default:
+		return first + last + strconv.Itoa(randgen.Intn(100))
+	}
+}
+
+func email(l *locale, randgen *rand.Rand) string {
+	if randgen.Intn(2) == 0 {
+		return username(l, randgen) + "@" + pick(randgen, l.freeEmailDomains)
+	}
+	return username(l, randgen) + "@" + domain(l, randgen)
+}
+
+func domain(l *locale, randgen *rand.Rand) string {
+	var host string
+	if randgen.Intn(2) == 0 {
+		host = ascii(lastName(l, randgen))
+	} else {
+		host = pick(randgen, domainWords) + pick(randgen, domainSuffixes)
+	}
+	return host + "." + pick(randgen, l.tlds)
+}
+
+func url(l *locale, randgen *rand.Rand) string {
+	prefix := "https://"
+	if randgen.Intn(3) == 0 {
+		prefix += "www."
+	}
+	return prefix + domain(l, randgen) + path(l, randgen)
+}
+
+func path(l *locale, randgen *rand.Rand) string {
+	var b strings.Builder
+	for i := randgen.Intn(3) + 1; i > 0; i-- {
+		b.WriteString("/")
+		b.WriteString(pick(randgen, pathWords))
+	}
+	if randgen.Intn(2) == 0 {
+		b.WriteString(pick(randgen, pathExtensions))
+	}
+	return b.String()
+}
+
+func userAgent(l *locale, randgen *rand.Rand) string {
+	return pick(randgen, userAgents)
+}
+
+func mac(l *locale, randgen *rand.Rand) string {
+	b := make([]byte, 6)
+	randgen.Read(b)
+	// Unicast, so it looks like a real interface
+	b[0] &^= 1
+	return fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x", b[0], b[1], b[2], b[3], b[4], b[5])
+}
+
+func hostname(l *locale, randgen *rand.Rand) string {
+	return fmt.Sprintf("%s-%s-%02d", pick(randgen, hostRoles), pick(randgen, hostEnvironments), randgen.Intn(20)+1)
+}
+
+func phone(l *locale, randgen *rand.Rand) string {
+	return fill(randgen, pick(randgen, l.phoneFormats))
+}
+
+func address(l *locale, randgen *rand.Rand) string {
+	number := strconv.Itoa(randgen.Intn(l.maxHouseNumber) + 1)
+	return fmt.Sprintf(l.addressFormat, number, pick(randgen, l.streets), pick(randgen, l.cities), fill(randgen, l.postcode))
+}
+
+// cardPrefixes are the issuer prefixes and lengths of common card numbers
+var cardPrefixes = []struct {
+	prefix string
+	length int
+}{
+	{"4", 16},
+	{"51", 16},
+	{"52", 16},
+	{"53", 16},
+	{"54", 16},
+	{"55", 16},
+	{"34", 15},
+	{"37", 15},
+	{"6011", 16},
+}
+
+func creditCard(l *locale, randgen *rand.Rand) string {
+	p := cardPrefixes[randgen.Intn(len(cardPrefixes))]
+	number := p.prefix + fill(randgen, strings.Repeat("#", p.length-len(p.prefix)-1))
+	return number + strconv.Itoa(luhn(number))
+}
+
+// luhn returns the check digit which makes number followed by it pass the Luhn check
+func luhn(number string) int {
+	sum := 0
+	double := true
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return (10 - sum%10) % 10
+}
+
+func iban(l *locale, randgen *rand.Rand) string {
+	bban := fill(randgen, l.ibanFormat)
+	return l.ibanCountry + fmt.Sprintf("%02d", ibanCheck(l.ibanCountry, bban)) + bban
+}
+
+// ibanCheck returns the check digits for an IBAN with country and bban, per ISO 13616
+func ibanCheck(country string, bban string) int {
+	mod := 0
+	for _, c := range bban + country + "00" {
+		if c >= 'A' && c <= 'Z' {
+			mod = (mod*100 + int(c-'A') + 10) % 97
+		} else {
+			mod = (mod*10 + int(c-'0')) % 97
+		}
+	}
+	return 98 - mod
+}
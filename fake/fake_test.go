@@ -0,0 +1,101 @@
+package fake
+
+import (
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	randgen := rand.New(rand.NewSource(0))
+	patterns := map[string]string{
+		"email":    `^[a-z0-9._]+@[a-z0-9.-]+\.[a-z.]+$`,
+		"username": `^[a-z0-9._]+$`,
+		"url":      `^https://[a-z0-9.-]+(/[a-z0-9]+)+(\.[a-z]+)?$`,
+		"mac":      `^[0-9a-f]{2}(:[0-9a-f]{2}){5}$`,
+		"hostname": `^[a-z]+-[a-z]+-\d{2}$`,
+		"phone":    `^[0-9()+ -]+$`,
+	}
+	for _, loc := range Locales() {
+		for _, kind := range Kinds() {
+			for i := 0; i < 100; i++ {
+				v, err := Generate(kind, loc, randgen)
+				assert.NoError(t, err)
+				assert.NotEmpty(t, v, "%s %s", loc, kind)
+				if p, ok := patterns[kind]; ok {
+					assert.Regexp(t, p, v, "%s %s", loc, kind)
+				}
+			}
+		}
+	}
+}
+
+func TestGenerateReproducible(t *testing.T) {
+	for _, kind := range Kinds() {
+		a, _ := Generate(kind, "", rand.New(rand.NewSource(1)))
+		b, _ := Generate(kind, "", rand.New(rand.NewSource(1)))
+		assert.Equal(t, a, b, kind)
+	}
+}
+
+func TestValid(t *testing.T) {
+	assert.NoError(t, Valid("email", ""))
+	assert.NoError(t, Valid("iban", "de_DE"))
+	assert.Error(t, Valid("bogus", ""))
+	assert.Error(t, Valid("email", "xx_XX"))
+}
+
+func TestCreditCard(t *testing.T) {
+	randgen := rand.New(rand.NewSource(0))
+	for i := 0; i < 1000; i++ {
+		number := creditCard(locales[DefaultLocale], randgen)
+		// Luhn check over the whole number, including the check digit
+		sum := 0
+		for j := 0; j < len(number); j++ {
+			d := int(number[len(number)-1-j] - '0')
+			if j%2 == 1 {
+				d *= 2
+				if d > 9 {
+					d -= 9
+				}
+			}
+			sum += d
+		}
+		assert.Equal(t, 0, sum%10, number)
+	}
+	assert.Equal(t, 3, luhn("7992739871"))
+}
+
+func TestIBAN(t *testing.T) {
+	assert.Equal(t, 89, ibanCheck("DE", "370400440532013000"))
+	randgen := rand.New(rand.NewSource(0))
+	valid := regexp.MustCompile(`^[A-Z]{2}\d{2}[A-Z0-9]+$`)
+	for _, loc := range Locales() {
+		for i := 0; i < 100; i++ {
+			v := iban(locales[loc], randgen)
+			assert.True(t, valid.MatchString(v), v)
+			assert.Equal(t, 1, ibanMod(v), v)
+		}
+	}
+}
+
+// ibanMod returns the IBAN's remainder mod 97, which is 1 for valid IBANs
+func ibanMod(iban string) int {
+	rearranged := iban[4:] + iban[:4]
+	mod := 0
+	for _, c := range rearranged {
+		s := string(c)
+		if c >= 'A' && c <= 'Z' {
+			s = strconv.Itoa(int(c-'A') + 10)
+		}
+		for _, d := range strings.Split(s, "") {
+			n, _ := strconv.Atoi(d)
+			mod = (mod*10 + n) % 97
+		}
+	}
+	return mod
+}
@@ -0,0 +1,103 @@
+package fake
+
+// locale is the dataset for generating values which vary by country or language
+type locale struct {
+	firstNames       []string
+	lastNames        []string
+	freeEmailDomains []string
+	tlds             []string
+	phoneFormats     []string
+	streets          []string
+	cities           []string
+	// addressFormat is given the house number, street, city and postcode in that order
+	addressFormat  string
+	maxHouseNumber int
+	// postcode and phoneFormats have # for a digit and ? for a letter
+	postcode    string
+	ibanCountry string
+	// ibanFormat is the BBAN, with # for a digit and ? for a letter
+	ibanFormat string
+}
+
+var locales = map[string]*locale{
+	"en_US": {
+		firstNames: []string{"James", "Mary", "Robert", "Patricia", "John", "Jennifer", "Michael", "Linda", "David", "Elizabeth",
+			"William", "Barbara", "Richard", "Susan", "Joseph", "Jessica", "Thomas", "Sarah", "Christopher", "Karen",
+			"Daniel", "Nancy", "Matthew", "Lisa", "Anthony", "Betty", "Mark", "Sandra", "Steven", "Ashley",
+			"Andrew", "Emily", "Joshua", "Michelle", "Kevin", "Amanda", "Brian", "Melissa", "Jose", "Maria"},
+		lastNames: []string{"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis", "Rodriguez", "Martinez",
+			"Hernandez", "Lopez", "Gonzalez", "Wilson", "Anderson", "Thomas", "Taylor", "Moore", "Jackson", "Martin",
+			"Lee", "Perez", "Thompson", "White", "Harris", "Sanchez", "Clark", "Ramirez", "Lewis", "Robinson",
+			"Walker", "Young", "Allen", "King", "Wright", "Scott", "Torres", "Nguyen", "Hill", "Flores"},
+		freeEmailDomains: []string{"gmail.com", "yahoo.com", "outlook.com", "hotmail.com", "aol.com", "icloud.com"},
+		tlds:             []string{"com", "com", "com", "net", "org", "io", "us"},
+		phoneFormats:     []string{"(###) ###-####", "###-###-####", "+1 ###-###-####"},
+		streets: []string{"Main St", "Oak Ave", "Maple Dr", "Cedar Ln", "Pine St", "Elm St", "Washington Blvd", "Lake Rd",
+			"Hillcrest Dr", "Park Ave", "Sunset Blvd", "Highland Ave", "Lincoln Way", "River Rd", "Church St", "Mill Rd"},
+		cities: []string{"Springfield, IL", "Portland, OR", "Austin, TX", "Denver, CO", "Columbus, OH", "Raleigh, NC",
+			"Madison, WI", "Boise, ID", "Tucson, AZ", "Richmond, VA", "Omaha, NE", "Albany, NY"},
+		addressFormat:  "%[1]s %[2]s, %[3]s %[4]s",
+		maxHouseNumber: 9999,
+		postcode:       "#####",
+		// The US doesn't use IBANs, so we generate British ones
+		ibanCountry: "GB",
+		ibanFormat:  "????##############",
+	},
+	"en_GB": {
+		firstNames: []string{"Oliver", "Olivia", "George", "Amelia", "Harry", "Isla", "Noah", "Ava", "Jack", "Emily",
+			"Charlie", "Sophia", "Leo", "Grace", "Jacob", "Mia", "Freddie", "Poppy", "Alfie", "Ella",
+			"Oscar", "Lily", "Arthur", "Evie", "Thomas", "Freya", "William", "Charlotte", "James", "Isabella"},
+		lastNames: []string{"Smith", "Jones", "Williams", "Taylor", "Brown", "Davies", "Evans", "Wilson", "Thomas", "Johnson",
+			"Roberts", "Robinson", "Thompson", "Wright", "Walker", "White", "Edwards", "Hughes", "Green", "Hall",
+			"Lewis", "Harris", "Clarke", "Patel", "Jackson", "Wood", "Turner", "Martin", "Cooper", "Hill"},
+		freeEmailDomains: []string{"gmail.com", "hotmail.co.uk", "yahoo.co.uk", "outlook.com", "btinternet.com", "sky.com"},
+		tlds:             []string{"co.uk", "co.uk", "com", "org.uk", "uk", "net"},
+		phoneFormats:     []string{"07### ######", "020 #### ####", "0161 ### ####", "+44 7### ######"},
+		streets: []string{"High Street", "Station Road", "Church Lane", "Victoria Road", "Green Lane", "Manor Road",
+			"Park Road", "Queens Road", "Kings Road", "Mill Lane", "New Road", "London Road", "The Crescent", "York Road"},
+		cities:         []string{"London", "Manchester", "Birmingham", "Leeds", "Bristol", "Sheffield", "Liverpool", "Edinburgh", "Cardiff", "Norwich", "York", "Brighton"},
+		addressFormat:  "%[1]s %[2]s, %[3]s %[4]s",
+		maxHouseNumber: 300,
+		postcode:       "??# #??",
+		ibanCountry:    "GB",
+		ibanFormat:     "????##############",
+	},
+	"de_DE": {
+		firstNames: []string{"Maximilian", "Sophie", "Alexander", "Marie", "Paul", "Anna", "Lukas", "Emma", "Jonas", "Mia",
+			"Felix", "Hannah", "Leon", "Lena", "Elias", "Lea", "Noah", "Laura", "Ben", "Johanna",
+			"Jürgen", "Ursula", "Klaus", "Sabine", "Stefan", "Katrin", "Thomas", "Monika", "Andreas", "Jörg"},
+		lastNames: []string{"Müller", "Schmidt", "Schneider", "Fischer", "Weber", "Meyer", "Wagner", "Becker", "Schulz", "Hoffmann",
+			"Schäfer", "Koch", "Bauer", "Richter", "Klein", "Wolf", "Schröder", "Neumann", "Schwarz", "Zimmermann",
+			"Braun", "Krüger", "Hofmann", "Hartmann", "Lange", "Schmitt", "Werner", "Schmitz", "Krause", "Meier"},
+		freeEmailDomains: []string{"gmail.com", "web.de", "gmx.de", "t-online.de", "gmx.net", "freenet.de"},
+		tlds:             []string{"de", "de", "de", "com", "net", "eu"},
+		phoneFormats:     []string{"030 ########", "089 #######", "0171 #######", "+49 151 ########"},
+		streets: []string{"Hauptstraße", "Schulstraße", "Gartenstraße", "Bahnhofstraße", "Dorfstraße", "Bergstraße",
+			"Birkenweg", "Lindenstraße", "Kirchstraße", "Waldstraße", "Ringstraße", "Schillerstraße", "Goethestraße", "Am Markt"},
+		cities:         []string{"Berlin", "Hamburg", "München", "Köln", "Frankfurt am Main", "Stuttgart", "Düsseldorf", "Leipzig", "Dresden", "Hannover", "Nürnberg", "Bremen"},
+		addressFormat:  "%[2]s %[1]s, %[4]s %[3]s",
+		maxHouseNumber: 150,
+		postcode:       "#####",
+		ibanCountry:    "DE",
+		ibanFormat:     "##################",
+	},
+	"fr_FR": {
+		firstNames: []string{"Gabriel", "Louise", "Léo", "Jade", "Raphaël", "Emma", "Arthur", "Alice", "Louis", "Chloé",
+			"Jules", "Lina", "Adam", "Léa", "Hugo", "Manon", "Lucas", "Camille", "Nathan", "Inès",
+			"Pierre", "Marie", "Jean", "Isabelle", "Michel", "Nathalie", "François", "Sylvie", "Philippe", "Céline"},
+		lastNames: []string{"Martin", "Bernard", "Thomas", "Petit", "Robert", "Richard", "Durand", "Dubois", "Moreau", "Laurent",
+			"Simon", "Michel", "Lefebvre", "Leroy", "Roux", "David", "Bertrand", "Morel", "Fournier", "Girard",
+			"Bonnet", "Dupont", "Lambert", "Fontaine", "Rousseau", "Vincent", "Muller", "Lefèvre", "Faure", "André"},
+		freeEmailDomains: []string{"gmail.com", "orange.fr", "free.fr", "laposte.net", "sfr.fr", "hotmail.fr"},
+		tlds:             []string{"fr", "fr", "fr", "com", "net", "eu"},
+		phoneFormats:     []string{"01 ## ## ## ##", "06 ## ## ## ##", "07 ## ## ## ##", "+33 6 ## ## ## ##"},
+		streets: []string{"rue de la République", "rue Victor Hugo", "avenue Jean Jaurès", "rue de la Paix", "boulevard Pasteur",
+			"rue du Moulin", "place de l'Église", "rue des Écoles", "avenue de la Gare", "rue Nationale", "chemin des Vignes", "rue de Paris"},
+		cities:         []string{"Paris", "Lyon", "Marseille", "Toulouse", "Nice", "Nantes", "Strasbourg", "Montpellier", "Bordeaux", "Lille", "Rennes", "Grenoble"},
+		addressFormat:  "%[1]s %[2]s, %[4]s %[3]s",
+		maxHouseNumber: 120,
+		postcode:       "#####",
+		ibanCountry:    "FR",
+		ibanFormat:     "#######################",
+	},
+}
@@ -1,17 +1,44 @@
 package generator
 
 import (
-	"math/rand"
+	"context"
 	"time"
 
 	config "github.com/coccyx/gogen/internal"
 	log "github.com/coccyx/gogen/logger"
+	"github.com/coccyx/gogen/metrics"
 )
 
-func Start(gq chan *config.GenQueueItem, gqs chan int) {
-	source := rand.NewSource(time.Now().UnixNano())
-	generator := rand.New(source)
-	gens := make(map[string]config.Generator)
+// Start starts a generator thread and runs until gq is closed.  If ctx is cancelled first, remaining
+// items are dropped rather than generated.  Items without their own generator draw from one seeded
+// with seed.
+func Start(ctx context.Context, gq chan *config.GenQueueItem, gqs chan int, seed int64) {
+	generator := config.NewRand(seed, "generator")
+	// Generators are kept by sample name, for the sample they were made for.  A reload replaces
+	// changed samples, so a new sample gets a new generator and its raters primed again.
+	type cachedGen struct {
+		s   *config.Sample
+		gen config.Generator
+	}
+	gens := make(map[string]cachedGen)
+	var getGen func(s *config.Sample) config.Generator
+	getGen = func(s *config.Sample) config.Generator {
+		if cg, ok := gens[s.Name]; ok && cg.s == s {
+			return cg.gen
+		}
+		log.Infof("Setting sample '%s' to generator '%s'", s.Name, s.Generator)
+		var gen config.Generator
+		if s.Generator == "sample" || s.Generator == "replay" {
+			gen = new(sample)
+		} else if s.Generator == "transaction" {
+			gen = &transaction{gen: getGen}
+		} else {
+			gen = new(luagen)
+		}
+		PrimeRater(s)
+		gens[s.Name] = cachedGen{s: s, gen: gen}
+		return gen
+	}
 	// defer profile.Start(profile.CPUProfile, profile.ProfilePath(".")).Stop()
 	// defer profile.Start(profile.MemProfile, profile.ProfilePath(".")).Stop()
 	for {
@@ -20,21 +47,16 @@ func Start(gq chan *config.GenQueueItem, gqs chan int) {
 			gqs <- 1
 			break
 		}
-		item.Rand = generator
-		// Check to see if our generator is not set
-		if gens[item.S.Name] == nil {
-			log.Infof("Setting sample '%s' to generator '%s'", item.S.Name, item.S.Generator)
-			if item.S.Generator == "sample" || item.S.Generator == "replay" {
-				s := new(sample)
-				gens[item.S.Name] = s
-			} else {
-				s := new(luagen)
-				gens[item.S.Name] = s
-			}
-			PrimeRater(item.S)
+		if ctx.Err() != nil {
+			continue
+		}
+		if item.Rand == nil {
+			item.Rand = generator
 		}
 		// log.Debugf("Generating item %#v", item)
-		err := gens[item.S.Name].Gen(item)
+		start := time.Now()
+		err := getGen(item.S).Gen(item)
+		metrics.GenLatency.Observe(item.S.Name, time.Since(start).Seconds())
 		if err != nil {
 			log.Errorf("Error received from generator: %s", err)
 		}
@@ -1,6 +1,7 @@
 package generator
 
 import (
+	"context"
 	"math/rand"
 	"os"
 	"path/filepath"
@@ -37,7 +38,7 @@ func TestGenerator(t *testing.T) {
 	gqi := &config.GenQueueItem{Count: 1, Earliest: now(), Latest: now(), Now: now(), S: s, OQ: oq, Rand: randgen}
 	gq := make(chan *config.GenQueueItem)
 	gqs := make(chan int)
-	go Start(gq, gqs)
+	go Start(context.Background(), gq, gqs, 0)
 	gq <- gqi
 	close(gq)
 	oqi := <-oq
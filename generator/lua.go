@@ -8,6 +8,7 @@ import (
 
 	config "github.com/coccyx/gogen/internal"
 	log "github.com/coccyx/gogen/logger"
+	"github.com/coccyx/gogen/metrics"
 	luar "github.com/layeh/gopher-luar"
 	lua "github.com/yuin/gopher-lua"
 )
@@ -16,9 +17,9 @@ type luagen struct {
 	initialized bool
 	currentItem *config.GenQueueItem
 	tokens      []config.Token
-	states      map[string]*config.GeneratorState
-	code        map[string]*lua.LFunction
-	lstates     map[string]*sync.Pool
+	states      map[*config.Sample]*config.GeneratorState
+	code        map[*config.Sample]*lua.FunctionProto
+	lstates     map[*config.Sample]*sync.Pool
 }
 
 func sleep(L *lua.LState) int {
@@ -48,6 +49,7 @@ func (lg *luagen) sendevents(events []map[string]string) {
 	item := lg.currentItem
 	// log.Debugf("events: %# v", pretty.Formatter(events))
 	outitem := &config.OutQueueItem{S: item.S, Events: events}
+	metrics.EventsGenerated.Add(item.S.Name, float64(len(events)))
 	item.OQ <- outitem
 }
 
@@ -254,9 +256,9 @@ func (lg *luagen) replaceTokens(L *lua.LState) int {
 func (lg *luagen) Gen(item *config.GenQueueItem) error {
 	if !lg.initialized {
 		lg.tokens = make([]config.Token, 0)
-		lg.states = make(map[string]*config.GeneratorState)
-		lg.code = make(map[string]*lua.LFunction)
-		lg.lstates = make(map[string]*sync.Pool)
+		lg.states = make(map[*config.Sample]*config.GeneratorState)
+		lg.code = make(map[*config.Sample]*lua.FunctionProto)
+		lg.lstates = make(map[*config.Sample]*sync.Pool)
 		lg.initialized = true
 	}
 	s := item.S
@@ -267,18 +269,19 @@ func (lg *luagen) Gen(item *config.GenQueueItem) error {
 		gs = s.GeneratorState
 	} else {
 		var ok bool
-		if gs, ok = lg.states[s.Name]; !ok {
-			lg.states[s.Name] = config.NewGeneratorState(s)
-			gs = lg.states[s.Name]
+		if gs, ok = lg.states[s]; !ok {
+			lg.states[s] = config.NewGeneratorState(s)
+			gs = lg.states[s]
 		}
 	}
 	lg.currentItem = item
 
 	// log.Debugf("Lua Gen called for sample '%s'", item.S.Name)
-	if _, ok := lg.lstates[s.Name]; !ok {
-		lg.lstates[s.Name] = &sync.Pool{
+	if _, ok := lg.lstates[s]; !ok {
+		lg.lstates[s] = &sync.Pool{
 			New: func() interface{} {
 				L := lua.NewState()
+				s.LuaLibrary.Open(L)
 				// Register global variables
 				L.SetGlobal("state", gs.LuaState)
 				L.SetGlobal("options", luar.New(L, s.CustomGenerator.Options))
@@ -303,8 +306,8 @@ func (lg *luagen) Gen(item *config.GenQueueItem) error {
 			},
 		}
 	}
-	L := lg.lstates[s.Name].Get().(*lua.LState)
-	defer lg.lstates[s.Name].Put(L)
+	L := lg.lstates[s].Get().(*lua.LState)
+	defer lg.lstates[s].Put(L)
 	L.SetGlobal("state", gs.LuaState)
 	L.SetGlobal("options", luar.New(L, s.CustomGenerator.Options))
 	L.SetGlobal("lines", gs.LuaLines)
@@ -312,22 +315,22 @@ func (lg *luagen) Gen(item *config.GenQueueItem) error {
 	L.SetGlobal("earliest", luar.New(L, item.Earliest))
 	L.SetGlobal("latest", luar.New(L, item.Latest))
 	L.SetGlobal("now", luar.New(L, item.Now))
+	config.SetLuaRandom(L, item.Rand)
 	// L := lua.NewState()
 	// defer L.Close()
 
 	// log.Debugf("Calling DoString for %# v", s.CustomGenerator.Script)
-	var f *lua.LFunction
-	if _, ok := lg.code[s.Name]; !ok {
+	// Compile once, but the function has to be in this state to see the globals we just set
+	proto, ok := lg.code[s]
+	if !ok {
 		var err error
-		f, err = L.LoadString(s.CustomGenerator.Script)
+		proto, err = config.CompileLua(s.CustomGenerator.Name, s.CustomGenerator.Script)
 		if err != nil {
 			return fmt.Errorf("Error parsing script for generator '%s': %s", s.CustomGenerator.Name, err)
 		}
-		lg.code[s.Name] = f
-	} else {
-		f = lg.code[s.Name]
+		lg.code[s] = proto
 	}
-	L.Push(f)
+	L.Push(config.NewLuaFunction(L, proto))
 	err := L.PCall(0, lua.MultRet, nil)
 	if err != nil {
 		return fmt.Errorf("Error executing script for generator '%s': %s", s.CustomGenerator.Name, err)
@@ -174,6 +174,22 @@ func TestReplaceTokens(t *testing.T) {
 	testLuaGen(t, s, gen, "foo")
 }
 
+func TestLuaModulesGen(t *testing.T) {
+	config.ResetConfig()
+
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "lua", "modules.yml"))
+
+	c := config.NewConfig()
+	s := c.FindSampleByName("modules")
+	gen := new(luagen)
+	testLuaGen(t, s, gen, `{"msg":"HELLO WORLD"}`)
+	// Modules are loaded again in each new Lua state
+	testLuaGen(t, s, gen, `{"msg":"HELLO WORLD"}`)
+}
+
 func testLuaGen(t *testing.T, s *config.Sample, gen *luagen, expected string) {
 	oq, err := runLuaGen(t, s, gen)
 	timeout := make(chan bool, 1)
@@ -7,6 +7,7 @@ import (
 
 	config "github.com/coccyx/gogen/internal"
 	log "github.com/coccyx/gogen/logger"
+	"github.com/coccyx/gogen/metrics"
 )
 
 var bp sync.Pool
@@ -82,6 +83,7 @@ func genSinglePass(item *config.GenQueueItem) error {
 			}
 		}
 		outitem := &config.OutQueueItem{S: item.S, Events: events}
+		metrics.EventsGenerated.Add(item.S.Name, float64(len(events)))
 		item.OQ <- outitem
 	}
 	return nil
@@ -97,6 +99,8 @@ func getBrokenEvent(item *config.GenQueueItem, i int) map[string]string {
 		for _, st := range v {
 			if st.T == nil {
 				event.WriteString(st.S)
+			} else if st.T.Type == "transaction" {
+				event.WriteString(item.Transaction.Value(st.T.Replacement))
 			} else {
 				var choice int
 				if _, ok := choices[st.T.Group]; ok {
@@ -169,6 +173,7 @@ func genMultiPass(item *config.GenQueueItem) error {
 		}
 
 		outitem := &config.OutQueueItem{S: item.S, Events: events}
+		metrics.EventsGenerated.Add(item.S.Name, float64(len(events)))
 		item.OQ <- outitem
 	}
 	return nil
@@ -185,7 +190,11 @@ func replaceTokens(item *config.GenQueueItem, event *map[string]string, outsidec
 	e := *event
 	for _, token := range tokens {
 		if !token.Disabled {
-			if fieldval, ok := e[token.Field]; ok {
+			if fieldval, ok := e[token.Field]; ok && token.Type == "transaction" {
+				if pos1, pos2, err := token.GetReplacementOffsets(fieldval); err == nil {
+					e[token.Field] = fieldval[:pos1] + item.Transaction.Value(token.Replacement) + fieldval[pos2:]
+				}
+			} else if ok {
 				var choice int
 				var err error
 				if _, ok := choices[token.Group]; ok {
@@ -0,0 +1,55 @@
+package generator
+
+import (
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	uuid "github.com/satori/go.uuid"
+)
+
+// transaction generates linked events in each of its steps' samples.  The events of a transaction
+// share its ID, and each step happens some latency after the step before.
+type transaction struct {
+	// gen returns the generator for a step's sample
+	gen func(s *config.Sample) config.Generator
+}
+
+func (tr *transaction) Gen(item *config.GenQueueItem) error {
+	s := item.S
+	// Each step's events are collected and sent as one batch, rather than one event at a time
+	events := make([][]map[string]string, len(s.Steps))
+	oq := make(chan *config.OutQueueItem, 1)
+	for i := 0; i < item.Count; i++ {
+		var u uuid.UUID
+		item.Rand.Read(u[:])
+		u.SetVersion(4)
+		u.SetVariant()
+		id := u.String()
+
+		var offset time.Duration
+		if td := item.Latest.Sub(item.Earliest); td > 0 {
+			offset = time.Duration(item.Rand.Int63n(int64(td)))
+		}
+		t := item.Latest.Add(offset * -1)
+		for j, step := range s.Steps {
+			t = t.Add(step.Latency(item.Rand))
+			si := &config.GenQueueItem{S: step.S, Count: 1, Event: -1, Earliest: t, Latest: t, Now: item.Now, OQ: oq, Rand: item.Rand,
+				Transaction: &config.TransactionContext{ID: id, Name: s.Name, Step: j}}
+			if err := tr.gen(step.S).Gen(si); err != nil {
+				return err
+			}
+			// Steps all use the sample generator, which has sent the step's event by the time it returns
+			select {
+			case oi := <-oq:
+				events[j] = append(events[j], oi.Events...)
+			default:
+			}
+		}
+	}
+	for j, step := range s.Steps {
+		if len(events[j]) > 0 {
+			item.OQ <- &config.OutQueueItem{S: step.S, Events: events[j]}
+		}
+	}
+	return nil
+}
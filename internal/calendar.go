@@ -0,0 +1,467 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CalendarRange multiplies the rate by Rate on every day from Start to End inclusive.  Start and
+// End are either dates as YYYY-MM-DD, or both days of the year as MM-DD, which repeat every year
+// and may wrap around the new year.
+type CalendarRange struct {
+	Start string  `json:"start" yaml:"start"`
+	End   string  `json:"end" yaml:"end"`
+	Rate  float64 `json:"rate" yaml:"rate"`
+}
+
+// Contains returns whether date, as YYYY-MM-DD, falls in the range
+func (cr CalendarRange) Contains(date string) bool {
+	if len(cr.Start) == len("01-02") {
+		date = date[5:]
+		if cr.Start > cr.End {
+			return date >= cr.Start || date <= cr.End
+		}
+	}
+	return date >= cr.Start && date <= cr.End
+}
+
+// validateCalendarRater casts the options of a calendar rater, loading any holidays file into its
+// Dates.  Dates set in the config win over the same dates from the holidays file.
+func (c *Config) validateCalendarRater(r *RaterConfig) {
+	loc := time.Local
+	if tz, ok := r.Options["Timezone"]; ok {
+		var err error
+		if loc, err = time.LoadLocation(fmt.Sprint(tz)); err != nil {
+			c.fatalf("Timezone '%v' for rater '%s' is not valid: %s", tz, r.Name, err)
+		}
+	}
+
+	dates := make(map[string]float64)
+	if holidays, ok := r.Options["Holidays"]; ok {
+		rate, hasRate := r.Options["HolidayRate"].(float64)
+		loaded, err := c.readHolidays(fmt.Sprint(holidays), loc)
+		if err != nil {
+			c.fatalf("Error reading holidays for rater '%s': %s", r.Name, err)
+		}
+		for date, holidayRate := range loaded {
+			if holidayRate == nil {
+				if !hasRate {
+					c.fatalf("Holiday '%s' for rater '%s' has no rate and there's no HolidayRate", date, r.Name)
+				}
+				holidayRate = &rate
+			}
+			dates[date] = *holidayRate
+		}
+	}
+	if v, ok := r.Options["Dates"]; ok {
+		if _, ok := v.(map[string]float64); !ok {
+			eachOption(v, func(k, v interface{}) {
+				date := calendarDate(fmt.Sprint(k))
+				if date == "" {
+					c.fatalf("Date '%v' for rater '%s' is not YYYY-MM-DD or MM-DD", k, r.Name)
+				}
+				f, ok := toFloat(v)
+				if !ok {
+					c.fatalf("Rate '%#v' for date '%v' of rater '%s' is not a number", v, k, r.Name)
+				}
+				dates[date] = f
+			})
+		} else {
+			for date, f := range v.(map[string]float64) {
+				dates[date] = f
+			}
+		}
+	}
+	if len(dates) > 0 {
+		r.Options["Dates"] = dates
+	}
+
+	if v, ok := r.Options["Ranges"]; ok {
+		if _, ok := v.([]CalendarRange); ok {
+			return
+		}
+		items, ok := v.([]interface{})
+		if !ok {
+			c.fatalf("Ranges for rater '%s' must be a list of ranges", r.Name)
+		}
+		ranges := make([]CalendarRange, 0, len(items))
+		for _, item := range items {
+			var cr CalendarRange
+			var hasRate bool
+			eachOption(item, func(k, v interface{}) {
+				switch strings.ToLower(fmt.Sprint(k)) {
+				case "start":
+					cr.Start = calendarDate(fmt.Sprint(v))
+				case "end":
+					cr.End = calendarDate(fmt.Sprint(v))
+				case "rate":
+					cr.Rate, hasRate = toFloat(v)
+				}
+			})
+			if cr.Start == "" || cr.End == "" || len(cr.Start) != len(cr.End) {
+				c.fatalf("Range '%v' for rater '%s' needs a start and end which are both YYYY-MM-DD or both MM-DD", item, r.Name)
+			}
+			if !hasRate {
+				c.fatalf("Range '%v' for rater '%s' needs a rate", item, r.Name)
+			}
+			if len(cr.Start) > len("01-02") && cr.Start > cr.End {
+				c.fatalf("Range '%v' for rater '%s' ends before it starts", item, r.Name)
+			}
+			ranges = append(ranges, cr)
+		}
+		r.Options["Ranges"] = ranges
+	}
+}
+
+// eachOption calls f with every key and value of a map option, as decoded from YAML or JSON
+func eachOption(v interface{}, f func(k, v interface{})) {
+	switch vcast := v.(type) {
+	case map[interface{}]interface{}:
+		for k, v := range vcast {
+			f(k, v)
+		}
+	case map[string]interface{}:
+		for k, v := range vcast {
+			f(k, v)
+		}
+	}
+}
+
+// calendarDate normalizes a date as YYYY-MM-DD or a day of the year as MM-DD, returning an empty
+// string if it's neither
+func calendarDate(s string) string {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t.Format("2006-01-02")
+	}
+	// Parse days of the year in a leap year so Feb 29th is allowed
+	if t, err := time.Parse("2006-01-02", "2000-"+s); err == nil {
+		return t.Format("01-02")
+	}
+	return ""
+}
+
+// readHolidays reads a holidays file, either an iCalendar file of all day events or a CSV file with
+// a header row and columns date and optionally rate.  It returns the rate for each date, or nil if
+// the file doesn't set one.  Events with a time fall on their dates in loc.  The file is found as
+// given, next to the full config, or in the config directory's raters directory.
+func (c *Config) readHolidays(fileName string, loc *time.Location) (map[string]*float64, error) {
+	fullPath, err := c.findFile(fileName, "raters")
+	if err != nil {
+		return nil, fmt.Errorf("Cannot find holidays file '%s'", fileName)
+	}
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if strings.ToLower(filepath.Ext(file.Name())) == ".ics" {
+		return readICS(file, loc)
+	}
+	return readHolidaysCSV(file)
+}
+
+func readHolidaysCSV(r io.Reader) (map[string]*float64, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing header row of holidays as csv: %s", err)
+	}
+	dateCol, rateCol := -1, -1
+	for i, field := range header {
+		switch strings.ToLower(strings.TrimSpace(field)) {
+		case "date":
+			dateCol = i
+		case "rate":
+			rateCol = i
+		}
+	}
+	if dateCol < 0 {
+		return nil, fmt.Errorf("Holidays csv has no date column")
+	}
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing holidays as csv: %s", err)
+	}
+	holidays := make(map[string]*float64)
+	for _, row := range rows {
+		if dateCol >= len(row) {
+			continue
+		}
+		date := calendarDate(strings.TrimSpace(row[dateCol]))
+		if date == "" {
+			return nil, fmt.Errorf("Holiday date '%s' is not YYYY-MM-DD or MM-DD", row[dateCol])
+		}
+		holidays[date] = nil
+		if rateCol >= 0 && rateCol < len(row) && strings.TrimSpace(row[rateCol]) != "" {
+			rate, err := strconv.ParseFloat(strings.TrimSpace(row[rateCol]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("Rate '%s' for holiday '%s' is not a number", row[rateCol], date)
+			}
+			holidays[date] = &rate
+		}
+	}
+	return holidays, nil
+}
+
+// maxICSYears is how far ahead yearly rules are expanded, in case COUNT is never reached
+const maxICSYears = 1000
+
+// icsEvent is the schedule of a VEVENT in an iCalendar file
+type icsEvent struct {
+	start, end time.Time
+	allDay     bool
+	rrule      string
+	rdates     []time.Time
+	exdates    []time.Time
+}
+
+// readICS reads the days covered by each event in an iCalendar file.  All day events end the day
+// before their DTEND, events with a time cover the days in loc they start and end on.  Events
+// repeat on their RDATEs, less their EXDATEs, and yearly on their date if they have an RRULE.
+// Yearly rules without a COUNT or UNTIL return days of the year as MM-DD, which repeat every year.
+func readICS(r io.Reader, loc *time.Location) (map[string]*float64, error) {
+	holidays := make(map[string]*float64)
+	var e *icsEvent
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		// Long lines are folded onto continuation lines starting with whitespace
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		name, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			name, value = line[:i], line[i+1:]
+		}
+		params := strings.Split(name, ";")
+		var tzid string
+		for _, p := range params[1:] {
+			if strings.HasPrefix(strings.ToUpper(p), "TZID=") {
+				tzid = strings.Trim(p[len("TZID="):], `"`)
+			} else if strings.ToUpper(p) == "VALUE=PERIOD" {
+				return nil, fmt.Errorf("Periods in iCalendar %s '%s' are not supported", params[0], value)
+			}
+		}
+		prop := strings.ToUpper(params[0])
+		if e == nil && prop != "BEGIN" {
+			continue
+		}
+		switch prop {
+		case "BEGIN":
+			if strings.ToUpper(value) == "VEVENT" {
+				e = &icsEvent{}
+			}
+		case "DTSTART", "DTEND":
+			t, isDate, err := parseICSTime(value, tzid, loc)
+			if err != nil {
+				return nil, err
+			}
+			if prop == "DTSTART" {
+				e.start, e.allDay = t, isDate
+			} else {
+				e.end = t
+			}
+		case "RRULE":
+			e.rrule = value
+		case "RDATE", "EXDATE":
+			for _, v := range strings.Split(value, ",") {
+				t, _, err := parseICSTime(v, tzid, loc)
+				if err != nil {
+					return nil, err
+				}
+				if prop == "RDATE" {
+					e.rdates = append(e.rdates, t)
+				} else {
+					e.exdates = append(e.exdates, t)
+				}
+			}
+		case "END":
+			if strings.ToUpper(value) != "VEVENT" {
+				continue
+			}
+			if !e.start.IsZero() {
+				days, err := e.days(loc)
+				if err != nil {
+					return nil, err
+				}
+				for _, d := range days {
+					holidays[d] = nil
+				}
+			}
+			e = nil
+		}
+	}
+	return holidays, nil
+}
+
+// days returns every day the event covers, as YYYY-MM-DD, or as MM-DD if it repeats forever
+func (e *icsEvent) days(loc *time.Location) ([]string, error) {
+	occurrences := []time.Time{e.start}
+	if e.rrule != "" {
+		var forever bool
+		var err error
+		if occurrences, forever, err = e.yearly(); err != nil {
+			return nil, err
+		}
+		if forever {
+			if len(e.exdates) > 0 {
+				return nil, fmt.Errorf("EXDATE with RRULE '%s' which has no COUNT or UNTIL is not supported", e.rrule)
+			}
+			var days []string
+			for _, t := range e.span(e.start, loc) {
+				days = append(days, t.Format("01-02"))
+			}
+			return days, nil
+		}
+	}
+	occurrences = append(occurrences, e.rdates...)
+	excluded := make(map[int64]bool, len(e.exdates))
+	for _, t := range e.exdates {
+		excluded[t.Unix()] = true
+	}
+	var days []string
+	for _, o := range occurrences {
+		if excluded[o.Unix()] {
+			continue
+		}
+		for _, t := range e.span(o, loc) {
+			days = append(days, t.Format("2006-01-02"))
+		}
+	}
+	return days, nil
+}
+
+// span returns the days covered by the occurrence of the event starting at start
+func (e *icsEvent) span(start time.Time, loc *time.Location) []time.Time {
+	var duration time.Duration
+	if !e.end.IsZero() && e.end.After(e.start) {
+		duration = e.end.Sub(e.start)
+	}
+	first, last := start, start
+	if e.allDay {
+		if duration > 0 {
+			last = start.Add(duration).AddDate(0, 0, -1)
+		}
+	} else {
+		first = start.In(loc)
+		last = first
+		// An event ending at midnight doesn't cover the next day
+		if duration > 0 {
+			last = start.Add(duration - time.Nanosecond).In(loc)
+		}
+		first = time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, time.UTC)
+		last = time.Date(last.Year(), last.Month(), last.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	var days []time.Time
+	for d := first; !d.After(last); d = d.AddDate(0, 0, 1) {
+		days = append(days, d)
+	}
+	return days
+}
+
+// yearly expands the event's RRULE, which must repeat yearly on DTSTART's date, returning each
+// occurrence or forever if it has no COUNT or UNTIL
+func (e *icsEvent) yearly() ([]time.Time, bool, error) {
+	unsupported := fmt.Errorf("Unsupported RRULE '%s', only yearly rules repeating on the date of DTSTART are supported", e.rrule)
+	interval, count := 1, 0
+	var until time.Time
+	var freq string
+	for _, part := range strings.Split(e.rrule, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, false, unsupported
+		}
+		k, v := strings.ToUpper(kv[0]), kv[1]
+		n, nerr := strconv.Atoi(v)
+		switch k {
+		case "FREQ":
+			freq = strings.ToUpper(v)
+		case "INTERVAL":
+			if nerr != nil || n < 1 {
+				return nil, false, unsupported
+			}
+			interval = n
+		case "COUNT":
+			if nerr != nil || n < 1 {
+				return nil, false, unsupported
+			}
+			count = n
+		case "UNTIL":
+			var err error
+			if until, _, err = parseICSTime(v, "", e.start.Location()); err != nil {
+				return nil, false, err
+			}
+		case "BYMONTH":
+			if nerr != nil || n != int(e.start.Month()) {
+				return nil, false, unsupported
+			}
+		case "BYMONTHDAY":
+			if nerr != nil || n != e.start.Day() {
+				return nil, false, unsupported
+			}
+		case "WKST":
+		default:
+			return nil, false, unsupported
+		}
+	}
+	if freq != "YEARLY" {
+		return nil, false, unsupported
+	}
+	if count == 0 && until.IsZero() {
+		return nil, true, nil
+	}
+	var occurrences []time.Time
+	// Feb 29th only occurs in leap years, other years don't count towards COUNT
+	for i := 0; i <= maxICSYears && (count == 0 || len(occurrences) < count); i += interval {
+		t := e.start.AddDate(i, 0, 0)
+		if !until.IsZero() && t.After(until) {
+			break
+		}
+		if t.Day() == e.start.Day() {
+			occurrences = append(occurrences, t)
+		}
+	}
+	return occurrences, false, nil
+}
+
+// parseICSTime parses an iCalendar DATE, as midnight UTC, or DATE-TIME, in UTC if it ends with Z,
+// in tzid if set or otherwise floating in loc.  It returns whether it was a DATE.
+func parseICSTime(value string, tzid string, loc *time.Location) (time.Time, bool, error) {
+	if len(value) == len("20060102") {
+		t, err := time.Parse("20060102", value)
+		if err != nil {
+			return t, true, fmt.Errorf("Cannot parse iCalendar date '%s'", value)
+		}
+		return t, true, nil
+	}
+	if strings.HasSuffix(value, "Z") {
+		loc = time.UTC
+	} else if tzid != "" {
+		var err error
+		if loc, err = time.LoadLocation(tzid); err != nil {
+			return time.Time{}, false, fmt.Errorf("Unknown iCalendar TZID '%s': %s", tzid, err)
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", strings.TrimSuffix(value, "Z"), loc)
+	if err != nil {
+		return t, false, fmt.Errorf("Cannot parse iCalendar time '%s'", value)
+	}
+	return t, false, nil
+}
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func icsDays(t *testing.T, events string, loc *time.Location) []string {
+	holidays, err := readICS(strings.NewReader("BEGIN:VCALENDAR\r\n"+events+"END:VCALENDAR\r\n"), loc)
+	assert.NoError(t, err)
+	var days []string
+	for d := range holidays {
+		days = append(days, d)
+	}
+	sort.Strings(days)
+	return days
+}
+
+func TestReadICS(t *testing.T) {
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+
+	// Yearly rules with a COUNT or UNTIL expand to each year, less EXDATEs and plus RDATEs
+	assert.Equal(t, []string{"2021-07-04", "2023-07-04", "2024-07-05"}, icsDays(t, "BEGIN:VEVENT\r\n"+
+		"DTSTART;VALUE=DATE:20210704\r\nRRULE:FREQ=YEARLY;BYMONTH=7;BYMONTHDAY=4;COUNT=3\r\n"+
+		"EXDATE;VALUE=DATE:20220704\r\nRDATE;VALUE=DATE:20240705\r\nEND:VEVENT\r\n", tokyo))
+	assert.Equal(t, []string{"2024-02-29", "2028-02-29"}, icsDays(t, "BEGIN:VEVENT\r\n"+
+		"DTSTART;VALUE=DATE:20240229\r\nRRULE:FREQ=YEARLY;UNTIL=20300101\r\nEND:VEVENT\r\n", tokyo))
+	// Without either they repeat every year, spanning the new year if need be
+	assert.Equal(t, []string{"01-01", "12-31"}, icsDays(t, "BEGIN:VEVENT\r\n"+
+		"DTSTART;VALUE=DATE:20201231\r\nDTEND;VALUE=DATE:20210102\r\nRRULE:FREQ=YEARLY\r\nEND:VEVENT\r\n", tokyo))
+
+	// Timed events land on their dates in the rater's timezone, whether in UTC, a TZID or floating
+	assert.Equal(t, []string{"2024-10-01"}, icsDays(t, "BEGIN:VEVENT\r\n"+
+		"DTSTART:20240930T170000Z\r\nDTEND:20240930T230000Z\r\nEND:VEVENT\r\n", tokyo))
+	assert.Equal(t, []string{"2024-10-01", "2024-10-02"}, icsDays(t, "BEGIN:VEVENT\r\n"+
+		"DTSTART;TZID=America/New_York:20240930T200000\r\nDTEND;TZID=America/New_York:20241001T200000\r\nEND:VEVENT\r\n", tokyo))
+	assert.Equal(t, []string{"2024-09-30"}, icsDays(t, "BEGIN:VEVENT\r\n"+
+		"DTSTART:20240930T230000\r\nDTEND:20241001T000000\r\nEND:VEVENT\r\n", tokyo))
+
+	// Folded lines are unfolded, and VTIMEZONE rules aren't events
+	assert.Equal(t, []string{"2024-01-01", "2024-05-01", "2024-12-25"}, icsDays(t, "BEGIN:VTIMEZONE\r\nTZID:Custom\r\n"+
+		"BEGIN:STANDARD\r\nDTSTART:19701025T030000\r\nRRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU\r\nEND:STANDARD\r\nEND:VTIMEZONE\r\n"+
+		"BEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20240101\r\nRDATE;VALUE=DATE:20240501,\r\n 20241225\r\nEND:VEVENT\r\n", tokyo))
+
+	invalid := []string{
+		"DTSTART;VALUE=DATE:20240115\r\nRRULE:FREQ=YEARLY;BYMONTH=1;BYDAY=3MO\r\n",
+		"DTSTART;VALUE=DATE:20240115\r\nRRULE:FREQ=MONTHLY\r\n",
+		"DTSTART;VALUE=DATE:20240115\r\nRRULE:FREQ=YEARLY\r\nEXDATE;VALUE=DATE:20250115\r\n",
+		"DTSTART;TZID=Eastern Standard Time:20240115T090000\r\n",
+		"DTSTART;VALUE=DATE:20240115\r\nRDATE;VALUE=PERIOD:20240201T090000Z/PT1H\r\n",
+	}
+	for _, event := range invalid {
+		_, err := readICS(strings.NewReader("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\n"+event+"END:VEVENT\r\nEND:VCALENDAR\r\n"), tokyo)
+		assert.Error(t, err, event)
+	}
+}
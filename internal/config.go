@@ -16,6 +16,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/coccyx/gogen/fake"
 	log "github.com/coccyx/gogen/logger"
 	"github.com/coccyx/gogen/template"
 	"github.com/coccyx/timeparser"
@@ -32,27 +33,50 @@ type Config struct {
 	Templates   []*Template        `json:"templates,omitempty" yaml:"templates,omitempty"`
 	Raters      []*RaterConfig     `json:"raters,omitempty" yaml:"raters,omitempty"`
 	Generators  []*GeneratorConfig `json:"generators,omitempty" yaml:"generators,omitempty"`
+	Pools       []*Pool            `json:"pools,omitempty" yaml:"pools,omitempty"`
+	Scenarios   []*Scenario        `json:"scenarios,omitempty" yaml:"scenarios,omitempty"`
+	LuaModules  []*LuaModule       `json:"luaModules,omitempty" yaml:"luaModules,omitempty"`
 	initialized bool
 	cc          ConfigConfig
+	// invalid lists samples disabled because they failed validation
+	invalid []string
+	// globalYAML is Global as configured, before any command line overrides
+	globalYAML []byte
+	// luaLibrary is LuaModules and the modules in Global.LuaPath, compiled
+	luaLibrary *LuaLibrary
+	// ratersMutex guards Raters and luaLibrary, which samples use as they run, against reloads
+	ratersMutex sync.RWMutex
 
 	// Exported but internal use variables
 	Timezone *time.Location `json:"-" yaml:"-"`
 	Buf      bytes.Buffer   `json:"-" yaml:"-"`
+	// SampleOverrides, if set, is applied to samples in configs built by Reload
+	SampleOverrides func(s *Sample) `json:"-" yaml:"-"`
 }
 
 // Global represents global configuration options which apply to all of gogen
 type Global struct {
-	Debug            bool     `json:"debug,omitempty" yaml:"debug,omitempty"`
-	Verbose          bool     `json:"verbose,omitempty" yaml:"verbose,omitempty"`
-	GeneratorWorkers int      `json:"generatorWorkers,omitempty" yaml:"generatorWorkers,omitempty"`
-	OutputWorkers    int      `json:"outputWorkers,omitempty" yaml:"outputWorkers,omitempty"`
-	ROTInterval      int      `json:"rotInterval,omitempty" yaml:"rotInterval,omitempty"`
-	Output           Output   `json:"output,omitempty" yaml:"output,omitempty"`
-	SamplesDir       []string `json:"samplesDir,omitempty" yaml:"samplesDir,omitempty"`
+	Debug            bool      `json:"debug,omitempty" yaml:"debug,omitempty"`
+	Verbose          bool      `json:"verbose,omitempty" yaml:"verbose,omitempty"`
+	GeneratorWorkers int       `json:"generatorWorkers,omitempty" yaml:"generatorWorkers,omitempty"`
+	OutputWorkers    int       `json:"outputWorkers,omitempty" yaml:"outputWorkers,omitempty"`
+	ROTInterval      int       `json:"rotInterval,omitempty" yaml:"rotInterval,omitempty"`
+	Output           Output    `json:"output,omitempty" yaml:"output,omitempty"`
+	Outputs          []*Output `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+	SamplesDir       []string  `json:"samplesDir,omitempty" yaml:"samplesDir,omitempty"`
+	Seed             int64     `json:"seed,omitempty" yaml:"seed,omitempty"`
+	MetricsAddr      string    `json:"metricsAddr,omitempty" yaml:"metricsAddr,omitempty"`
+	APIAddr          string    `json:"apiAddr,omitempty" yaml:"apiAddr,omitempty"`
+	WatchConfig      bool      `json:"watchConfig,omitempty" yaml:"watchConfig,omitempty"`
+	TargetEPS        float64   `json:"targetEPS,omitempty" yaml:"targetEPS,omitempty"`
+	TargetGBPerDay   float64   `json:"targetGBPerDay,omitempty" yaml:"targetGBPerDay,omitempty"`
+	DrainTimeout     string    `json:"drainTimeout,omitempty" yaml:"drainTimeout,omitempty"`
+	LuaPath          []string  `json:"luaPath,omitempty" yaml:"luaPath,omitempty"`
 }
 
 // Output represents configuration for outputting data
 type Output struct {
+	Name           string            `json:"name,omitempty" yaml:"name,omitempty"`
 	FileName       string            `json:"fileName,omitempty" yaml:"fileName,omitempty"`
 	MaxBytes       int64             `json:"maxBytes,omitempty" yaml:"maxBytes,omitempty"`
 	BackupFiles    int               `json:"backupFiles,omitempty" yaml:"backupFiles,omitempty"`
@@ -61,6 +85,27 @@ type Output struct {
 	OutputTemplate string            `json:"outputTemplate,omitempty" yaml:"outputTemplate,omitempty"`
 	Endpoints      []string          `json:"endpoints,omitempty" yaml:"endpoints,omitempty"`
 	Headers        map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Topic          string            `json:"topic,omitempty" yaml:"topic,omitempty"`
+	KeyField       string            `json:"keyField,omitempty" yaml:"keyField,omitempty"`
+	PartitionField string            `json:"partitionField,omitempty" yaml:"partitionField,omitempty"`
+	Compression    string            `json:"compression,omitempty" yaml:"compression,omitempty"`
+	Acks           string            `json:"acks,omitempty" yaml:"acks,omitempty"`
+	Protocol       string            `json:"protocol,omitempty" yaml:"protocol,omitempty"`
+	Framing        string            `json:"framing,omitempty" yaml:"framing,omitempty"`
+	SyslogFormat   string            `json:"syslogFormat,omitempty" yaml:"syslogFormat,omitempty"`
+	Facility       string            `json:"facility,omitempty" yaml:"facility,omitempty"`
+	Severity       string            `json:"severity,omitempty" yaml:"severity,omitempty"`
+	Timeout        string            `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Retries        int               `json:"retries,omitempty" yaml:"retries,omitempty"`
+	RetryBackoff   string            `json:"retryBackoff,omitempty" yaml:"retryBackoff,omitempty"`
+	MaxBackoff     string            `json:"maxBackoff,omitempty" yaml:"maxBackoff,omitempty"`
+	DeadLetterFile string            `json:"deadLetterFile,omitempty" yaml:"deadLetterFile,omitempty"`
+	Channel        string            `json:"channel,omitempty" yaml:"channel,omitempty"`
+	UseAck         bool              `json:"useAck,omitempty" yaml:"useAck,omitempty"`
+	AckTimeout     string            `json:"ackTimeout,omitempty" yaml:"ackTimeout,omitempty"`
+	AckInterval    string            `json:"ackInterval,omitempty" yaml:"ackInterval,omitempty"`
+	// set names the fields set in the config, so a field set to its zero value isn't inherited
+	set map[string]bool
 }
 
 // ConfigConfig represents options to pass to NewConfig
@@ -71,6 +116,9 @@ type ConfigConfig struct {
 	SamplesDir string
 	FullConfig string
 	Export     bool
+	reloading  bool
+	// mixed is set when building a config mixed into another
+	mixed bool
 }
 
 // Share allows accessing the share module from Config without a circular dependency
@@ -147,6 +195,10 @@ func NewConfig() *Config {
 // BuildConfig builds a new config object from the passed ConfigConfig
 func BuildConfig(cc ConfigConfig) *Config {
 	c := &Config{initialized: false, cc: cc}
+	// Configs mixed in are part of the same build as the config mixing them in
+	if !cc.mixed {
+		newSequenceGeneration()
+	}
 
 	// Setup timezone
 	c.Timezone, _ = time.LoadLocation("Local")
@@ -161,7 +213,7 @@ func BuildConfig(cc ConfigConfig) *Config {
 		} else {
 			_, err := os.Stat(cc.FullConfig)
 			if err != nil {
-				log.Fatalf("Cannot stat file %s", cc.FullConfig)
+				c.fatalf("Cannot stat file %s", cc.FullConfig)
 			}
 			if err := c.parseFileConfig(&c, cc.FullConfig); err != nil {
 				log.Panic(err)
@@ -194,6 +246,9 @@ func BuildConfig(cc ConfigConfig) *Config {
 		if c.Global.OutputWorkers == 0 {
 			c.Global.OutputWorkers = defaultOutputWorkers
 		}
+		if c.Global.DrainTimeout == "" {
+			c.Global.DrainTimeout = defaultDrainTimeout
+		}
 		if c.Global.Output.Outputter == "" {
 			c.Global.Output.Outputter = defaultOutputter
 		}
@@ -216,6 +271,29 @@ func BuildConfig(cc ConfigConfig) *Config {
 		if c.Global.Output.BufferBytes == 0 {
 			c.Global.Output.BufferBytes = defaultBufferBytes
 		}
+		if c.Global.Output.Timeout == "" {
+			c.Global.Output.Timeout = defaultTimeout
+		}
+		if c.Global.Output.Retries == 0 && !c.Global.Output.set["Retries"] {
+			c.Global.Output.Retries = defaultRetries
+		}
+		if c.Global.Output.RetryBackoff == "" {
+			c.Global.Output.RetryBackoff = defaultRetryBackoff
+		}
+		if c.Global.Output.MaxBackoff == "" {
+			c.Global.Output.MaxBackoff = defaultMaxBackoff
+		}
+		if c.Global.Output.AckTimeout == "" {
+			c.Global.Output.AckTimeout = defaultAckTimeout
+		}
+		if c.Global.Output.AckInterval == "" {
+			c.Global.Output.AckInterval = defaultAckInterval
+		}
+		// Each of the global outputs gets anything it doesn't set from output
+		for _, o := range c.Global.Outputs {
+			o.inherit(&c.Global.Output)
+		}
+		nameOutputs(c.Global.Outputs)
 
 		// Add default templates
 		templates := []*Template{defaultCSVTemplate, defaultJSONTemplate, defaultSplunkHECTemplate, defaultRawTemplate, defaultModinputTemplate}
@@ -282,6 +360,36 @@ func BuildConfig(cc ConfigConfig) *Config {
 			return nil
 		})
 
+		// Read all entity pools in $GOGEN_HOME/config/pools
+		fullPath = filepath.Join(cc.ConfigDir, "pools")
+		acceptableExtensions = map[string]bool{".yml": true, ".yaml": true, ".json": true}
+		c.walkPath(fullPath, acceptableExtensions, func(innerPath string) error {
+			var p Pool
+
+			if err := c.parseFileConfig(&p, innerPath); err != nil {
+				log.Errorf("Error parsing config %s: %s", innerPath, err)
+				return err
+			}
+
+			c.Pools = append(c.Pools, &p)
+			return nil
+		})
+
+		// Read all scenarios in $GOGEN_HOME/config/scenarios
+		fullPath = filepath.Join(cc.ConfigDir, "scenarios")
+		acceptableExtensions = map[string]bool{".yml": true, ".yaml": true, ".json": true}
+		c.walkPath(fullPath, acceptableExtensions, func(innerPath string) error {
+			var sc Scenario
+
+			if err := c.parseFileConfig(&sc, innerPath); err != nil {
+				log.Errorf("Error parsing config %s: %s", innerPath, err)
+				return err
+			}
+
+			c.Scenarios = append(c.Scenarios, &sc)
+			return nil
+		})
+
 		c.readSamplesDir(cc.SamplesDir)
 	}
 
@@ -344,28 +452,46 @@ func BuildConfig(cc ConfigConfig) *Config {
 		if c.Generators[i].FileName != "" && c.Generators[i].Script == "" {
 			err := c.readGenerator(cc.ConfigDir, c.Generators[i])
 			if err != nil {
-				log.Fatalf("Error reading generator file: %s", err)
+				c.fatalf("Error reading generator file: %s", err)
 			}
 		}
 	}
 
+	// Lua modules are compiled once for every generator, rater and script token to require
+	c.luaLibrary = c.buildLuaLibrary()
+
 	// Due to data structure differences, we append default raters later in the startup process
 	if !cc.Export {
 		raters := []*RaterConfig{defaultRaterConfig, defaultConfigRaterConfig}
 		for _, r := range raters {
 			c.Raters = append(c.Raters, r)
 		}
+		c.validateCompositeRaters()
+	}
+
+	// Entities need generating before tokens can refer to them
+	if !cc.Export {
+		c.buildPools()
 	}
 
 	// There area references from tokens to samples, need to resolve those references
 	for i := 0; i < len(c.Samples); i++ {
-		c.validate(c.Samples[i])
+		s := c.Samples[i]
+		real, disabled := s.realSample, s.Disabled
+		c.validate(s)
+		if real && !disabled && s.Disabled && s.Name != "" {
+			c.invalid = append(c.invalid, s.Name)
+		}
 	}
 
 	// Clean up disabled and informational samples
 	samples := make([]*Sample, 0, len(c.Samples))
 	for i := 0; i < len(c.Samples); i++ {
-		if c.Samples[i].realSample && !c.Samples[i].Disabled {
+		// Transaction steps are kept, but disabled so they don't get their own timers
+		if c.Samples[i].realSample && c.Samples[i].inTransaction {
+			c.Samples[i].Disabled = true
+			samples = append(samples, c.Samples[i])
+		} else if c.Samples[i].realSample && !c.Samples[i].Disabled {
 			samples = append(samples, c.Samples[i])
 		}
 	}
@@ -374,7 +500,7 @@ func BuildConfig(cc ConfigConfig) *Config {
 	// Add support for the mix statements
 	if !cc.Export {
 		for _, m := range c.Mix {
-			cc := ConfigConfig{FullConfig: m.Sample, Export: false}
+			cc := ConfigConfig{FullConfig: m.Sample, Export: false, reloading: cc.reloading, mixed: true}
 			var nc *Config
 			acceptableExtensions := map[string]bool{".yml": true, ".yaml": true, ".json": true, ".sample": true, ".csv": true}
 			if _, ok := acceptableExtensions[filepath.Ext(m.Sample)]; ok {
@@ -382,7 +508,7 @@ func BuildConfig(cc ConfigConfig) *Config {
 				c.mergeMixConfig(nc, m)
 			} else {
 				PullFile(m.Sample, ".tmp.yml")
-				cc = ConfigConfig{FullConfig: ".tmp.yml"}
+				cc = ConfigConfig{FullConfig: ".tmp.yml", reloading: cc.reloading, mixed: true}
 				nc = BuildConfig(cc)
 				c.mergeMixConfig(nc, m)
 				os.Remove(".tmp.yml")
@@ -390,6 +516,19 @@ func BuildConfig(cc ConfigConfig) *Config {
 		}
 	}
 
+	// Scenarios can change samples from mixes too, so they're scheduled once all samples are in
+	if !cc.Export {
+		c.validateScenarios()
+	}
+
+	// Remember how samples and global were configured, so a reload can tell what's changed
+	if !cc.Export {
+		for _, s := range c.Samples {
+			s.fingerprint = c.fingerprint(s)
+		}
+		c.globalYAML, _ = yaml.Marshal(c.Global)
+	}
+
 	c.initialized = true
 	return c
 }
@@ -421,6 +560,16 @@ func (c *Config) mergeMixConfig(nc *Config, m *Mix) {
 	for i := range nc.Raters {
 		c.Raters = append(c.Raters, nc.Raters[i])
 	}
+	for i := range nc.Pools {
+		c.Pools = append(c.Pools, nc.Pools[i])
+	}
+	for i := range nc.Scenarios {
+		c.Scenarios = append(c.Scenarios, nc.Scenarios[i])
+	}
+	for i := range nc.LuaModules {
+		c.LuaModules = append(c.LuaModules, nc.LuaModules[i])
+	}
+	c.luaLibrary.merge(nc.luaLibrary)
 }
 
 func (c *Config) readSamplesDir(samplesDir string) {
@@ -511,6 +660,7 @@ func (c *Config) readSamplesDir(samplesDir string) {
 func (c *Config) validate(s *Sample) {
 	if s.realSample {
 		s.Buf = &c.Buf
+		s.LuaLibrary = c.luaLibrary
 		if s.Generator == "" {
 			s.Generator = defaultGenerator
 		}
@@ -525,8 +675,30 @@ func (c *Config) validate(s *Sample) {
 			s.realSample = true
 		}
 
-		// Put the output into the sample for convenience
-		s.Output = &c.Global.Output
+		// Put the output into the sample for convenience, a sample's own output overrides global settings
+		if s.OutputConfig != nil {
+			o := *s.OutputConfig
+			o.inherit(&c.Global.Output)
+			s.Output = &o
+		} else {
+			s.Output = &c.Global.Output
+		}
+		// Events are sent to each of the sample's outputs, or the global outputs if it doesn't set
+		// its own.  Output is always the first of them.
+		if len(s.OutputsConfig) > 0 {
+			s.Outputs = make([]*Output, 0, len(s.OutputsConfig))
+			for _, oc := range s.OutputsConfig {
+				o := *oc
+				o.inherit(s.Output)
+				s.Outputs = append(s.Outputs, &o)
+			}
+			nameOutputs(s.Outputs)
+		} else if s.OutputConfig == nil && len(c.Global.Outputs) > 0 {
+			s.Outputs = c.Global.Outputs
+		} else {
+			s.Outputs = []*Output{s.Output}
+		}
+		s.Output = s.Outputs[0]
 
 		// Setup defaults
 		if s.Earliest == "" {
@@ -616,9 +788,15 @@ func (c *Config) validate(s *Sample) {
 			}
 		}
 
-		if !c.cc.Export && c.Global.Output.OutputTemplate == "splunkhec" {
+		hec := false
+		for _, o := range s.Outputs {
+			if o.OutputTemplate == "splunkhec" || o.Outputter == "splunkhec" {
+				hec = true
+			}
+		}
+		if !c.cc.Export && hec {
 			// If there's no _time token, add it to make sure we have a timestamp field in every event
-			// This is primarily used for Splunk's HTTP Event Collectot
+			// This is primarily used for Splunk's HTTP Event Collector
 			timetoken := false
 			for _, t := range s.Tokens {
 				if t.Name == "_time" {
@@ -666,24 +844,9 @@ func (c *Config) validate(s *Sample) {
 		for i, t := range s.Tokens {
 			switch t.Type {
 			case "random", "rated":
-				if t.Replacement == "int" || t.Replacement == "float" {
-					if t.Lower > t.Upper {
-						log.Errorf("Lower cannot be greater than Upper for token '%s' in sample '%s', disabling Sample", t.Name, s.Name)
-						s.Disabled = true
-					} else if t.Upper == 0 {
-						log.Errorf("Upper cannot be zero for token '%s' in sample '%s', disabling Sample", t.Name, s.Name)
-						s.Disabled = true
-					}
-				} else if t.Replacement == "string" || t.Replacement == "hex" {
-					if t.Length == 0 {
-						log.Errorf("Length cannot be zero for token '%s' in sample '%s', disabling Sample", t.Name, s.Name)
-						s.Disabled = true
-					}
-				} else {
-					if t.Replacement != "guid" && t.Replacement != "ipv4" && t.Replacement != "ipv6" {
-						log.Errorf("Replacement '%s' is invalid for token '%s' in sample '%s'", t.Replacement, t.Name, s.Name)
-						s.Disabled = true
-					}
+				if err := s.Tokens[i].validateRandom(); err != nil {
+					log.Errorf("%s for token '%s' in sample '%s', disabling Sample", err, t.Name, s.Name)
+					s.Disabled = true
 				}
 			case "choice":
 				if len(t.Choice) == 0 || t.Choice == nil {
@@ -707,8 +870,51 @@ func (c *Config) validate(s *Sample) {
 						break
 					}
 				}
+			case "transaction":
+				if t.Replacement != "id" && t.Replacement != "name" && t.Replacement != "step" {
+					log.Errorf("Replacement '%s' is invalid for token '%s' in sample '%s', must be id, name or step", t.Replacement, t.Name, s.Name)
+					s.Disabled = true
+				}
+			case "entity":
+				if c.cc.Export {
+					break
+				}
+				p := c.FindPool(t.Pool)
+				if p == nil {
+					log.Errorf("Pool '%s' not found for token '%s' in sample '%s', disabling Sample", t.Pool, t.Name, s.Name)
+					s.Disabled = true
+				} else if !p.hasAttribute(t.Attribute) {
+					log.Errorf("Attribute '%s' not found in pool '%s' for token '%s' in sample '%s', disabling Sample", t.Attribute, t.Pool, t.Name, s.Name)
+					s.Disabled = true
+				} else {
+					s.Tokens[i].pool = p
+				}
+			case "fake":
+				if err := fake.Valid(t.Replacement, t.Locale); err != nil {
+					log.Errorf("%s for token '%s' in sample '%s', disabling Sample", err, t.Name, s.Name)
+					s.Disabled = true
+				}
+			case "sequence":
+				if t.Step == 0 {
+					t.Step = 1
+					s.Tokens[i].Step = 1
+				}
+				if t.Scope != "" && t.Scope != "token" && t.Scope != "sample" && t.Scope != "global" {
+					log.Errorf("Scope '%s' is invalid for token '%s' in sample '%s', disabling Sample", t.Scope, t.Name, s.Name)
+					s.Disabled = true
+				} else if t.End != 0 && ((t.Step > 0 && t.End < t.Start) || (t.Step < 0 && t.End > t.Start)) {
+					log.Errorf("End can never be reached from Start for token '%s' in sample '%s', disabling Sample", t.Name, s.Name)
+					s.Disabled = true
+				} else {
+					s.Tokens[i].seq = getSequence(sequenceKey(s, &t, i), &t)
+				}
 			case "script":
-				s.Tokens[i].mutex = &sync.Mutex{}
+				script, err := NewLuaScript(t.Name, t.Script, t.luaState, c.luaLibrary.Open)
+				if err != nil {
+					log.Errorf("Error compiling script for token '%s' in sample '%s', disabling Sample: %s", t.Name, s.Name, err)
+					s.Disabled = true
+				}
+				s.Tokens[i].script = script
 				for k, v := range t.Init {
 					vAsNum, err := strconv.ParseFloat(v, 64)
 					if err != nil {
@@ -869,6 +1075,8 @@ func (c *Config) validate(s *Sample) {
 				}
 				s.ReplayOffsets[0] = avgOffset
 			}
+		} else if s.Generator == "transaction" {
+			c.validateTransaction(s)
 		} else if s.Generator != "sample" {
 			for _, g := range c.Generators {
 				// TODO If not single threaded, we won't establish state in the sample object
@@ -894,6 +1102,7 @@ func (c *Config) validateRater(r *RaterConfig) {
 		"HourOfDay":    true,
 		"MinuteOfHour": true,
 		"DayOfWeek":    true,
+		"DayOfMonth":   true,
 	}
 
 	opt := make(map[string]interface{})
@@ -906,17 +1115,196 @@ func (c *Config) validateRater(r *RaterConfig) {
 				k2int := k2.(int)
 				v2float, ok := v2.(float64)
 				if !ok {
-					log.Fatalf("Rater value '%#v' of key '%s' for rater '%s' in '%s' is not an integer value", v2, k2, r.Name, k)
+					c.fatalf("Rater value '%#v' of key '%s' for rater '%s' in '%s' is not an integer value", v2, k2, r.Name, k)
 				}
 				newv[k2int] = v2float
 			}
 			newvset = newv
+		} else if raterFloatKeys[r.Type][k] {
+			f, ok := toFloat(v)
+			if !ok {
+				c.fatalf("Rater value '%#v' of key '%s' for rater '%s' is not a number", v, k, r.Name)
+			}
+			newvset = f
+		} else if k == "Points" && r.Type == "interpolated" {
+			newvset = c.raterPoints(r, v)
+		} else if k == "Raters" && r.Type == "composite" {
+			switch names := v.(type) {
+			case []interface{}:
+				newv := make([]string, 0, len(names))
+				for _, n := range names {
+					newv = append(newv, fmt.Sprint(n))
+				}
+				newvset = newv
+			case []string:
+				newvset = names
+			default:
+				c.fatalf("Raters for rater '%s' must be a list of rater names", r.Name)
+			}
 		} else {
 			newvset = v
 		}
 		opt[k] = newvset
 	}
 	r.Options = opt
+
+	switch r.Type {
+	case "interpolated":
+		if _, ok := r.Options["Points"]; !ok {
+			c.fatalf("Rater '%s' of type interpolated needs Points", r.Name)
+		}
+	case "sinusoidal":
+		if peak, ok := r.Options["Peak"]; ok {
+			if _, err := time.Parse("15:04", fmt.Sprint(peak)); err != nil {
+				c.fatalf("Peak '%v' for rater '%s' is not a time of day as HH:MM", peak, r.Name)
+			}
+		}
+		c.validateRaterDuration(r, "Period")
+	case "randomwalk":
+		c.validateRaterDuration(r, "Interval")
+	case "calendar":
+		c.validateCalendarRater(r)
+	case "burst":
+		for _, k := range []string{"BurstInterval", "BurstDuration", "OutageInterval", "OutageDuration"} {
+			c.validateRaterDuration(r, k)
+		}
+		_, bursts := r.Options["BurstInterval"]
+		_, outages := r.Options["OutageInterval"]
+		if !bursts && !outages {
+			c.fatalf("Rater '%s' of type burst needs a BurstInterval or an OutageInterval", r.Name)
+		}
+		min, hasMin := r.Options["BurstMagnitude"].(float64)
+		if hasMin && min < 0 {
+			c.fatalf("BurstMagnitude for rater '%s' must not be negative", r.Name)
+		}
+		if max, ok := r.Options["BurstMaxMagnitude"].(float64); ok && hasMin && max < min {
+			c.fatalf("BurstMaxMagnitude for rater '%s' must not be less than BurstMagnitude", r.Name)
+		}
+	case "composite":
+		if _, ok := r.Options["Raters"]; !ok {
+			c.fatalf("Rater '%s' of type composite needs Raters", r.Name)
+		}
+		if op, ok := r.Options["Operation"]; ok && op != "multiply" && op != "add" {
+			c.fatalf("Operation '%v' for rater '%s' must be multiply or add", op, r.Name)
+		}
+	}
+}
+
+// validateRaterDuration makes sure the option k of the rater, if set, is a positive duration
+func (c *Config) validateRaterDuration(r *RaterConfig, k string) {
+	if v, ok := r.Options[k]; ok {
+		d, err := time.ParseDuration(fmt.Sprint(v))
+		if err != nil || d <= 0 {
+			c.fatalf("%s '%v' for rater '%s' is not a positive duration", k, v, r.Name)
+		}
+	}
+}
+
+// validateCompositeRaters makes sure every rater a composite rater refers to exists and that no
+// composite rater ends up referring to itself
+func (c *Config) validateCompositeRaters() {
+	var visit func(r *RaterConfig, path []string)
+	visit = func(r *RaterConfig, path []string) {
+		for _, p := range path {
+			if p == r.Name {
+				c.fatalf("Composite rater '%s' refers to itself through '%s'", r.Name, strings.Join(append(path, r.Name), "' -> '"))
+			}
+		}
+		if r.Type != "composite" {
+			return
+		}
+		for _, name := range r.Options["Raters"].([]string) {
+			sub := c.FindRater(name)
+			if sub == nil {
+				c.fatalf("Rater '%s' for composite rater '%s' not found", name, r.Name)
+			}
+			visit(sub, append(path, r.Name))
+		}
+	}
+	for _, r := range c.Raters {
+		visit(r, nil)
+	}
+}
+
+// raterFloatKeys are the options which are numbers for each type of rater.  Other raters, like
+// script raters, take their options as they're set.
+var raterFloatKeys = map[string]map[string]bool{
+	"sinusoidal": {"Min": true, "Max": true},
+	"randomwalk": {"Min": true, "Max": true, "Mean": true, "StdDev": true, "Reversion": true},
+	"calendar":   {"HolidayRate": true},
+	"burst":      {"BurstMagnitude": true, "BurstMaxMagnitude": true},
+}
+
+// raterPoints converts the Points option of an interpolated rater, a map of times of day as HH:MM
+// to rates, so every time is a string HH:MM and every rate a float64
+func (c *Config) raterPoints(r *RaterConfig, v interface{}) map[string]float64 {
+	points := make(map[string]float64)
+	add := func(k interface{}, v interface{}) {
+		t, err := time.Parse("15:04", fmt.Sprint(k))
+		if err != nil {
+			c.fatalf("Point '%v' for rater '%s' is not a time of day as HH:MM", k, r.Name)
+		}
+		tod := t.Format("15:04")
+		f, ok := toFloat(v)
+		if !ok {
+			c.fatalf("Rate '%#v' for point '%v' of rater '%s' is not a number", v, k, r.Name)
+		}
+		points[tod] = f
+	}
+	switch vcast := v.(type) {
+	case map[interface{}]interface{}:
+		for k2, v2 := range vcast {
+			add(k2, v2)
+		}
+	case map[string]interface{}:
+		for k2, v2 := range vcast {
+			add(k2, v2)
+		}
+	case map[string]float64:
+		return vcast
+	default:
+		c.fatalf("Points for rater '%s' must be a map of times of day to rates", r.Name)
+	}
+	return points
+}
+
+// toFloat returns v as a float64 if it's a number
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// validateRandom checks a random or rated token has the settings its replacement needs
+func (t *Token) validateRandom() error {
+	switch t.Replacement {
+	case "int", "float":
+		if t.Lower > t.Upper {
+			return fmt.Errorf("Lower cannot be greater than Upper")
+		} else if t.Upper == 0 {
+			return fmt.Errorf("Upper cannot be zero")
+		}
+		if t.Distribution == "zipf" && t.Alpha > 1 {
+			t.zipf = newZipf(t.Alpha, uint64(t.Upper-t.Lower))
+		}
+		return t.validateDistribution()
+	case "string", "hex":
+		if t.Length == 0 {
+			return fmt.Errorf("Length cannot be zero")
+		}
+	case "ipv4", "ipv6":
+		return t.setupIP()
+	case "guid":
+	default:
+		return fmt.Errorf("Replacement '%s' is invalid", t.Replacement)
+	}
+	return nil
 }
 
 // Brings in a Generator script from a file
@@ -943,6 +1331,8 @@ func (c *Config) readGenerator(configDir string, g *GeneratorConfig) error {
 
 // FindRater returns a RaterConfig matched by the passed name
 func (c *Config) FindRater(name string) *RaterConfig {
+	c.ratersMutex.RLock()
+	defer c.ratersMutex.RUnlock()
 	for _, findr := range c.Raters {
 		if findr.Name == name {
 			return findr
@@ -951,6 +1341,15 @@ func (c *Config) FindRater(name string) *RaterConfig {
 	return nil
 }
 
+// ReloadRaters replaces the raters and Lua library with those of nc, while samples may be finding
+// raters as they run
+func (c *Config) ReloadRaters(nc *Config) {
+	c.ratersMutex.Lock()
+	defer c.ratersMutex.Unlock()
+	c.Raters = nc.Raters
+	c.luaLibrary = nc.luaLibrary
+}
+
 // ParseBeginEnd parses the Begin and End settings for a sample
 func ParseBeginEnd(s *Sample) {
 	// EndIntervals overrides begin and end
@@ -1073,7 +1472,7 @@ func (c *Config) parseWebConfig(out interface{}, url string) error {
 }
 
 // FindSampleByName finds and returns a pointer to a sample referenced by the passed name
-func (c Config) FindSampleByName(name string) *Sample {
+func (c *Config) FindSampleByName(name string) *Sample {
 	for i := 0; i < len(c.Samples); i++ {
 		if c.Samples[i].Name == name {
 			return c.Samples[i]
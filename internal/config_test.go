@@ -32,6 +32,12 @@ func TestGlobal(t *testing.T) {
 		MaxBytes:       10485760,
 		BackupFiles:    5,
 		BufferBytes:    102400,
+		Timeout:        "30s",
+		Retries:        3,
+		RetryBackoff:   "1s",
+		MaxBackoff:     "30s",
+		AckTimeout:     "60s",
+		AckInterval:    "1s",
 		Endpoints:      []string(nil),
 		Headers:        map[string]string(nil),
 	}
@@ -41,6 +47,7 @@ func TestGlobal(t *testing.T) {
 		GeneratorWorkers: 1,
 		OutputWorkers:    1,
 		ROTInterval:      1,
+		DrainTimeout:     "30s",
 		Output:           output,
 		SamplesDir:       []string(nil),
 	}
@@ -130,6 +137,11 @@ func TestValidate(t *testing.T) {
 		"validate-badrandom",
 		"validate-earliest-latest",
 		"validate-nolines",
+		"validate-distribution",
+		"validate-fake",
+		"validate-entity",
+		"validate-transaction",
+		"validate-script",
 	}
 	for _, v := range checks {
 		s = FindSampleInFile(home, v)
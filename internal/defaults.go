@@ -12,6 +12,7 @@ const defaultOutputWorkers = 1
 const defaultROTInterval = 1
 const defaultOutputter = "stdout"
 const defaultOutputTemplate = "raw"
+const defaultDrainTimeout = "30s"
 
 // Default Sample values
 const defaultGenerator = "sample"
@@ -27,6 +28,14 @@ const defaultBackupFiles = 5
 
 // Default HTTP output values
 const defaultBufferBytes = 102400
+const defaultTimeout = "30s"
+const defaultRetries = 3
+const defaultRetryBackoff = "1s"
+const defaultMaxBackoff = "30s"
+
+// Default Splunk HEC output values
+const defaultAckTimeout = "60s"
+const defaultAckInterval = "1s"
 
 // MaxOutputThreads defines how large an array we'll define for output threads
 const MaxOutputThreads = 100
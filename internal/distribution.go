@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// distributions are the ways random and rated numeric tokens can draw their values
+var distributions = map[string]bool{"uniform": true, "normal": true, "lognormal": true, "exponential": true, "poisson": true, "pareto": true, "zipf": true}
+
+// usesDistribution returns true if the token draws from a distribution other than uniform
+func (t Token) usesDistribution() bool {
+	return t.Distribution != "" && t.Distribution != "uniform"
+}
+
+// distributed draws a value from the token's distribution, clamped to Lower and Upper:
+//
+//	normal       mean and stddev
+//	lognormal    mean and stddev of the value's natural logarithm
+//	exponential  mean
+//	poisson      mean
+//	pareto       alpha as the shape, with lower (or 1 if lower isn't positive) as the scale
+//	zipf         alpha as the exponent, with lower being the most likely value
+func (t Token) distributed(randgen *rand.Rand) float64 {
+	var f float64
+	switch t.Distribution {
+	case "normal":
+		f = randgen.NormFloat64()*t.StdDev + t.Mean
+	case "lognormal":
+		f = math.Exp(randgen.NormFloat64()*t.StdDev + t.Mean)
+	case "exponential":
+		f = randgen.ExpFloat64() * t.Mean
+	case "poisson":
+		f = float64(poisson(randgen, t.Mean))
+	case "pareto":
+		scale := float64(t.Lower)
+		if scale <= 0 {
+			scale = 1
+		}
+		f = scale / math.Pow(1-randgen.Float64(), 1/t.Alpha)
+	case "zipf":
+		z := t.zipf
+		if z == nil {
+			z = newZipf(t.Alpha, uint64(t.Upper-t.Lower))
+		}
+		f = float64(t.Lower) + float64(z.draw(randgen))
+	}
+	return math.Max(float64(t.Lower), math.Min(float64(t.Upper), f))
+}
+
+// poisson draws from a poisson distribution with the given mean, using Knuth's method for small
+// means and a normal approximation for large ones
+func poisson(randgen *rand.Rand, mean float64) int {
+	if mean > 30 {
+		return int(math.Max(0, math.Floor(randgen.NormFloat64()*math.Sqrt(mean)+mean+0.5)))
+	}
+	l := math.Exp(-mean)
+	k := 0
+	for p := randgen.Float64(); p > l; p *= randgen.Float64() {
+		k++
+	}
+	return k
+}
+
+// zipf draws from a zipf distribution over 0 to imax with exponent q, like rand.Zipf with v of 1,
+// but from whichever generator it's given.  It's built once for each token or pool rather than
+// for every draw, as a rand.Zipf would need to be to draw from each interval's generator.
+type zipf struct {
+	imax, q, s              float64
+	oneminusQ, oneminusQinv float64
+	hxm, hx0minusHxm        float64
+}
+
+func newZipf(q float64, imax uint64) *zipf {
+	z := &zipf{imax: float64(imax), q: q, oneminusQ: 1.0 - q}
+	z.oneminusQinv = 1.0 / z.oneminusQ
+	z.hxm = z.h(z.imax + 0.5)
+	z.hx0minusHxm = z.h(0.5) - math.Exp(math.Log(1.0)*(-z.q)) - z.hxm
+	z.s = 1 - z.hinv(z.h(1.5)-math.Exp(-z.q*math.Log(1.0+1.0)))
+	return z
+}
+
+func (z *zipf) h(x float64) float64 {
+	return math.Exp(z.oneminusQ*math.Log(1.0+x)) * z.oneminusQinv
+}
+
+func (z *zipf) hinv(x float64) float64 {
+	return math.Exp(z.oneminusQinv*math.Log(z.oneminusQ*x)) - 1.0
+}
+
+// draw returns a value using rejection inversion, the same as rand.Zipf
+func (z *zipf) draw(randgen *rand.Rand) uint64 {
+	k := 0.0
+	for {
+		r := randgen.Float64()
+		ur := z.hxm + r*z.hx0minusHxm
+		x := z.hinv(ur)
+		k = math.Floor(x + 0.5)
+		if k-x <= z.s {
+			break
+		}
+		if ur >= z.h(k+0.5)-math.Exp(-math.Log(k+1.0)*z.q) {
+			break
+		}
+	}
+	return uint64(k)
+}
+
+// validateDistribution returns an error if the token's distribution is unknown or missing its parameters
+func (t Token) validateDistribution() error {
+	if t.Distribution == "" {
+		return nil
+	}
+	if !distributions[t.Distribution] {
+		return fmt.Errorf("Distribution '%s' is invalid", t.Distribution)
+	}
+	switch t.Distribution {
+	case "normal", "lognormal":
+		if t.StdDev <= 0 {
+			return fmt.Errorf("StdDev must be greater than zero for distribution '%s'", t.Distribution)
+		}
+	case "exponential", "poisson":
+		if t.Mean <= 0 {
+			return fmt.Errorf("Mean must be greater than zero for distribution '%s'", t.Distribution)
+		}
+	case "pareto":
+		if t.Alpha <= 0 {
+			return fmt.Errorf("Alpha must be greater than zero for distribution '%s'", t.Distribution)
+		}
+	case "zipf":
+		if t.Alpha <= 1 {
+			return fmt.Errorf("Alpha must be greater than one for distribution '%s'", t.Distribution)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistributions(t *testing.T) {
+	randgen := rand.New(rand.NewSource(0))
+	tests := []struct {
+		token Token
+		mean  float64
+	}{
+		{Token{Distribution: "normal", Mean: 200, StdDev: 20, Lower: 0, Upper: 1000}, 200},
+		{Token{Distribution: "lognormal", Mean: 3, StdDev: 0.5, Lower: 0, Upper: 10000}, math.Exp(3 + 0.5*0.5/2)},
+		{Token{Distribution: "exponential", Mean: 50, Lower: 0, Upper: 100000}, 50},
+		{Token{Distribution: "poisson", Mean: 4, Lower: 0, Upper: 1000}, 4},
+		{Token{Distribution: "poisson", Mean: 100, Lower: 0, Upper: 1000}, 100},
+		{Token{Distribution: "pareto", Alpha: 3, Lower: 10, Upper: 100000}, 15},
+	}
+	for _, test := range tests {
+		assert.NoError(t, test.token.validateDistribution())
+		var total float64
+		for i := 0; i < 10000; i++ {
+			f := test.token.distributed(randgen)
+			assert.True(t, f >= float64(test.token.Lower) && f <= float64(test.token.Upper))
+			total += f
+		}
+		assert.InEpsilon(t, test.mean, total/10000, 0.05, "Mean of %s", test.token.Distribution)
+	}
+
+	// Zipf makes lower the most likely value
+	zipf := Token{Distribution: "zipf", Alpha: 2, Lower: 1, Upper: 100}
+	counts := make(map[float64]int)
+	for i := 0; i < 10000; i++ {
+		counts[zipf.distributed(randgen)]++
+	}
+	assert.True(t, counts[1] > counts[2] && counts[2] > counts[3])
+}
+
+func TestZipf(t *testing.T) {
+	// Draws the same values as rand.Zipf from the same generator, without building one each time
+	z := newZipf(1.5, 1000)
+	ours := rand.New(rand.NewSource(7))
+	theirs := rand.New(rand.NewSource(7))
+	expected := rand.NewZipf(theirs, 1.5, 1, 1000)
+	for i := 0; i < 1000; i++ {
+		assert.Equal(t, expected.Uint64(), z.draw(ours))
+	}
+}
+
+func TestDistributionClamp(t *testing.T) {
+	randgen := rand.New(rand.NewSource(0))
+	now := time.Now()
+	token := Token{Type: "random", Replacement: "int", Distribution: "normal", Mean: 100, StdDev: 1000, Lower: 90, Upper: 110}
+	for i := 0; i < 1000; i++ {
+		r, _, err := token.GenReplacement(-1, now, now, now, randgen)
+		assert.NoError(t, err)
+		v, _ := strconv.Atoi(r)
+		assert.True(t, v >= 90 && v <= 110)
+	}
+}
+
+func TestValidateDistribution(t *testing.T) {
+	assert.Error(t, Token{Distribution: "bogus"}.validateDistribution())
+	assert.Error(t, Token{Distribution: "normal"}.validateDistribution())
+	assert.Error(t, Token{Distribution: "poisson"}.validateDistribution())
+	assert.Error(t, Token{Distribution: "zipf", Alpha: 1}.validateDistribution())
+	assert.NoError(t, Token{Distribution: "uniform"}.validateDistribution())
+}
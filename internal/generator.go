@@ -28,6 +28,8 @@ type GenQueueItem struct {
 	Now      time.Time
 	OQ       chan *OutQueueItem
 	Rand     *rand.Rand
+	// Transaction is set when generating a step of a transaction
+	Transaction *TransactionContext
 }
 
 // Generator will generate count events from earliest to latest time and put them
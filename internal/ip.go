@@ -0,0 +1,223 @@
+package internal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// maxIPAttempts is how many addresses we'll draw looking for one which isn't excluded before
+// settling for the last one
+const maxIPAttempts = 100
+
+// WeightedCIDR is a network for ipv4 and ipv6 tokens to generate addresses in, picked by Weight
+type WeightedCIDR struct {
+	CIDR   string `json:"cidr" yaml:"cidr"`
+	Weight int    `json:"weight,omitempty" yaml:"weight,omitempty"`
+}
+
+// ipConfig is the parsed network config for an ipv4 or ipv6 token
+type ipConfig struct {
+	nets    []*net.IPNet
+	totals  []int
+	total   int
+	mutex   sync.Mutex
+	sticky  map[int]string
+	private []*net.IPNet
+}
+
+var (
+	privateIPv4  = parseCIDRs("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16")
+	privateIPv6  = parseCIDRs("fc00::/7")
+	reservedIPv4 = parseCIDRs("0.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "192.0.0.0/24", "192.0.2.0/24",
+		"192.88.99.0/24", "198.18.0.0/15", "198.51.100.0/24", "203.0.113.0/24", "224.0.0.0/4", "240.0.0.0/4")
+	reservedIPv6 = parseCIDRs("::/128", "::1/128", "::ffff:0:0/96", "64:ff9b::/96", "100::/64", "2001:db8::/32", "fe80::/10", "ff00::/8")
+	// publicIPv6 is global unicast space, everything else in IPv6 is reserved or unassigned
+	publicIPv6 = parseCIDRs("2000::/3")
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	ret := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// setupIP parses the token's CIDRs and address space for generating ipv4 or ipv6 addresses
+func (t *Token) setupIP() error {
+	if len(t.CIDRs) == 0 && t.AddressSpace == "" && !t.ExcludeReserved && !t.Sticky {
+		return nil
+	}
+	if t.Sticky && t.Group <= 0 {
+		return fmt.Errorf("Sticky %s tokens must be in a group with a choice token", t.Replacement)
+	}
+	if t.AddressSpace == "private" && len(t.CIDRs) > 0 {
+		return fmt.Errorf("Address space 'private' cannot be set with CIDRs")
+	}
+	ic := &ipConfig{sticky: make(map[int]string)}
+	v6 := t.Replacement == "ipv6"
+	switch t.AddressSpace {
+	case "", "public":
+		if !v6 {
+			ic.nets = parseCIDRs("0.0.0.0/0")
+		} else if t.AddressSpace == "public" {
+			ic.nets = publicIPv6
+		} else {
+			ic.nets = parseCIDRs("::/0")
+		}
+	case "private":
+		if v6 {
+			ic.nets = privateIPv6
+		} else {
+			ic.nets = privateIPv4
+		}
+	default:
+		return fmt.Errorf("Address space '%s' is invalid, must be private or public", t.AddressSpace)
+	}
+	ic.private = privateIPv4
+	if v6 {
+		ic.private = privateIPv6
+	}
+	if len(t.CIDRs) > 0 {
+		ic.nets = nil
+		for _, wc := range t.CIDRs {
+			_, n, err := net.ParseCIDR(wc.CIDR)
+			if err != nil {
+				return fmt.Errorf("Invalid CIDR '%s'", wc.CIDR)
+			}
+			if (n.IP.To4() == nil) != v6 {
+				return fmt.Errorf("CIDR '%s' is the wrong address family for %s", wc.CIDR, t.Replacement)
+			}
+			if wc.Weight < 0 {
+				return fmt.Errorf("Weight for CIDR '%s' cannot be negative", wc.CIDR)
+			}
+			ic.nets = append(ic.nets, n)
+			weight := wc.Weight
+			if weight == 0 {
+				weight = 1
+			}
+			ic.total += weight
+			ic.totals = append(ic.totals, ic.total)
+		}
+	} else {
+		// Pick networks by their size so addresses are spread evenly over the whole space
+		for _, n := range ic.nets {
+			ones, bits := n.Mask.Size()
+			size := bits - ones
+			if size > 30 {
+				size = 30
+			}
+			weight := 1 << uint(size)
+			ic.total += weight
+			ic.totals = append(ic.totals, ic.total)
+		}
+	}
+	t.ip = ic
+	return nil
+}
+
+// genIP generates an address for an ipv4 or ipv6 token.  Sticky tokens grouped with a choice
+// token always generate the same address for the same choice, so an entity keeps its IP.
+func (t Token) genIP(choice int, randgen *rand.Rand) (string, int) {
+	if t.ip == nil {
+		return t.randomIP(randgen), -1
+	}
+	if t.Sticky && choice >= 0 {
+		t.ip.mutex.Lock()
+		defer t.ip.mutex.Unlock()
+		if ip, ok := t.ip.sticky[choice]; ok {
+			return ip, choice
+		}
+		ip := t.networkIP(randgen)
+		t.ip.sticky[choice] = ip
+		return ip, choice
+	}
+	return t.networkIP(randgen), choice
+}
+
+// randomIP returns an address from anywhere in the token's address family
+func (t Token) randomIP(randgen *rand.Rand) string {
+	if t.Replacement == "ipv6" {
+		ip := make(net.IP, net.IPv6len)
+		for i := 0; i < 8; i++ {
+			ri := randgen.Intn(65536)
+			ip[i*2], ip[i*2+1] = byte(ri>>8), byte(ri)
+		}
+		return ip.String()
+	}
+	var ret string
+	for i := 0; i < 4; i++ {
+		ret += strconv.Itoa(randgen.Intn(256))
+		if i < 3 {
+			ret += "."
+		}
+	}
+	return ret
+}
+
+// networkIP returns an address from one of the token's networks, skipping excluded addresses
+func (t Token) networkIP(randgen *rand.Rand) string {
+	ic := t.ip
+	var ip net.IP
+	for attempt := 0; attempt < maxIPAttempts; attempt++ {
+		r := randgen.Intn(ic.total)
+		var n *net.IPNet
+		for i, total := range ic.totals {
+			if r < total {
+				n = ic.nets[i]
+				break
+			}
+		}
+		ip = make(net.IP, len(n.IP))
+		randgen.Read(ip)
+		for i := range ip {
+			ip[i] = n.IP[i] | (ip[i] &^ n.Mask[i])
+		}
+		if !t.excluded(n, ip) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+// excluded returns true if ip shouldn't be generated from network n
+func (t Token) excluded(n *net.IPNet, ip net.IP) bool {
+	reserved := reservedIPv4
+	if t.Replacement == "ipv6" {
+		reserved = reservedIPv6
+	}
+	if t.AddressSpace == "public" && (contains(t.ip.private, ip) || contains(reserved, ip)) {
+		return true
+	}
+	if t.ExcludeReserved {
+		if contains(reserved, ip) {
+			return true
+		}
+		// Network and broadcast addresses of IPv4 networks with room for hosts
+		if ones, bits := n.Mask.Size(); bits == 32 && bits-ones > 1 {
+			hostmask := ^binary.BigEndian.Uint32(n.Mask)
+			host := binary.BigEndian.Uint32(ip.To4()) & hostmask
+			if host == 0 || host == hostmask {
+				return true
+			}
+		}
+	}
+	return false
+}
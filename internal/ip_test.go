@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func genIPs(t *testing.T, token *Token, n int, choice int) []net.IP {
+	assert.NoError(t, token.setupIP())
+	randgen := rand.New(rand.NewSource(0))
+	now := time.Now()
+	ret := make([]net.IP, 0, n)
+	for i := 0; i < n; i++ {
+		r, _, err := token.GenReplacement(choice, now, now, now, randgen)
+		assert.NoError(t, err)
+		ip := net.ParseIP(r)
+		assert.NotNil(t, ip, r)
+		ret = append(ret, ip)
+	}
+	return ret
+}
+
+func TestIPCIDRs(t *testing.T) {
+	token := Token{Type: "random", Replacement: "ipv4", CIDRs: []WeightedCIDR{{CIDR: "10.1.0.0/16", Weight: 3}, {CIDR: "203.0.113.0/24", Weight: 1}}}
+	_, internal, _ := net.ParseCIDR("10.1.0.0/16")
+	_, external, _ := net.ParseCIDR("203.0.113.0/24")
+	var in, ex int
+	for _, ip := range genIPs(t, &token, 4000, -1) {
+		if internal.Contains(ip) {
+			in++
+		} else if external.Contains(ip) {
+			ex++
+		} else {
+			t.Fatalf("%s not in any CIDR", ip)
+		}
+	}
+	assert.InEpsilon(t, 3, float64(in)/float64(ex), 0.15)
+}
+
+func TestIPExcludeReserved(t *testing.T) {
+	token := Token{Type: "random", Replacement: "ipv4", CIDRs: []WeightedCIDR{{CIDR: "192.168.1.0/30"}}, ExcludeReserved: true}
+	for _, ip := range genIPs(t, &token, 100, -1) {
+		assert.NotEqual(t, "192.168.1.0", ip.String())
+		assert.NotEqual(t, "192.168.1.3", ip.String())
+	}
+
+	token = Token{Type: "random", Replacement: "ipv4", ExcludeReserved: true}
+	for _, ip := range genIPs(t, &token, 1000, -1) {
+		assert.False(t, ip.IsMulticast() || ip.IsLoopback() || ip[12] >= 240, ip.String())
+	}
+}
+
+func TestIPAddressSpace(t *testing.T) {
+	token := Token{Type: "random", Replacement: "ipv4", AddressSpace: "private"}
+	for _, ip := range genIPs(t, &token, 1000, -1) {
+		assert.True(t, contains(privateIPv4, ip), ip.String())
+	}
+	token = Token{Type: "random", Replacement: "ipv4", AddressSpace: "public"}
+	for _, ip := range genIPs(t, &token, 1000, -1) {
+		assert.False(t, contains(privateIPv4, ip) || contains(reservedIPv4, ip), ip.String())
+	}
+	token = Token{Type: "random", Replacement: "ipv6", AddressSpace: "private"}
+	for _, ip := range genIPs(t, &token, 100, -1) {
+		assert.True(t, contains(privateIPv6, ip), ip.String())
+	}
+}
+
+func TestIPv6Canonical(t *testing.T) {
+	token := Token{Type: "random", Replacement: "ipv6", CIDRs: []WeightedCIDR{{CIDR: "2001:db8::/120"}}}
+	randgen := rand.New(rand.NewSource(0))
+	assert.NoError(t, token.setupIP())
+	r, _ := token.genIP(-1, randgen)
+	assert.Regexp(t, `^2001:db8::[0-9a-f]{1,2}$`, r)
+}
+
+func TestIPSticky(t *testing.T) {
+	token := Token{Type: "random", Replacement: "ipv4", AddressSpace: "public", Sticky: true, Group: 1}
+	first := genIPs(t, &token, 10, 3)
+	for _, ip := range first {
+		assert.Equal(t, first[0], ip)
+	}
+	randgen := rand.New(rand.NewSource(1))
+	other, choice := token.genIP(4, randgen)
+	assert.NotEqual(t, first[0].String(), other)
+	assert.Equal(t, 4, choice)
+}
+
+func TestIPValidation(t *testing.T) {
+	assert.Error(t, (&Token{Replacement: "ipv4", CIDRs: []WeightedCIDR{{CIDR: "bogus"}}}).setupIP())
+	assert.Error(t, (&Token{Replacement: "ipv4", CIDRs: []WeightedCIDR{{CIDR: "fc00::/7"}}}).setupIP())
+	assert.Error(t, (&Token{Replacement: "ipv6", CIDRs: []WeightedCIDR{{CIDR: "10.0.0.0/8"}}}).setupIP())
+	assert.Error(t, (&Token{Replacement: "ipv4", AddressSpace: "somewhere"}).setupIP())
+	assert.Error(t, (&Token{Replacement: "ipv4", Sticky: true}).setupIP())
+	assert.Error(t, (&Token{Replacement: "ipv4", AddressSpace: "private", CIDRs: []WeightedCIDR{{CIDR: "10.0.0.0/8"}}}).setupIP())
+}
@@ -0,0 +1,377 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	strftime "github.com/cactus/gostrftime"
+	"github.com/pbnjay/strptime"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// luaRandKey is where SetLuaRandom keeps the generator in a Lua state's registry, so gogen's modules
+// draw from the same seeded generator as math.random
+const luaRandKey = "gogen.rand"
+
+// maxLuaJSONDepth stops encoding tables which contain themselves
+const maxLuaJSONDepth = 100
+
+// luaStdlib is the modules gogen ships for every generator, rater and script token to require
+var luaStdlib = map[string]lua.LGFunction{
+	"gogen.json":    luaModuleLoader(luaJSONFuncs),
+	"gogen.time":    luaModuleLoader(luaTimeFuncs),
+	"gogen.strings": luaModuleLoader(luaStringsFuncs),
+	"gogen.random":  luaModuleLoader(luaRandomFuncs),
+	"gogen.ip":      luaModuleLoader(luaIPFuncs),
+}
+
+var (
+	luaJSONFuncs = map[string]lua.LGFunction{
+		"encode": luaJSONEncode,
+		"decode": luaJSONDecode,
+	}
+	luaTimeFuncs = map[string]lua.LGFunction{
+		"strftime": luaStrftime,
+		"strptime": luaStrptime,
+	}
+	luaStringsFuncs = map[string]lua.LGFunction{
+		"split":      luaSplit,
+		"join":       luaJoin,
+		"trim":       luaTrim,
+		"startsWith": luaStartsWith,
+		"endsWith":   luaEndsWith,
+	}
+	luaRandomFuncs = map[string]lua.LGFunction{
+		"pick":     luaPick,
+		"weighted": luaWeighted,
+		"shuffle":  luaShuffle,
+	}
+	luaIPFuncs = map[string]lua.LGFunction{
+		"random":     luaRandomIP,
+		"contains":   luaIPContains,
+		"isPrivate":  luaIsPrivateIP,
+		"isReserved": luaIsReservedIP,
+	}
+)
+
+func luaModuleLoader(funcs map[string]lua.LGFunction) lua.LGFunction {
+	return func(L *lua.LState) int {
+		L.Push(L.SetFuncs(L.NewTable(), funcs))
+		return 1
+	}
+}
+
+// luaRand returns the generator math.random draws from in L, or a clock seeded one if the state
+// hasn't had one set
+func luaRand(L *lua.LState) *rand.Rand {
+	if ud, ok := L.G.Registry.RawGetString(luaRandKey).(*lua.LUserData); ok {
+		if randgen, ok := ud.Value.(*rand.Rand); ok {
+			return randgen
+		}
+	}
+	return rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
+// luaJSONEncode encodes a Lua value as JSON.  Tables with keys 1 to n are arrays, other tables
+// including empty ones are objects.
+func luaJSONEncode(L *lua.LState) int {
+	v, err := fromLua(L.CheckAny(1), 0)
+	if err == nil {
+		var b []byte
+		if b, err = json.Marshal(v); err == nil {
+			L.Push(lua.LString(b))
+			return 1
+		}
+	}
+	L.Push(lua.LNil)
+	L.Push(lua.LString(err.Error()))
+	return 2
+}
+
+// luaJSONDecode decodes JSON into Lua values, nulls in objects and arrays are lost
+func luaJSONDecode(L *lua.LState) int {
+	var v interface{}
+	if err := json.Unmarshal([]byte(L.CheckString(1)), &v); err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(toLua(L, v))
+	return 1
+}
+
+func fromLua(lv lua.LValue, depth int) (interface{}, error) {
+	if depth > maxLuaJSONDepth {
+		return nil, fmt.Errorf("Table nested too deeply to encode as JSON")
+	}
+	switch v := lv.(type) {
+	case *lua.LNilType:
+		return nil, nil
+	case lua.LBool:
+		return bool(v), nil
+	case lua.LNumber:
+		// Integers encode without an exponent
+		if f := float64(v); f == math.Trunc(f) && math.Abs(f) < 1e15 {
+			return int64(f), nil
+		}
+		return float64(v), nil
+	case lua.LString:
+		return string(v), nil
+	case *lua.LUserData:
+		return v.Value, nil
+	case *lua.LTable:
+		var err error
+		if n := v.Len(); n > 0 && n == countKeys(v) {
+			arr := make([]interface{}, 0, n)
+			for i := 1; i <= n && err == nil; i++ {
+				var item interface{}
+				item, err = fromLua(v.RawGetInt(i), depth+1)
+				arr = append(arr, item)
+			}
+			return arr, err
+		}
+		obj := make(map[string]interface{})
+		v.ForEach(func(k, item lua.LValue) {
+			if err == nil {
+				obj[lua.LVAsString(k)], err = fromLua(item, depth+1)
+			}
+		})
+		return obj, err
+	}
+	return nil, fmt.Errorf("Cannot encode %s as JSON", lv.Type())
+}
+
+func countKeys(t *lua.LTable) int {
+	n := 0
+	t.ForEach(func(_, _ lua.LValue) { n++ })
+	return n
+}
+
+func toLua(L *lua.LState, v interface{}) lua.LValue {
+	switch v := v.(type) {
+	case bool:
+		return lua.LBool(v)
+	case float64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case []interface{}:
+		t := L.CreateTable(len(v), 0)
+		for _, item := range v {
+			t.Append(toLua(L, item))
+		}
+		return t
+	case map[string]interface{}:
+		t := L.CreateTable(0, len(v))
+		for k, item := range v {
+			t.RawSetString(k, toLua(L, item))
+		}
+		return t
+	}
+	return lua.LNil
+}
+
+// luaTime returns argument n as a time, either epoch seconds or a time from gogen like now, or the
+// current time if it's missing
+func luaTime(L *lua.LState, n int) time.Time {
+	switch v := L.Get(n).(type) {
+	case *lua.LNilType:
+		return time.Now()
+	case lua.LNumber:
+		sec, frac := math.Modf(float64(v))
+		return time.Unix(int64(sec), int64(frac*1e9))
+	case *lua.LUserData:
+		if t, ok := v.Value.(time.Time); ok {
+			return t
+		}
+	}
+	L.ArgError(n, "expected epoch seconds or a time")
+	return time.Time{}
+}
+
+// luaStrftime formats a time with a strftime format
+func luaStrftime(L *lua.LState) int {
+	format := L.CheckString(1)
+	L.Push(lua.LString(strftime.Format(format, luaTime(L, 2))))
+	return 1
+}
+
+// luaStrptime parses value with a strptime format, returning epoch seconds
+func luaStrptime(L *lua.LState) int {
+	t, err := strptime.Parse(L.CheckString(2), L.CheckString(1))
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(lua.LNumber(float64(t.UnixNano()) / 1e9))
+	return 1
+}
+
+// luaSplit splits a string on a plain separator, not a Lua pattern, into at most n parts if n is given
+func luaSplit(L *lua.LState) int {
+	parts := strings.SplitN(L.CheckString(1), L.CheckString(2), L.OptInt(3, -1))
+	t := L.CreateTable(len(parts), 0)
+	for _, part := range parts {
+		t.Append(lua.LString(part))
+	}
+	L.Push(t)
+	return 1
+}
+
+// luaJoin joins the items of an array with a separator
+func luaJoin(L *lua.LState) int {
+	t := L.CheckTable(1)
+	sep := L.OptString(2, "")
+	parts := make([]string, 0, t.Len())
+	for i := 1; i <= t.Len(); i++ {
+		parts = append(parts, lua.LVAsString(t.RawGetInt(i)))
+	}
+	L.Push(lua.LString(strings.Join(parts, sep)))
+	return 1
+}
+
+// luaTrim trims whitespace, or the characters in cutset if given, from both ends of a string
+func luaTrim(L *lua.LState) int {
+	s := L.CheckString(1)
+	if L.GetTop() > 1 {
+		L.Push(lua.LString(strings.Trim(s, L.CheckString(2))))
+	} else {
+		L.Push(lua.LString(strings.TrimSpace(s)))
+	}
+	return 1
+}
+
+func luaStartsWith(L *lua.LState) int {
+	L.Push(lua.LBool(strings.HasPrefix(L.CheckString(1), L.CheckString(2))))
+	return 1
+}
+
+func luaEndsWith(L *lua.LState) int {
+	L.Push(lua.LBool(strings.HasSuffix(L.CheckString(1), L.CheckString(2))))
+	return 1
+}
+
+// luaPick returns a random item of an array
+func luaPick(L *lua.LState) int {
+	t := L.CheckTable(1)
+	if t.Len() == 0 {
+		L.ArgError(1, "array is empty")
+	}
+	L.Push(t.RawGetInt(luaRand(L).Intn(t.Len()) + 1))
+	return 1
+}
+
+// luaWeighted returns a random choice, picked by weight.  Choices are either an array of tables
+// with choice and weight, like a weightedChoice token, or a table of choices to weights.
+func luaWeighted(L *lua.LState) int {
+	t := L.CheckTable(1)
+	var choices []lua.LValue
+	var weights []float64
+	if t.Len() > 0 {
+		for i := 1; i <= t.Len(); i++ {
+			wc, ok := t.RawGetInt(i).(*lua.LTable)
+			if !ok {
+				L.ArgError(1, "expected tables of choice and weight")
+			}
+			choices = append(choices, wc.RawGetString("choice"))
+			weights = append(weights, float64(lua.LVAsNumber(wc.RawGetString("weight"))))
+		}
+	} else {
+		t.ForEach(func(k, v lua.LValue) {
+			choices = append(choices, k)
+		})
+		// Table order isn't fixed, so sort choices for the same pick from the same seed
+		sort.Slice(choices, func(i, j int) bool { return lua.LVAsString(choices[i]) < lua.LVAsString(choices[j]) })
+		for _, choice := range choices {
+			weights = append(weights, float64(lua.LVAsNumber(t.RawGet(choice))))
+		}
+	}
+	var total float64
+	for _, w := range weights {
+		if w < 0 {
+			L.ArgError(1, "weights cannot be negative")
+		}
+		total += w
+	}
+	if total <= 0 {
+		L.ArgError(1, "no choices with any weight")
+	}
+	r := luaRand(L).Float64() * total
+	for i, w := range weights {
+		if r < w {
+			L.Push(choices[i])
+			return 1
+		}
+		r -= w
+	}
+	L.Push(choices[len(choices)-1])
+	return 1
+}
+
+// luaShuffle shuffles an array in place and returns it
+func luaShuffle(L *lua.LState) int {
+	t := L.CheckTable(1)
+	luaRand(L).Shuffle(t.Len(), func(i, j int) {
+		vi, vj := t.RawGetInt(i+1), t.RawGetInt(j+1)
+		t.RawSetInt(i+1, vj)
+		t.RawSetInt(j+1, vi)
+	})
+	L.Push(t)
+	return 1
+}
+
+// luaRandomIP returns a random address in a CIDR
+func luaRandomIP(L *lua.LState) int {
+	_, n, err := net.ParseCIDR(L.CheckString(1))
+	if err != nil {
+		L.ArgError(1, err.Error())
+	}
+	ip := make(net.IP, len(n.IP))
+	luaRand(L).Read(ip)
+	for i := range ip {
+		ip[i] = n.IP[i] | (ip[i] &^ n.Mask[i])
+	}
+	L.Push(lua.LString(ip.String()))
+	return 1
+}
+
+func luaCheckIP(L *lua.LState, n int) net.IP {
+	ip := net.ParseIP(L.CheckString(n))
+	if ip == nil {
+		L.ArgError(n, "not an IP address")
+	}
+	return ip
+}
+
+// luaIPContains returns whether a CIDR contains an address
+func luaIPContains(L *lua.LState) int {
+	_, n, err := net.ParseCIDR(L.CheckString(1))
+	if err != nil {
+		L.ArgError(1, err.Error())
+	}
+	L.Push(lua.LBool(n.Contains(luaCheckIP(L, 2))))
+	return 1
+}
+
+func luaIsPrivateIP(L *lua.LState) int {
+	ip := luaCheckIP(L, 1)
+	L.Push(lua.LBool(contains(privateIPv4, ip) || contains(privateIPv6, ip)))
+	return 1
+}
+
+func luaIsReservedIP(L *lua.LState) int {
+	ip := luaCheckIP(L, 1)
+	if ip.To4() != nil {
+		L.Push(lua.LBool(contains(reservedIPv4, ip)))
+	} else {
+		L.Push(lua.LBool(contains(reservedIPv6, ip)))
+	}
+	return 1
+}
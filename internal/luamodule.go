@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/coccyx/gogen/logger"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// LuaModule is a Lua module which generators, raters and script tokens can require by Name.  The
+// module is Script, or the contents of FileName, and returns the module's value, usually a table of
+// functions.
+type LuaModule struct {
+	Name     string `json:"name" yaml:"name"`
+	Script   string `json:"script,omitempty" yaml:"script,omitempty"`
+	FileName string `json:"fileName,omitempty" yaml:"fileName,omitempty"`
+}
+
+// LuaLibrary is every Lua module a config's scripts can require, compiled once
+type LuaLibrary struct {
+	modules map[string]*lua.FunctionProto
+}
+
+// luaStdlibPrefix names the modules gogen ships, which config modules can't replace
+const luaStdlibPrefix = "gogen."
+
+// buildLuaLibrary compiles the config's Lua modules and every .lua file in its Lua paths.  Modules
+// set in the config win over files, and earlier paths win over later ones.  A file's module name is
+// its path under the Lua path without .lua, with directories separated by dots, so lib/net.lua is
+// lib.net.  The config directory's lua directory is always searched last.
+func (c *Config) buildLuaLibrary() *LuaLibrary {
+	lib := &LuaLibrary{modules: make(map[string]*lua.FunctionProto)}
+	add := func(name, script string) {
+		if strings.HasPrefix(name, luaStdlibPrefix) {
+			c.fatalf("Lua module '%s' cannot replace gogen's own modules", name)
+			return
+		}
+		proto, err := CompileLua(name, script)
+		if err != nil {
+			c.fatalf("Error compiling Lua module '%s': %s", name, err)
+			return
+		}
+		lib.modules[name] = proto
+	}
+
+	for _, m := range c.LuaModules {
+		if m.Name == "" {
+			c.fatalf("Lua module with script '%s' has no name", m.Script)
+			continue
+		}
+		if _, ok := lib.modules[m.Name]; ok {
+			c.fatalf("Lua module '%s' is defined more than once", m.Name)
+			continue
+		}
+		if m.Script == "" && m.FileName != "" {
+			fullPath, err := c.findFile(m.FileName, "lua")
+			if err != nil {
+				c.fatalf("Cannot find file '%s' for Lua module '%s'", m.FileName, m.Name)
+				continue
+			}
+			contents, err := ioutil.ReadFile(fullPath)
+			if err != nil {
+				c.fatalf("Error reading Lua module '%s': %s", m.Name, err)
+				continue
+			}
+			m.Script = string(contents)
+		}
+		add(m.Name, m.Script)
+	}
+
+	dirs := make([]string, 0, len(c.Global.LuaPath)+1)
+	for _, dir := range c.Global.LuaPath {
+		fullPath, err := c.findFile(dir, "")
+		if err != nil {
+			c.fatalf("Cannot find Lua path '%s'", dir)
+			continue
+		}
+		dirs = append(dirs, fullPath)
+	}
+	if c.cc.ConfigDir != "" {
+		if dir := filepath.Join(os.ExpandEnv(c.cc.ConfigDir), "lua"); isDir(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, dir := range dirs {
+		acceptableExtensions := map[string]bool{".lua": true}
+		c.walkPath(dir, acceptableExtensions, func(innerPath string) error {
+			rel, err := filepath.Rel(dir, innerPath)
+			if err != nil {
+				return err
+			}
+			name := strings.Replace(strings.TrimSuffix(rel, filepath.Ext(rel)), string(filepath.Separator), ".", -1)
+			if _, ok := lib.modules[name]; ok {
+				log.Debugf("Lua module '%s' already defined, skipping '%s'", name, innerPath)
+				return nil
+			}
+			contents, err := ioutil.ReadFile(innerPath)
+			if err != nil {
+				log.Errorf("Error reading Lua module '%s': %s", innerPath, err)
+				return nil
+			}
+			log.Debugf("Adding Lua module '%s' from '%s'", name, innerPath)
+			add(name, string(contents))
+			return nil
+		})
+	}
+	return lib
+}
+
+// LuaLibrary returns the Lua modules the config's scripts can require
+func (c *Config) LuaLibrary() *LuaLibrary {
+	c.ratersMutex.RLock()
+	defer c.ratersMutex.RUnlock()
+	return c.luaLibrary
+}
+
+// Modules returns the names of the library's modules, not including gogen's own
+func (lib *LuaLibrary) Modules() []string {
+	if lib == nil {
+		return nil
+	}
+	names := make([]string, 0, len(lib.modules))
+	for name := range lib.modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// merge adds modules from other which lib doesn't already have
+func (lib *LuaLibrary) merge(other *LuaLibrary) {
+	if other == nil {
+		return
+	}
+	for name, proto := range other.modules {
+		if _, ok := lib.modules[name]; !ok {
+			lib.modules[name] = proto
+		}
+	}
+}
+
+// Open makes gogen's modules and the library's modules available to require in L.  Modules are
+// loaded the first time they're required in each Lua state, and run with that state's globals.
+// A nil library opens only gogen's own modules.
+func (lib *LuaLibrary) Open(L *lua.LState) {
+	for name, loader := range luaStdlib {
+		L.PreloadModule(name, loader)
+	}
+	if lib == nil {
+		return
+	}
+	for name, proto := range lib.modules {
+		proto := proto
+		L.PreloadModule(name, func(L *lua.LState) int {
+			L.Push(NewLuaFunction(L, proto))
+			L.Call(0, 1)
+			return 1
+		})
+	}
+}
+
+// findFile finds fileName as given, next to the full config, or in subdir of the config directory
+func (c *Config) findFile(fileName string, subdir string) (string, error) {
+	fullPath := os.ExpandEnv(fileName)
+	candidates := []string{fullPath}
+	if c.cc.FullConfig != "" && !filepath.IsAbs(fullPath) {
+		candidates = append(candidates, filepath.Join(filepath.Dir(os.ExpandEnv(c.cc.FullConfig)), fullPath))
+	}
+	if c.cc.ConfigDir != "" && !filepath.IsAbs(fullPath) {
+		candidates = append(candidates, filepath.Join(os.ExpandEnv(c.cc.ConfigDir), subdir, fullPath))
+	}
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("Cannot find file '%s'", fileName)
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestLuaModules(t *testing.T) {
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "lua", "modules.yml"))
+	defer os.Setenv("GOGEN_FULLCONFIG", "")
+
+	c := NewConfig()
+	assert.Equal(t, []string{"counter", "greeting", "shout", "util.events"}, c.LuaLibrary().Modules())
+
+	s := c.FindSampleByName("moduletoken")
+	if assert.NotNil(t, s) {
+		now := time.Now()
+		replacement, _, err := s.Tokens[0].GenReplacement(-1, now, now, now, rand.New(rand.NewSource(0)))
+		assert.NoError(t, err)
+		assert.Equal(t, "hello a-b", replacement)
+	}
+}
+
+func TestLuaModuleState(t *testing.T) {
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "lua", "modules.yml"))
+	defer os.Setenv("GOGEN_FULLCONFIG", "")
+
+	c := NewConfig()
+	token := c.FindSampleByName("modulestate").Tokens[0]
+	now := time.Now()
+
+	// The script only changes state through a module, and still runs one at a time
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			randgen := rand.New(rand.NewSource(int64(w)))
+			for i := 0; i < 100; i++ {
+				_, _, err := token.GenReplacement(-1, now, now, now, randgen)
+				assert.NoError(t, err)
+			}
+		}(w)
+	}
+	wg.Wait()
+	replacement, _, _ := token.GenReplacement(-1, now, now, now, rand.New(rand.NewSource(0)))
+	assert.Equal(t, "801", replacement)
+}
+
+func TestLuaModuleErrors(t *testing.T) {
+	invalid := []*LuaModule{
+		{Name: "gogen.json", Script: "return {}"},
+		{Name: "broken", Script: "return {"},
+		{Name: "missing", FileName: "nonexistent.lua"},
+		{Script: "return {}"},
+	}
+	for _, m := range invalid {
+		// Config errors panic rather than exit while reloading
+		c := &Config{cc: ConfigConfig{reloading: true}, LuaModules: []*LuaModule{m}}
+		assert.Panics(t, func() { c.buildLuaLibrary() }, m.Name)
+	}
+	c := &Config{cc: ConfigConfig{reloading: true}, Global: Global{LuaPath: []string{"nonexistent"}}}
+	assert.Panics(t, func() { c.buildLuaLibrary() })
+}
+
+func runLuaStdlib(t *testing.T, randgen *rand.Rand, script string) lua.LValue {
+	L := lua.NewState()
+	defer L.Close()
+	var lib *LuaLibrary
+	lib.Open(L)
+	SetLuaRandom(L, randgen)
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Error running '%s': %s", script, err)
+	}
+	return L.Get(-1)
+}
+
+func TestLuaStdlib(t *testing.T) {
+	randgen := rand.New(rand.NewSource(0))
+	tests := []struct {
+		script   string
+		expected string
+	}{
+		{`return require("gogen.json").encode({a = 1, b = {1, 2.5, "x"}, c = {}, d = true})`, `{"a":1,"b":[1,2.5,"x"],"c":{},"d":true}`},
+		{`local t = require("gogen.json").decode('{"a":[1,{"b":"c"}]}') return t.a[1] .. t.a[2].b`, "1c"},
+		{`local v, err = require("gogen.json").decode('{') return tostring(v) .. " " .. tostring(err ~= nil)`, "nil true"},
+		{`return require("gogen.time").strftime("%Y-%m-%d %H:%M:%S", 1000000000.5)`, time.Unix(1000000000, 0).Format("2006-01-02 15:04:05")},
+		{`local tm = require("gogen.time") return tm.strptime("%Y-%m-%d %H:%M:%S", "2001-09-09 01:46:40")`, "1000000000"},
+		{`local s = require("gogen.strings") return s.join(s.split("a.b.c", "."), "|")`, "a|b|c"},
+		{`local s = require("gogen.strings") return #s.split("a.b.c", ".", 2)`, "2"},
+		{`local s = require("gogen.strings") return s.trim("  x ") .. s.trim("--y--", "-")`, "xy"},
+		{`local s = require("gogen.strings") return tostring(s.startsWith("gogen", "go")) .. tostring(s.endsWith("gogen", "go"))`, "truefalse"},
+		{`return require("gogen.random").weighted({{choice = "a", weight = 0}, {choice = "b", weight = 1}})`, "b"},
+		{`return require("gogen.random").weighted({a = 0, b = 0, c = 5})`, "c"},
+		{`return require("gogen.random").pick({"only"})`, "only"},
+		{`local ip = require("gogen.ip") return tostring(ip.contains("10.1.0.0/16", ip.random("10.1.2.0/24")))`, "true"},
+		{`local ip = require("gogen.ip") return tostring(ip.contains("fd00::/64", ip.random("fd00::/64")))`, "true"},
+		{`local ip = require("gogen.ip") return tostring(ip.isPrivate("192.168.1.1")) .. tostring(ip.isPrivate("8.8.8.8"))`, "truefalse"},
+		{`local ip = require("gogen.ip") return tostring(ip.isReserved("127.0.0.1")) .. tostring(ip.isReserved("2001:db8::1"))`, "truetrue"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, lua.LVAsString(runLuaStdlib(t, randgen, test.script)), test.script)
+	}
+}
+
+func TestLuaStdlibSeeded(t *testing.T) {
+	// Everything random draws from the state's generator, so the same seed gives the same results
+	script := `local r = require("gogen.random")
+local ip = require("gogen.ip")
+local t = r.shuffle({1, 2, 3, 4, 5, 6, 7, 8})
+return table.concat(t, ",") .. r.pick({"a", "b", "c", "d"}) .. r.weighted({x = 1, y = 2, z = 3}) .. ip.random("10.0.0.0/8")`
+	first := lua.LVAsString(runLuaStdlib(t, rand.New(rand.NewSource(42)), script))
+	second := lua.LVAsString(runLuaStdlib(t, rand.New(rand.NewSource(42)), script))
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, first, lua.LVAsString(runLuaStdlib(t, rand.New(rand.NewSource(43)), script)))
+}
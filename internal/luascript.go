@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// LuaScript is a Lua script compiled once and run in pooled Lua states, so running it costs neither
+// a new Lua state nor parsing the script again.  Each run gets its own globals, so globals the
+// script sets don't last between runs, anything which needs to last belongs in the state table.
+type LuaScript struct {
+	proto *lua.FunctionProto
+	state *lua.LTable
+	setup func(L *lua.LState)
+
+	// The state table is shared between every pooled Lua state, and Lua tables aren't safe to use
+	// concurrently, so runs which use the state table run one at a time
+	mutex  sync.Mutex
+	states sync.Pool
+}
+
+// CompileLua parses and compiles script, so it can be run in any number of Lua states
+func CompileLua(name string, script string) (*lua.FunctionProto, error) {
+	chunk, err := parse.Parse(strings.NewReader(script), name)
+	if err != nil {
+		return nil, err
+	}
+	return lua.Compile(chunk, name)
+}
+
+// NewLuaFunction returns a function running proto in L with L's globals.  A function loaded in one
+// Lua state keeps that state's globals wherever it's called, so each state needs its own.
+func NewLuaFunction(L *lua.LState, proto *lua.FunctionProto) *lua.LFunction {
+	return &lua.LFunction{Proto: proto, Env: L.Env, Upvalues: make([]*lua.Upvalue, int(proto.NumUpvalues))}
+}
+
+// NewLuaScript compiles script, making the state table the global state if it's not nil, and
+// calling setup to set any other globals of each new Lua state it runs in
+func NewLuaScript(name string, script string, state *lua.LTable, setup func(L *lua.LState)) (*LuaScript, error) {
+	proto, err := CompileLua(name, script)
+	if err != nil {
+		return nil, err
+	}
+	ls := &LuaScript{proto: proto, state: state, setup: setup}
+	ls.states.New = func() interface{} {
+		L := lua.NewState()
+		pl := &pooledLua{L: L}
+		if ls.state != nil {
+			// state isn't a global of its own, reading it takes the lock until the run ends.  Modules
+			// can keep the table, so once a Lua state has read it every run in that state locks.
+			gmeta := L.NewTable()
+			gmeta.RawSetString("__index", L.NewFunction(func(L *lua.LState) int {
+				if L.Get(2) != lua.LString("state") {
+					L.Push(lua.LNil)
+					return 1
+				}
+				if !pl.locked {
+					ls.mutex.Lock()
+					pl.locked, pl.usesState = true, true
+				}
+				L.Push(ls.state)
+				return 1
+			}))
+			L.SetMetatable(L.G.Global, gmeta)
+		}
+		if ls.setup != nil {
+			ls.setup(L)
+		}
+		// Globals the script sets go in a table of their own each run, reading through to the
+		// state's globals
+		pl.meta = L.NewTable()
+		pl.meta.RawSetString("__index", L.G.Global)
+		pl.f = NewLuaFunction(L, ls.proto)
+		return pl
+	}
+	return ls, nil
+}
+
+// pooledLua is a pooled Lua state, the script's function in it and the metatable of each run's
+// globals.  locked is set while a run holds the script's lock, and usesState once any run in the
+// state has read the state table.
+type pooledLua struct {
+	L         *lua.LState
+	f         *lua.LFunction
+	meta      *lua.LTable
+	locked    bool
+	usesState bool
+}
+
+// Run runs the script with math.random drawing from randgen and returns what it returned
+func (ls *LuaScript) Run(randgen *rand.Rand) (lua.LValue, error) {
+	state := ls.states.Get().(*pooledLua)
+	defer ls.states.Put(state)
+	if state.usesState {
+		ls.mutex.Lock()
+		state.locked = true
+	}
+	defer func() {
+		if state.locked {
+			state.locked = false
+			ls.mutex.Unlock()
+		}
+	}()
+	L := state.L
+	defer L.SetTop(0)
+	SetLuaRandom(L, randgen)
+	env := L.NewTable()
+	L.SetMetatable(env, state.meta)
+	state.f.Env = env
+	L.Push(state.f)
+	if err := L.PCall(0, 1, nil); err != nil {
+		return lua.LNil, err
+	}
+	return L.Get(-1), nil
+}
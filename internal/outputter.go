@@ -1,13 +1,19 @@
 package internal
 
 import (
+	"encoding/json"
 	"io"
 	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
 )
 
 // OutQueueItem represents one batch of events to output
 type OutQueueItem struct {
-	S      *Sample
+	S *Sample
+	// Output is where this item is being sent, one of the sample's Outputs
+	Output *Output
 	Events []map[string]string
 	Rand   *rand.Rand
 	IO     *OutputIO
@@ -33,6 +39,98 @@ func NewOutputIO() *OutputIO {
 	return o
 }
 
+// inherit sets any settings not set in o from from.  Outputs read from a config inherit every
+// setting the config doesn't set, others inherit settings left at their zero value.
+func (o *Output) inherit(from *Output) {
+	ov := reflect.ValueOf(o).Elem()
+	fv := reflect.ValueOf(from).Elem()
+	ot := ov.Type()
+	for i := 0; i < ov.NumField(); i++ {
+		f := ot.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		if o.set == nil && ov.Field(i).IsZero() || o.set != nil && !o.set[f.Name] {
+			ov.Field(i).Set(fv.Field(i))
+		}
+	}
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler, remembering which settings the config sets
+func (o *Output) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Output
+	if err := unmarshal((*plain)(o)); err != nil {
+		return err
+	}
+	var keys map[string]interface{}
+	if err := unmarshal(&keys); err != nil {
+		return err
+	}
+	o.setKeys(keys, "yaml", false)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, remembering which settings the config sets
+func (o *Output) UnmarshalJSON(b []byte) error {
+	type plain Output
+	if err := json.Unmarshal(b, (*plain)(o)); err != nil {
+		return err
+	}
+	var keys map[string]interface{}
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return err
+	}
+	// encoding/json matches keys to fields ignoring case
+	o.setKeys(keys, "json", true)
+	return nil
+}
+
+// setKeys marks the fields named by keys, by their tag, as set
+func (o *Output) setKeys(keys map[string]interface{}, tag string, foldCase bool) {
+	o.set = make(map[string]bool)
+	ot := reflect.TypeOf(*o)
+	for i := 0; i < ot.NumField(); i++ {
+		f := ot.Field(i)
+		name := strings.Split(f.Tag.Get(tag), ",")[0]
+		if name == "" {
+			continue
+		}
+		for k := range keys {
+			if k == name || foldCase && strings.EqualFold(k, name) {
+				o.set[f.Name] = true
+			}
+		}
+	}
+}
+
+// DisplayName returns the output's name, or its outputter if it doesn't have one
+func (o *Output) DisplayName() string {
+	if o.Name != "" {
+		return o.Name
+	}
+	return o.Outputter
+}
+
+// nameOutputs names any unnamed outputs after their outputter, numbering them when there's more
+// than one of a kind
+func nameOutputs(outputs []*Output) {
+	kinds := make(map[string]int)
+	for _, o := range outputs {
+		kinds[o.Outputter]++
+	}
+	seen := make(map[string]int)
+	for _, o := range outputs {
+		seen[o.Outputter]++
+		if o.Name != "" {
+			continue
+		}
+		o.Name = o.Outputter
+		if kinds[o.Outputter] > 1 {
+			o.Name += strconv.Itoa(seen[o.Outputter])
+		}
+	}
+}
+
 // Outputter will do the work of actually sending events
 type Outputter interface {
 	Send(item *OutQueueItem) error
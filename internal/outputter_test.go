@@ -1,12 +1,80 @@
 package internal
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
 )
 
 func TestNewOutputIO(t *testing.T) {
 	io := NewOutputIO()
 	assert.NotNil(t, io)
 }
+
+func TestOutputInherit(t *testing.T) {
+	global := &Output{Outputter: "http", OutputTemplate: "json", Endpoints: []string{"http://localhost"}, Retries: 3}
+	o := &Output{Outputter: "file", FileName: "/tmp/audit.log"}
+	o.inherit(global)
+	assert.Equal(t, &Output{Outputter: "file", OutputTemplate: "json", FileName: "/tmp/audit.log", Endpoints: []string{"http://localhost"}, Retries: 3}, o)
+}
+
+func TestOutputInheritZero(t *testing.T) {
+	global := &Output{Outputter: "splunkhec", Endpoints: []string{"http://localhost"}, Retries: 3, UseAck: true}
+
+	// Settings in the config set to their zero value aren't inherited
+	var o Output
+	assert.NoError(t, yaml.Unmarshal([]byte("useAck: false\nretries: 0\n"), &o))
+	o.inherit(global)
+	assert.False(t, o.UseAck)
+	assert.Equal(t, 0, o.Retries)
+	assert.Equal(t, "splunkhec", o.Outputter)
+	assert.Equal(t, []string{"http://localhost"}, o.Endpoints)
+
+	var jo Output
+	assert.NoError(t, json.Unmarshal([]byte(`{"UseAck": false, "retries": 0}`), &jo))
+	jo.inherit(global)
+	assert.False(t, jo.UseAck)
+	assert.Equal(t, 0, jo.Retries)
+	assert.Equal(t, "splunkhec", jo.Outputter)
+}
+
+func TestOutputZeroRetries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gogen_output")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	config := `global:
+  output:
+    outputter: http
+    retries: 0
+samples:
+  - name: noretries
+    lines:
+    - _raw: foo
+  - name: retries
+    output:
+      retries: 5
+    lines:
+    - _raw: foo
+`
+	fullConfig := filepath.Join(dir, "outputs.yml")
+	assert.NoError(t, ioutil.WriteFile(fullConfig, []byte(config), 0644))
+	c := BuildConfig(ConfigConfig{FullConfig: fullConfig})
+	assert.Equal(t, 0, c.Global.Output.Retries)
+	assert.Equal(t, 0, c.FindSampleByName("noretries").Output.Retries)
+	assert.Equal(t, 5, c.FindSampleByName("retries").Output.Retries)
+	assert.Equal(t, "http", c.FindSampleByName("retries").Output.Outputter)
+}
+
+func TestNameOutputs(t *testing.T) {
+	outputs := []*Output{{Outputter: "file"}, {Outputter: "http"}, {Outputter: "file"}, {Name: "mine", Outputter: "http"}}
+	nameOutputs(outputs)
+	assert.Equal(t, "file1", outputs[0].Name)
+	assert.Equal(t, "http1", outputs[1].Name)
+	assert.Equal(t, "file2", outputs[2].Name)
+	assert.Equal(t, "mine", outputs[3].DisplayName())
+}
@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"time"
+
+	log "github.com/coccyx/gogen/logger"
+)
+
+// Pool is a named set of entities, like users or hosts, which entity tokens in any sample can draw
+// from.  Every entity has a value for each of the pool's Attributes, generated once when the config
+// is built, so samples drawing the same entity agree on its attributes.
+type Pool struct {
+	Name string `json:"name" yaml:"name"`
+	Size int    `json:"size" yaml:"size"`
+	// Skew makes some entities more popular than others by drawing them from a zipf distribution with
+	// Skew as the exponent, which must be greater than 1.  Zero draws entities uniformly.
+	Skew float64 `json:"skew,omitempty" yaml:"skew,omitempty"`
+	// Attributes are generated like tokens of the same type.  An attribute's value can refer to
+	// earlier attributes of the same entity as $name$.
+	Attributes []Token             `json:"attributes" yaml:"attributes"`
+	Entities   []map[string]string `json:"-" yaml:"-"`
+
+	zipf *zipf
+}
+
+// poolTokenTypes are the token types which can generate pool attributes
+var poolTokenTypes = map[string]bool{"static": true, "random": true, "choice": true, "weightedChoice": true, "fake": true, "sequence": true}
+
+// build generates the pool's entities, drawing from randgen
+func (p *Pool) build(randgen *rand.Rand) error {
+	if p.Name == "" {
+		return fmt.Errorf("Pool has no name")
+	}
+	if p.Size < 1 {
+		return fmt.Errorf("Size must be at least 1 for pool '%s'", p.Name)
+	}
+	if p.Skew != 0 && p.Skew <= 1 {
+		return fmt.Errorf("Skew must be greater than 1 for pool '%s'", p.Name)
+	}
+	if p.Skew > 1 {
+		p.zipf = newZipf(p.Skew, uint64(p.Size-1))
+	}
+	attrs := make([]Token, len(p.Attributes))
+	copy(attrs, p.Attributes)
+	for i := range attrs {
+		a := &attrs[i]
+		if a.Name == "" {
+			return fmt.Errorf("Attribute %d has no name in pool '%s'", i, p.Name)
+		}
+		if !poolTokenTypes[a.Type] {
+			return fmt.Errorf("Type '%s' is invalid for attribute '%s' in pool '%s'", a.Type, a.Name, p.Name)
+		}
+		switch a.Type {
+		case "random":
+			if err := a.validateRandom(); err != nil {
+				return fmt.Errorf("%s for attribute '%s' in pool '%s'", err, a.Name, p.Name)
+			}
+		case "choice":
+			if len(a.Choice) == 0 {
+				return fmt.Errorf("Zero choice items for attribute '%s' in pool '%s'", a.Name, p.Name)
+			}
+		case "weightedChoice":
+			if len(a.WeightedChoice) == 0 {
+				return fmt.Errorf("Zero choice items for attribute '%s' in pool '%s'", a.Name, p.Name)
+			}
+		case "sequence":
+			if a.Step == 0 {
+				a.Step = 1
+			}
+			// Sequences are private to the pool, so entities are numbered the same on every build
+			a.seq = &sequence{value: a.Start, start: a.Start, step: a.Step, end: a.End}
+		}
+	}
+
+	now := time.Now()
+	p.Entities = make([]map[string]string, p.Size)
+	for i := range p.Entities {
+		e := make(map[string]string, len(attrs))
+		for _, a := range attrs {
+			v, _, err := a.GenReplacement(-1, now, now, now, randgen)
+			if err != nil {
+				return fmt.Errorf("%s in pool '%s'", err, p.Name)
+			}
+			for name, prev := range e {
+				v = strings.Replace(v, "$"+name+"$", prev, -1)
+			}
+			e[a.Name] = v
+		}
+		p.Entities[i] = e
+	}
+	return nil
+}
+
+// pick returns the index of a random entity, skewed towards the first entities if Skew is set
+func (p *Pool) pick(randgen *rand.Rand) int {
+	if p.Skew > 1 {
+		z := p.zipf
+		if z == nil {
+			z = newZipf(p.Skew, uint64(p.Size-1))
+		}
+		return int(z.draw(randgen))
+	}
+	return randgen.Intn(p.Size)
+}
+
+// hasAttribute returns true if the pool's entities have the named attribute
+func (p *Pool) hasAttribute(name string) bool {
+	for _, a := range p.Attributes {
+		if a.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sameConfig returns true if p and o are configured the same, and so would have the same entities
+func (p *Pool) sameConfig(o *Pool) bool {
+	return p.Name == o.Name && p.Size == o.Size && p.Skew == o.Skew && reflect.DeepEqual(p.Attributes, o.Attributes)
+}
+
+// buildPools generates the entities for every pool, dropping pools which fail so tokens using them
+// fail validation
+func (c *Config) buildPools() {
+	pools := make([]*Pool, 0, len(c.Pools))
+	for _, p := range c.Pools {
+		if err := p.build(NewRand(c.Global.Seed, "pool"+p.Name)); err != nil {
+			log.Errorf("Error building pool, ignoring it: %s", err)
+			continue
+		}
+		log.Debugf("Built pool '%s' with %d entities", p.Name, len(p.Entities))
+		pools = append(pools, p)
+	}
+	c.Pools = pools
+}
+
+// FindPool returns the named pool, or nil if it doesn't exist
+func (c *Config) FindPool(name string) *Pool {
+	for _, p := range c.Pools {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPools(t *testing.T) {
+	os.Setenv("GOGEN_HOME", "..")
+	c := BuildConfig(ConfigConfig{FullConfig: filepath.Join("..", "tests", "pools", "pools.yml")})
+	p := c.FindPool("users")
+	assert.NotNil(t, p)
+	assert.Equal(t, 50, len(p.Entities))
+	for i, e := range p.Entities {
+		assert.Equal(t, e["username"]+"@example.com", e["email"])
+		assert.True(t, strings.HasPrefix(e["ip"], "10.1."))
+		assert.Contains(t, []string{"Engineering", "Sales", "Finance"}, e["department"])
+		assert.Equal(t, fmt.Sprintf("%04d", i+1), e["laptop"])
+	}
+
+	// Entities are the same every time with the same seed
+	c2 := BuildConfig(ConfigConfig{FullConfig: filepath.Join("..", "tests", "pools", "pools.yml")})
+	assert.Equal(t, p.Entities, c2.FindPool("users").Entities)
+
+	// Tokens in the same group draw the same entity, and samples agree on its attributes
+	randgen := rand.New(rand.NewSource(0))
+	now := time.Now()
+	vpn := c.FindSampleByName("vpn")
+	proxy := c.FindSampleByName("proxy")
+	for i := 0; i < 100; i++ {
+		user, choice, err := vpn.Tokens[0].GenReplacement(-1, now, now, now, randgen)
+		assert.NoError(t, err)
+		ip, _, _ := vpn.Tokens[1].GenReplacement(choice, now, now, now, randgen)
+		proxyip, _, _ := proxy.Tokens[0].GenReplacement(choice, now, now, now, randgen)
+		email, _, _ := proxy.Tokens[1].GenReplacement(choice, now, now, now, randgen)
+		assert.Equal(t, ip, proxyip)
+		assert.Equal(t, user+"@example.com", email)
+	}
+}
+
+func TestPoolSkew(t *testing.T) {
+	p := &Pool{Name: "skewed", Size: 100, Skew: 2, Attributes: []Token{{Name: "id", Type: "sequence"}}}
+	assert.NoError(t, p.build(rand.New(rand.NewSource(0))))
+	randgen := rand.New(rand.NewSource(0))
+	counts := make([]int, 100)
+	for i := 0; i < 10000; i++ {
+		counts[p.pick(randgen)]++
+	}
+	assert.True(t, counts[0] > counts[1] && counts[1] > counts[10])
+}
+
+func TestPoolValidation(t *testing.T) {
+	randgen := rand.New(rand.NewSource(0))
+	assert.Error(t, (&Pool{Name: "nosize"}).build(randgen))
+	assert.Error(t, (&Pool{Name: "skew", Size: 1, Skew: 0.5}).build(randgen))
+	assert.Error(t, (&Pool{Name: "badtype", Size: 1, Attributes: []Token{{Name: "ts", Type: "timestamp"}}}).build(randgen))
+	assert.Error(t, (&Pool{Name: "nochoice", Size: 1, Attributes: []Token{{Name: "c", Type: "choice"}}}).build(randgen))
+	assert.Error(t, (&Pool{Name: "noupper", Size: 1, Attributes: []Token{{Name: "n", Type: "random", Replacement: "int", Lower: 5}}}).build(randgen))
+	assert.Error(t, (&Pool{Name: "badbounds", Size: 1, Attributes: []Token{{Name: "n", Type: "random", Replacement: "float", Lower: 5, Upper: 2}}}).build(randgen))
+	assert.Error(t, (&Pool{Name: "nolength", Size: 1, Attributes: []Token{{Name: "s", Type: "random", Replacement: "string"}}}).build(randgen))
+	assert.Error(t, (&Pool{Name: "badreplacement", Size: 1, Attributes: []Token{{Name: "r", Type: "random", Replacement: "bogus"}}}).build(randgen))
+}
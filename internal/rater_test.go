@@ -57,6 +57,114 @@ func TestLuaRaterConfig(t *testing.T) {
 	assert.Equal(t, `return options["multiplier"]`+"\n", multiply.Script)
 }
 
+func TestCurveRaterConfig(t *testing.T) {
+	// Setup environment
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "rater", "curvesrater.yml"))
+
+	c := NewConfig()
+
+	assert.Equal(t, map[string]float64{"06:00": 1, "18:00": 3}, getRater(c, "smoothdaily").Options["Points"])
+	assert.Equal(t, 0.5, getRater(c, "diurnal").Options["Min"])
+	assert.Equal(t, 2.0, getRater(c, "hourly").Options["Max"])
+	assert.Equal(t, []string{"business", "hourly"}, getRater(c, "combined").Options["Raters"])
+
+	// Config errors panic rather than exit while reloading
+	c.cc.reloading = true
+	invalid := []*RaterConfig{
+		{Name: "nopoints", Type: "interpolated"},
+		{Name: "badpoint", Type: "interpolated", Options: map[string]interface{}{"Points": map[interface{}]interface{}{"noon": 1.0}}},
+		{Name: "badpeak", Type: "sinusoidal", Options: map[string]interface{}{"Peak": "25:00"}},
+		{Name: "badperiod", Type: "sinusoidal", Options: map[string]interface{}{"Period": "-1h"}},
+		{Name: "badmean", Type: "randomwalk", Options: map[string]interface{}{"Mean": "high"}},
+		{Name: "noraters", Type: "composite"},
+		{Name: "badop", Type: "composite", Options: map[string]interface{}{"Raters": []interface{}{"daily"}, "Operation": "divide"}},
+	}
+	for _, r := range invalid {
+		assert.Panics(t, func() { c.validateRater(r) }, r.Name)
+	}
+
+	// Options of other raters are only numbers for the raters which use them as numbers
+	script := &RaterConfig{Name: "script", Type: "script", Options: map[string]interface{}{"Min": "low", "Points": "many", "Raters": 3}}
+	assert.NotPanics(t, func() { c.validateRater(script) })
+	assert.Equal(t, map[string]interface{}{"Min": "low", "Points": "many", "Raters": 3}, script.Options)
+
+	loop := &RaterConfig{Name: "loop", Type: "composite", Options: map[string]interface{}{"Raters": []interface{}{"outer"}}}
+	outer := &RaterConfig{Name: "outer", Type: "composite", Options: map[string]interface{}{"Raters": []interface{}{"daily", "loop"}}}
+	c.validateRater(loop)
+	c.validateRater(outer)
+	c.Raters = append(c.Raters, loop, outer)
+	assert.Panics(t, c.validateCompositeRaters)
+
+	c.Raters = c.Raters[:len(c.Raters)-2]
+	missing := &RaterConfig{Name: "missing", Type: "composite", Options: map[string]interface{}{"Raters": []interface{}{"bogus"}}}
+	c.validateRater(missing)
+	c.Raters = append(c.Raters, missing)
+	assert.Panics(t, c.validateCompositeRaters)
+}
+
+func TestCalendarRaterConfig(t *testing.T) {
+	// Setup environment
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "rater", "calendarrater.yml"))
+
+	c := NewConfig()
+
+	retail := getRater(c, "retail")
+	assert.Equal(t, map[int]float64{-1: 1.5}, retail.Options["DayOfMonth"])
+	assert.Equal(t, []CalendarRange{{Start: "11-20", End: "12-31", Rate: 2}}, retail.Options["Ranges"])
+	assert.True(t, CalendarRange{Start: "12-30", End: "01-03"}.Contains("2025-01-02"))
+	assert.False(t, CalendarRange{Start: "12-30", End: "01-03"}.Contains("2025-01-04"))
+
+	// Config errors panic rather than exit while reloading
+	c.cc.reloading = true
+	invalid := []*RaterConfig{
+		{Name: "badtz", Type: "calendar", Options: map[string]interface{}{"Timezone": "Mars/Olympus_Mons"}},
+		{Name: "baddate", Type: "calendar", Options: map[string]interface{}{"Dates": map[interface{}]interface{}{"2023-02-30": 1.0}}},
+		{Name: "norate", Type: "calendar", Options: map[string]interface{}{"Holidays": "holidays.csv"}},
+		{Name: "nofile", Type: "calendar", Options: map[string]interface{}{"Holidays": "bogus.csv", "HolidayRate": 1.0}},
+		{Name: "backwards", Type: "calendar", Options: map[string]interface{}{"Ranges": []interface{}{
+			map[interface{}]interface{}{"start": "2023-12-01", "end": "2023-11-01", "rate": 2.0}}}},
+		{Name: "mixed", Type: "calendar", Options: map[string]interface{}{"Ranges": []interface{}{
+			map[interface{}]interface{}{"start": "2023-12-01", "end": "12-31", "rate": 2.0}}}},
+	}
+	for _, r := range invalid {
+		assert.Panics(t, func() { c.validateRater(r) }, r.Name)
+	}
+}
+
+func TestBurstRaterConfig(t *testing.T) {
+	// Setup environment
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "rater", "burstrater.yml"))
+
+	c := NewConfig()
+
+	spiky := getRater(c, "spiky")
+	assert.Equal(t, 4.0, spiky.Options["BurstMagnitude"])
+	assert.Equal(t, 8.0, spiky.Options["BurstMaxMagnitude"])
+
+	// Config errors panic rather than exit while reloading
+	c.cc.reloading = true
+	invalid := []*RaterConfig{
+		{Name: "nothing", Type: "burst", Options: map[string]interface{}{"BurstDuration": "5m"}},
+		{Name: "badinterval", Type: "burst", Options: map[string]interface{}{"BurstInterval": "often"}},
+		{Name: "badduration", Type: "burst", Options: map[string]interface{}{"OutageInterval": "1h", "OutageDuration": "0s"}},
+		{Name: "negative", Type: "burst", Options: map[string]interface{}{"BurstInterval": "1h", "BurstMagnitude": -1}},
+		{Name: "backwards", Type: "burst", Options: map[string]interface{}{"BurstInterval": "1h", "BurstMagnitude": 5,
+			"BurstMaxMagnitude": 2}},
+	}
+	for _, r := range invalid {
+		assert.Panics(t, func() { c.validateRater(r) }, r.Name)
+	}
+}
+
 func getRater(c *Config, name string) *RaterConfig {
 	for _, dr := range c.Raters {
 		if dr.Name == name {
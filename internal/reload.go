@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	log "github.com/coccyx/gogen/logger"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Reload builds a new config from the same files as c.  If any of them fail to parse, or any
+// sample fails validation, an error is returned instead so the old config can keep running.
+// Samples in the new config share c's outputs and buffer, and have c's SampleOverrides applied.
+func (c *Config) Reload() (nc *Config, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			nc = nil
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	cc := c.cc
+	cc.reloading = true
+	nc = BuildConfig(cc)
+	if len(nc.invalid) > 0 {
+		return nil, fmt.Errorf("Samples failed validation: %s", strings.Join(nc.invalid, ", "))
+	}
+	if !bytes.Equal(nc.globalYAML, c.globalYAML) {
+		log.Warning("Global settings have changed, they will not take effect until gogen is restarted")
+	}
+	// Unchanged pools keep their entities, which may not be reproducible without a seed
+	for _, p := range nc.Pools {
+		if prev := c.FindPool(p.Name); prev != nil && prev.sameConfig(p) {
+			p.Entities = prev.Entities
+		}
+	}
+	for _, s := range nc.Samples {
+		outputs := make([]*Output, len(s.Outputs))
+		for i, o := range s.Outputs {
+			outputs[i] = o
+			if o == &nc.Global.Output {
+				outputs[i] = &c.Global.Output
+			}
+			for j := range nc.Global.Outputs {
+				if o == nc.Global.Outputs[j] && j < len(c.Global.Outputs) {
+					outputs[i] = c.Global.Outputs[j]
+				}
+			}
+		}
+		s.Outputs = outputs
+		s.Output = outputs[0]
+		if s.Buf == &nc.Buf {
+			s.Buf = &c.Buf
+		}
+		if c.SampleOverrides != nil {
+			c.SampleOverrides(s)
+		}
+	}
+	return nc, nil
+}
+
+// WatchPaths returns the files and directories c was built from
+func (c *Config) WatchPaths() []string {
+	var paths []string
+	if len(c.cc.FullConfig) > 0 {
+		if !strings.HasPrefix(c.cc.FullConfig, "http") {
+			paths = append(paths, c.cc.FullConfig)
+		}
+	} else {
+		if len(c.cc.GlobalFile) > 0 {
+			paths = append(paths, c.cc.GlobalFile)
+		}
+		paths = append(paths, c.cc.ConfigDir)
+		if !strings.HasPrefix(filepath.Clean(c.cc.SamplesDir), filepath.Clean(c.cc.ConfigDir)) {
+			paths = append(paths, c.cc.SamplesDir)
+		}
+	}
+	paths = append(paths, c.Global.SamplesDir...)
+	for _, m := range c.Mix {
+		paths = append(paths, m.Sample)
+	}
+	return paths
+}
+
+// SameConfig returns true if s and o were built from the same configuration
+func (s *Sample) SameConfig(o *Sample) bool {
+	return len(s.fingerprint) > 0 && s.fingerprint == o.fingerprint
+}
+
+// fingerprint hashes everything configured for s, including its outputs, rater, generator, pools
+// and transaction steps, so we can tell whether a reloaded sample has changed
+func (c *Config) fingerprint(s *Sample) string {
+	var steps []*Sample
+	for _, step := range s.Steps {
+		steps = append(steps, step.S)
+	}
+	var pools []*Pool
+	for _, t := range s.Tokens {
+		if t.Type == "entity" {
+			pools = append(pools, c.FindPool(t.Pool))
+		}
+	}
+	var scenarios []*Scenario
+	for _, sp := range s.phases {
+		if len(scenarios) == 0 || scenarios[len(scenarios)-1] != sp.scenario {
+			scenarios = append(scenarios, sp.scenario)
+		}
+	}
+	b, err := yaml.Marshal(struct {
+		Sample    *Sample
+		Outputs   []*Output
+		Rater     *RaterConfig
+		Generator *GeneratorConfig
+		Pools     []*Pool
+		Steps     []*Sample
+		Scenarios []*Scenario
+	}{s, s.Outputs, c.FindRater(s.RaterString), s.CustomGenerator, pools, steps, scenarios})
+	if err != nil {
+		log.Errorf("Error fingerprinting sample '%s': %s", s.Name, err)
+		return ""
+	}
+	return fmt.Sprintf("%x", sha1.Sum(b))
+}
+
+// fatalf exits, unless we're reloading in which case it panics so Reload can return an error
+func (c *Config) fatalf(format string, args ...interface{}) {
+	if c.cc.reloading {
+		log.Panicf(format, args...)
+	}
+	log.Fatalf(format, args...)
+}
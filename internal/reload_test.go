@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeReloadConfig(t *testing.T, path string, config string) {
+	assert.NoError(t, ioutil.WriteFile(path, []byte(config), 0644))
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gogen_reload")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yml")
+	writeReloadConfig(t, path, `
+global:
+  output:
+    outputter: buf
+samples:
+  - name: unchanged
+    lines:
+      - _raw: unchanged event
+  - name: changed
+    count: 1
+    lines:
+      - _raw: changed event
+`)
+	c := BuildConfig(ConfigConfig{FullConfig: path})
+	c.Global.Output.Outputter = "stdout"
+	c.SampleOverrides = func(s *Sample) {
+		s.Interval = 5
+	}
+	assert.Contains(t, c.WatchPaths(), path)
+
+	writeReloadConfig(t, path, `
+global:
+  output:
+    outputter: buf
+samples:
+  - name: unchanged
+    lines:
+      - _raw: unchanged event
+  - name: changed
+    count: 2
+    lines:
+      - _raw: changed event
+  - name: added
+    lines:
+      - _raw: added event
+`)
+	nc, err := c.Reload()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(nc.Samples))
+	assert.True(t, c.FindSampleByName("unchanged").SameConfig(nc.FindSampleByName("unchanged")))
+	assert.False(t, c.FindSampleByName("changed").SameConfig(nc.FindSampleByName("changed")))
+	// New samples share the running output and get our overrides
+	for _, s := range nc.Samples {
+		assert.Equal(t, &c.Global.Output, s.Output)
+		assert.Equal(t, &c.Buf, s.Buf)
+		assert.Equal(t, 5, s.Interval)
+	}
+}
+
+func TestReloadInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gogen_reload")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yml")
+	writeReloadConfig(t, path, `
+samples:
+  - name: valid
+    lines:
+      - _raw: valid event
+`)
+	c := BuildConfig(ConfigConfig{FullConfig: path})
+
+	writeReloadConfig(t, path, "samples: [")
+	_, err = c.Reload()
+	assert.Error(t, err)
+
+	// A sample which fails validation makes the whole config invalid
+	writeReloadConfig(t, path, `
+samples:
+  - name: valid
+    earliest: now
+    latest: -1h
+    lines:
+      - _raw: valid event
+`)
+	_, err = c.Reload()
+	assert.EqualError(t, err, "Samples failed validation: valid")
+
+	os.Remove(path)
+	_, err = c.Reload()
+	assert.Error(t, err)
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	strftime "github.com/cactus/gostrftime"
+	"github.com/coccyx/gogen/fake"
 	log "github.com/coccyx/gogen/logger"
 	"github.com/pbnjay/strptime"
 	uuid "github.com/satori/go.uuid"
@@ -45,10 +46,18 @@ type Sample struct {
 	Field           string              `json:"field,omitempty" yaml:"field,omitempty"`
 	FromSample      string              `json:"fromSample,omitempty" yaml:"fromSample,omitempty"`
 	SinglePass      bool                `json:"singlepass,omitempty" yaml:"singlepass,omitempty"`
+	Topic           string              `json:"topic,omitempty" yaml:"topic,omitempty"`
+	KeyField        string              `json:"keyField,omitempty" yaml:"keyField,omitempty"`
+	TargetEPS       float64             `json:"targetEPS,omitempty" yaml:"targetEPS,omitempty"`
+	TargetGBPerDay  float64             `json:"targetGBPerDay,omitempty" yaml:"targetGBPerDay,omitempty"`
+	OutputConfig    *Output             `json:"output,omitempty" yaml:"output,omitempty"`
+	OutputsConfig   []*Output           `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+	Steps           []*TransactionStep  `json:"steps,omitempty" yaml:"steps,omitempty"`
 
 	// Internal use variables
 	Rater           Rater                        `json:"-" yaml:"-"`
 	Output          *Output                      `json:"-" yaml:"-"`
+	Outputs         []*Output                    `json:"-" yaml:"-"`
 	EarliestParsed  time.Duration                `json:"-" yaml:"-"`
 	LatestParsed    time.Duration                `json:"-" yaml:"-"`
 	BeginParsed     time.Time                    `json:"-" yaml:"-"`
@@ -60,8 +69,12 @@ type Sample struct {
 	CustomGenerator *GeneratorConfig             `json:"-" yaml:"-"`
 	GeneratorState  *GeneratorState              `json:"-" yaml:"-"`
 	LuaMutex        *sync.Mutex                  `json:"-" yaml:"-"`
+	LuaLibrary      *LuaLibrary                  `json:"-" yaml:"-"`
 	Buf             *bytes.Buffer                `json:"-" yaml:"-"`
 	realSample      bool                         // Used to represent samples which aren't just used to store lines from CSV or raw
+	fingerprint     string                       // Hash of the sample's configuration, used to tell if it changed on reload
+	inTransaction   bool                         // Sample is a step of a transaction, and only generates as part of it
+	phases          []*samplePhase               // Scenario phases which change the sample
 }
 
 // Clock allows for implementers to keep track of their own view
@@ -85,33 +98,53 @@ func (s *Sample) Now() time.Time {
 
 // Token describes a replacement task to run against a sample
 type Token struct {
-	Name           string              `json:"name" yaml:"name"`
-	Format         string              `json:"format" yaml:"format"`
-	Token          string              `json:"token" yaml:"token"`
-	Type           string              `json:"type" yaml:"type"`
-	Replacement    string              `json:"replacement,omitempty" yaml:"replacement,omitempty"`
-	Group          int                 `json:"group,omitempty" yaml:"group,omitempty"`
-	Sample         *Sample             `json:"-" yaml:"-"`
-	Parent         *Sample             `json:"-" yaml:"-"`
-	SampleString   string              `json:"sample,omitempty" yaml:"sample,omitempty"`
-	Field          string              `json:"field,omitempty" yaml:"field,omitempty"`
-	SrcField       string              `json:"srcField,omitempty" yaml:"srcField,omitempty"`
-	Precision      int                 `json:"precision,omitempty" yaml:"precision,omitempty"`
-	Lower          int                 `json:"lower,omitempty" yaml:"lower,omitempty"`
-	Upper          int                 `json:"upper,omitempty" yaml:"upper,omitempty"`
-	Length         int                 `json:"length,omitempty" yaml:"length,omitempty"`
-	WeightedChoice []WeightedChoice    `json:"weightedChoice,omitempty" yaml:"weightedChoice,omitempty"`
-	FieldChoice    []map[string]string `json:"fieldChoice,omitempty" yaml:"fieldChoice,omitempty"`
-	Choice         []string            `json:"choice,omitempty" yaml:"choice,omitempty"`
-	Script         string              `json:"script,omitempty" yaml:"script,omitempty"`
-	Init           map[string]string   `json:"init,omitempty" yaml:"init,omitempty"`
-	RaterString    string              `json:"rater,omitempty" yaml:"rater,omitempty"`
-	Disabled       bool                `json:"disabled,omitempty" yaml:"omitempty"`
-	Rater          Rater               `json:"-" yaml:"-"`
+	Name            string              `json:"name" yaml:"name"`
+	Format          string              `json:"format" yaml:"format"`
+	Token           string              `json:"token" yaml:"token"`
+	Type            string              `json:"type" yaml:"type"`
+	Replacement     string              `json:"replacement,omitempty" yaml:"replacement,omitempty"`
+	Group           int                 `json:"group,omitempty" yaml:"group,omitempty"`
+	Sample          *Sample             `json:"-" yaml:"-"`
+	Parent          *Sample             `json:"-" yaml:"-"`
+	SampleString    string              `json:"sample,omitempty" yaml:"sample,omitempty"`
+	Field           string              `json:"field,omitempty" yaml:"field,omitempty"`
+	SrcField        string              `json:"srcField,omitempty" yaml:"srcField,omitempty"`
+	Precision       int                 `json:"precision,omitempty" yaml:"precision,omitempty"`
+	Lower           int                 `json:"lower,omitempty" yaml:"lower,omitempty"`
+	Upper           int                 `json:"upper,omitempty" yaml:"upper,omitempty"`
+	Length          int                 `json:"length,omitempty" yaml:"length,omitempty"`
+	Distribution    string              `json:"distribution,omitempty" yaml:"distribution,omitempty"`
+	Mean            float64             `json:"mean,omitempty" yaml:"mean,omitempty"`
+	StdDev          float64             `json:"stddev,omitempty" yaml:"stddev,omitempty"`
+	Alpha           float64             `json:"alpha,omitempty" yaml:"alpha,omitempty"`
+	Locale          string              `json:"locale,omitempty" yaml:"locale,omitempty"`
+	CIDRs           []WeightedCIDR      `json:"cidrs,omitempty" yaml:"cidrs,omitempty"`
+	AddressSpace    string              `json:"addressSpace,omitempty" yaml:"addressSpace,omitempty"`
+	ExcludeReserved bool                `json:"excludeReserved,omitempty" yaml:"excludeReserved,omitempty"`
+	Sticky          bool                `json:"sticky,omitempty" yaml:"sticky,omitempty"`
+	Pool            string              `json:"pool,omitempty" yaml:"pool,omitempty"`
+	Attribute       string              `json:"attribute,omitempty" yaml:"attribute,omitempty"`
+	WeightedChoice  []WeightedChoice    `json:"weightedChoice,omitempty" yaml:"weightedChoice,omitempty"`
+	FieldChoice     []map[string]string `json:"fieldChoice,omitempty" yaml:"fieldChoice,omitempty"`
+	Choice          []string            `json:"choice,omitempty" yaml:"choice,omitempty"`
+	Script          string              `json:"script,omitempty" yaml:"script,omitempty"`
+	Start           int                 `json:"start,omitempty" yaml:"start,omitempty"`
+	Step            int                 `json:"step,omitempty" yaml:"step,omitempty"`
+	End             int                 `json:"end,omitempty" yaml:"end,omitempty"`
+	Scope           string              `json:"scope,omitempty" yaml:"scope,omitempty"`
+	StateFile       string              `json:"stateFile,omitempty" yaml:"stateFile,omitempty"`
+	Init            map[string]string   `json:"init,omitempty" yaml:"init,omitempty"`
+	RaterString     string              `json:"rater,omitempty" yaml:"rater,omitempty"`
+	Disabled        bool                `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	Rater           Rater               `json:"-" yaml:"-"`
 
 	L                          *lua.LState `json:"-" yaml:"-"`
 	luaState                   *lua.LTable
-	mutex                      *sync.Mutex
+	script                     *LuaScript
+	seq                        *sequence
+	ip                         *ipConfig
+	zipf                       *zipf
+	pool                       *Pool
 	weightedChoiceTotals       []int
 	weightedChoiceRunningTotal int
 }
@@ -206,7 +239,9 @@ func (t Token) GenReplacement(choice int, et time.Time, lt time.Time, now time.T
 		switch t.Replacement {
 		case "int":
 			var ret int
-			if (t.Upper - t.Lower) > 0 {
+			if t.usesDistribution() {
+				ret = int(math.Floor(t.distributed(randgen) + 0.5))
+			} else if (t.Upper - t.Lower) > 0 {
 				ret = randgen.Intn(t.Upper-t.Lower) + t.Lower
 			} else if (t.Upper - t.Lower) <= 0 {
 				ret = t.Upper
@@ -223,7 +258,9 @@ func (t Token) GenReplacement(choice int, et time.Time, lt time.Time, now time.T
 			lower := t.Lower * int(math.Pow10(t.Precision))
 			upper := t.Upper * int(math.Pow10(t.Precision))
 			var f float64
-			if (upper - lower) > 0 {
+			if t.usesDistribution() {
+				f = t.distributed(randgen)
+			} else if (upper - lower) > 0 {
 				f = float64(randgen.Intn(upper-lower)+lower) / math.Pow10(t.Precision)
 			} else {
 				f = float64(upper) / math.Pow10(t.Precision)
@@ -235,9 +272,15 @@ func (t Token) GenReplacement(choice int, et time.Time, lt time.Time, now time.T
 	case "random":
 		switch t.Replacement {
 		case "int":
+			if t.usesDistribution() {
+				return strconv.Itoa(int(math.Floor(t.distributed(randgen) + 0.5))), -1, nil
+			}
 			ri := randgen.Intn(t.Upper-t.Lower) + t.Lower
 			return strconv.Itoa(ri), -1, nil
 		case "float":
+			if t.usesDistribution() {
+				return strconv.FormatFloat(t.distributed(randgen), 'f', t.Precision, 64), -1, nil
+			}
 			lower := t.Lower * int(math.Pow10(t.Precision))
 			upper := t.Upper * int(math.Pow10(t.Precision))
 			f := float64(randgen.Intn(upper-lower)+lower) / math.Pow10(t.Precision)
@@ -255,28 +298,14 @@ func (t Token) GenReplacement(choice int, et time.Time, lt time.Time, now time.T
 			}
 			return ret, -1, nil
 		case "guid":
-			u := uuid.NewV4()
+			var u uuid.UUID
+			randgen.Read(u[:])
+			u.SetVersion(4)
+			u.SetVariant()
 			return u.String(), -1, nil
-		case "ipv4":
-			var ret string
-			for i := 0; i < 4; i++ {
-				ri := randgen.Intn(255)
-				ret += strconv.Itoa(ri)
-				if i < 3 {
-					ret += "."
-				}
-			}
-			return ret, -1, nil
-		case "ipv6":
-			var ret string
-			for i := 0; i < 8; i++ {
-				ri := randgen.Intn(65535)
-				ret += fmt.Sprintf("%x", ri)
-				if i < 7 {
-					ret += ":"
-				}
-			}
-			return ret, -1, nil
+		case "ipv4", "ipv6":
+			ret, choice := t.genIP(choice, randgen)
+			return ret, choice, nil
 		}
 	case "choice":
 		if choice == -1 {
@@ -293,8 +322,19 @@ func (t Token) GenReplacement(choice int, et time.Time, lt time.Time, now time.T
 			}
 		}
 
-		r := randgen.Float64() * float64(t.weightedChoiceRunningTotal)
-		for j, total := range t.weightedChoiceTotals {
+		totals, total := t.weightedChoiceTotals, t.weightedChoiceRunningTotal
+		// Scenario phases can change the weights for a while
+		if t.Parent != nil && len(t.Parent.phases) > 0 {
+			if weights := t.Parent.scenarioWeights(&t, now); weights != nil {
+				totals, total = make([]int, len(weights)), 0
+				for i, w := range weights {
+					total += w
+					totals[i] = total
+				}
+			}
+		}
+		r := randgen.Float64() * float64(total)
+		for j, total := range totals {
 			if r < float64(total) {
 				choice = j
 				break
@@ -306,16 +346,24 @@ func (t Token) GenReplacement(choice int, et time.Time, lt time.Time, now time.T
 			choice = randgen.Intn(len(t.FieldChoice))
 		}
 		return t.FieldChoice[choice][t.SrcField], choice, nil
+	case "entity":
+		// Tokens in the same group share a choice, and so draw the same entity
+		if choice == -1 {
+			choice = t.pool.pick(randgen)
+		}
+		return t.pool.Entities[choice][t.Attribute], choice, nil
+	case "fake":
+		ret, err := fake.Generate(t.Replacement, t.Locale, randgen)
+		return ret, -1, err
+	case "sequence":
+		// Length zero pads the value
+		return fmt.Sprintf("%0*d", t.Length, t.seq.next()), -1, nil
 	case "script":
-		t.mutex.Lock()
-		defer t.mutex.Unlock()
-		L := lua.NewState()
-		defer L.Close()
-		L.SetGlobal("state", t.luaState)
-		if err := L.DoString(t.Script); err != nil {
+		ret, err := t.script.Run(randgen)
+		if err != nil {
 			log.Errorf("Error executing script for token '%s' in sample '%s': %s", t.Name, t.Parent.Name, err)
 		}
-		return lua.LVAsString(L.Get(-1)), -1, nil
+		return lua.LVAsString(ret), -1, nil
 	}
 	return "", -1, fmt.Errorf("GenReplacement called with invalid type for token '%s' with type '%s'", t.Name, t.Type)
 }
@@ -5,10 +5,12 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
 )
 
 func TestGenReplacement(t *testing.T) {
@@ -36,8 +38,8 @@ func TestGenReplacement(t *testing.T) {
 	testToken(3, "mUNERA9rI2", s, t)
 	testToken(4, "4C345", s, t)
 	testToken(7, "3", s, t)
-	testToken(9, "159.144.163.226", s, t)
-	testToken(10, "a8f6:236d:b3ef:c41e:4808:d6ed:ecb0:4067", s, t)
+	testToken(9, "250.18.249.42", s, t)
+	testToken(10, "2ffa:412:5ff9:bd2a:18fb:b1e0:d40f:ec85", s, t)
 	testToken(11, "2001-10-20 12:00:00.000", s, t)
 	testToken(12, "2001-10-20 12:00:00.000", s, t)
 	testToken(13, "1003579200", s, t)
@@ -79,6 +81,7 @@ func testToken(i int, value string, s *Sample, t *testing.T) {
 func TestLuaReplacement(t *testing.T) {
 	os.Setenv("GOGEN_HOME", "..")
 	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	os.Setenv("GOGEN_FULLCONFIG", "")
 	home := ".."
 	os.Setenv("GOGEN_SAMPLES_DIR", filepath.Join(home, "tests", "tokens", "lua.yml"))
 
@@ -92,6 +95,97 @@ func TestLuaReplacement(t *testing.T) {
 	testToken(4, "4C345", s, t)
 }
 
+func TestLuaState(t *testing.T) {
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	os.Setenv("GOGEN_FULLCONFIG", "")
+	home := ".."
+	os.Setenv("GOGEN_SAMPLES_DIR", filepath.Join(home, "tests", "tokens", "lua.yml"))
+
+	c := NewConfig()
+	s := c.FindSampleByName("lua")
+	token := s.Tokens[5]
+	now := time.Now()
+
+	// Every pooled Lua state shares the token's state, so no count is lost or repeated
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			randgen := rand.New(rand.NewSource(int64(w)))
+			for i := 0; i < 100; i++ {
+				_, _, err := token.GenReplacement(-1, now, now, now, randgen)
+				assert.NoError(t, err)
+			}
+		}(w)
+	}
+	wg.Wait()
+	replacement, _, _ := token.GenReplacement(-1, now, now, now, rand.New(rand.NewSource(0)))
+	assert.Equal(t, "801", replacement)
+}
+
+func TestLuaStateLock(t *testing.T) {
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	os.Setenv("GOGEN_FULLCONFIG", "")
+	home := ".."
+	os.Setenv("GOGEN_SAMPLES_DIR", filepath.Join(home, "tests", "tokens", "lua.yml"))
+
+	c := NewConfig()
+	s := c.FindSampleByName("lua")
+	static, state := s.Tokens[0], s.Tokens[5]
+	now := time.Now()
+
+	// Only runs which use the state table take the lock
+	run := func(token Token) chan string {
+		done := make(chan string, 1)
+		go func() {
+			replacement, _, _ := token.GenReplacement(-1, now, now, now, rand.New(rand.NewSource(0)))
+			done <- replacement
+		}()
+		return done
+	}
+	static.script.mutex.Lock()
+	select {
+	case replacement := <-run(static):
+		assert.Equal(t, "foo", replacement)
+	case <-time.After(2 * time.Second):
+		assert.Fail(t, "script not using state waited for the lock")
+	}
+	state.script.mutex.Lock()
+	done := run(state)
+	select {
+	case <-done:
+		assert.Fail(t, "script using state ran without the lock")
+	case <-time.After(100 * time.Millisecond):
+	}
+	state.script.mutex.Unlock()
+	assert.Equal(t, "1", <-done)
+	static.script.mutex.Unlock()
+}
+
+func TestLuaGlobals(t *testing.T) {
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	os.Setenv("GOGEN_FULLCONFIG", "")
+	home := ".."
+	os.Setenv("GOGEN_SAMPLES_DIR", filepath.Join(home, "tests", "tokens", "lua.yml"))
+
+	c := NewConfig()
+	s := c.FindSampleByName("lua")
+	token := s.Tokens[6]
+	now := time.Now()
+
+	// Globals the script sets don't last between runs, whichever pooled Lua state runs it
+	randgen := rand.New(rand.NewSource(0))
+	for i := 0; i < 10; i++ {
+		replacement, _, err := token.GenReplacement(-1, now, now, now, randgen)
+		assert.NoError(t, err)
+		assert.Equal(t, "1", replacement)
+	}
+}
+
 func TestParseTimestamp(t *testing.T) {
 	// Setup environment
 	os.Setenv("GOGEN_HOME", "..")
@@ -128,6 +222,42 @@ func BenchmarkLuaRandFloat(b *testing.B)  { benchmarkToken("lua", 2, b) }
 func BenchmarkLuaRandString(b *testing.B) { benchmarkToken("lua", 3, b) }
 func BenchmarkLuaRandHex(b *testing.B)    { benchmarkToken("lua", 4, b) }
 
+// Script tokens run concurrently in every GeneratorWorker, apart from runs using state which take turns
+func BenchmarkLuaStaticWorkers1(b *testing.B)     { benchmarkLuaWorkers(0, 1, b) }
+func BenchmarkLuaStaticWorkers4(b *testing.B)     { benchmarkLuaWorkers(0, 4, b) }
+func BenchmarkLuaRandStringWorkers1(b *testing.B) { benchmarkLuaWorkers(3, 1, b) }
+func BenchmarkLuaRandStringWorkers4(b *testing.B) { benchmarkLuaWorkers(3, 4, b) }
+func BenchmarkLuaStateWorkers1(b *testing.B)      { benchmarkLuaWorkers(5, 1, b) }
+func BenchmarkLuaStateWorkers4(b *testing.B)      { benchmarkLuaWorkers(5, 4, b) }
+
+func benchmarkLuaWorkers(i int, workers int, b *testing.B) {
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	os.Setenv("GOGEN_FULLCONFIG", "")
+	home := ".."
+	os.Setenv("GOGEN_SAMPLES_DIR", filepath.Join(home, "tests", "tokens", "lua.yml"))
+
+	c := NewConfig()
+	s := c.FindSampleByName("lua")
+	token := s.Tokens[i]
+	now := time.Date(2001, 10, 20, 12, 0, 0, 100000, time.Local)
+
+	b.ResetTimer()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			randgen := rand.New(rand.NewSource(int64(w)))
+			for n := w; n < b.N; n += workers {
+				_, _, _ = token.GenReplacement(-1, now, now, now, randgen)
+			}
+		}(w)
+	}
+	wg.Wait()
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds()/float64(workers), "events/s/worker")
+}
+
 func benchmarkToken(conf string, i int, b *testing.B) {
 	os.Setenv("GOGEN_HOME", "..")
 	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
@@ -178,3 +308,35 @@ func BenchmarkReplacement(b *testing.B) {
 		event = "$static$"
 	}
 }
+
+func TestFakeToken(t *testing.T) {
+	os.Setenv("GOGEN_HOME", "..")
+	c := BuildConfig(ConfigConfig{FullConfig: filepath.Join("..", "tests", "tokens", "fake.yml")})
+	s := c.FindSampleByName("fake")
+	assert.False(t, s.Disabled)
+	randgen := rand.New(rand.NewSource(0))
+	now := time.Now()
+	name, _, err := s.Tokens[0].GenReplacement(-1, now, now, now, randgen)
+	assert.NoError(t, err)
+	assert.Regexp(t, `^\w+ \w+$`, name)
+	email, _, err := s.Tokens[1].GenReplacement(-1, now, now, now, randgen)
+	assert.NoError(t, err)
+	assert.Contains(t, email, "@")
+	iban, _, err := s.Tokens[2].GenReplacement(-1, now, now, now, randgen)
+	assert.NoError(t, err)
+	assert.Regexp(t, `^DE\d{20}$`, iban)
+}
+
+func TestTokenDisabledYAML(t *testing.T) {
+	var token Token
+	assert.NoError(t, yaml.Unmarshal([]byte("name: host\ndisabled: true\n"), &token))
+	assert.True(t, token.Disabled)
+
+	out, err := yaml.Marshal(Token{Name: "host", Disabled: true})
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), "disabled: true")
+	out, err = yaml.Marshal(Token{Name: "host"})
+	assert.NoError(t, err)
+	assert.NotContains(t, string(out), "disabled")
+	assert.NotContains(t, string(out), "omitempty")
+}
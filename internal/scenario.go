@@ -0,0 +1,407 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	log "github.com/coccyx/gogen/logger"
+	"github.com/coccyx/timeparser"
+)
+
+// Scenario is a scripted timeline of phases, like an incident, which change how samples generate
+// while each phase is active.  Phases are scheduled in the samples' own time, so a scenario plays
+// out the same whether it's backfilled or generated in realtime.
+type Scenario struct {
+	Name string `json:"name" yaml:"name"`
+	// Start is when the phases' offsets count from, parsed like a sample's begin.  Defaults to the
+	// earliest begin of the samples the scenario changes, or when the config was first built if they
+	// have none, which reloads keep as long as the phases' schedule doesn't change.
+	Start string `json:"start,omitempty" yaml:"start,omitempty"`
+	// Manifest, if set, is a file we write a JSON record of when each phase was active to
+	Manifest string   `json:"manifest,omitempty" yaml:"manifest,omitempty"`
+	Phases   []*Phase `json:"phases" yaml:"phases"`
+
+	StartParsed time.Time `json:"-" yaml:"-"`
+	record      *scenarioRecord
+}
+
+// Phase is a period of a scenario, starting At after the scenario's start and lasting Duration, or
+// until generation ends if Duration isn't set
+type Phase struct {
+	Name     string `json:"name" yaml:"name"`
+	At       string `json:"at,omitempty" yaml:"at,omitempty"`
+	Duration string `json:"duration,omitempty" yaml:"duration,omitempty"`
+	// Ramp moves rates and weights linearly from their normal values at the start of the phase to
+	// the phase's values at the end, rather than changing them for the whole phase
+	Ramp    bool           `json:"ramp,omitempty" yaml:"ramp,omitempty"`
+	Changes []*PhaseChange `json:"changes" yaml:"changes"`
+
+	start time.Time
+	end   time.Time
+}
+
+// PhaseChange is how a phase changes one sample
+type PhaseChange struct {
+	Sample string `json:"sample" yaml:"sample"`
+	// Rate multiplies the sample's count, on top of its rater
+	Rate float64 `json:"rate,omitempty" yaml:"rate,omitempty"`
+	// Enabled false stops the sample generating during the phase.  Enabled true makes the sample only
+	// generate during phases which enable it, like a failover host which only logs once it's active.
+	Enabled *bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// Weights replaces the weights of weightedChoice tokens, by token name then choice.  Choices
+	// which aren't listed keep their weight.
+	Weights map[string]map[string]int `json:"weights,omitempty" yaml:"weights,omitempty"`
+}
+
+// samplePhase is a phase change which applies to a sample
+type samplePhase struct {
+	scenario *Scenario
+	index    int
+	change   *PhaseChange
+}
+
+var (
+	scenarioRecordsMutex sync.Mutex
+	scenarioRecords      = make(map[string]*scenarioRecord)
+	scenarioStarts       = make(map[string]scenarioStart)
+)
+
+// scenarioStart is when a scenario without a start or sample begins was first built, and the
+// schedule of its phases then
+type scenarioStart struct {
+	start    time.Time
+	schedule []string
+}
+
+// scenarioRecord is when a scenario's phases were seen active while generating, for its manifest
+type scenarioRecord struct {
+	mutex    sync.Mutex
+	scenario *Scenario
+	first    []time.Time
+	last     []time.Time
+}
+
+// getScenarioRecord returns the record for sc, which lives as long as the process so a reloaded
+// scenario keeps what's been seen so far as long as its phases don't change
+func getScenarioRecord(sc *Scenario) *scenarioRecord {
+	scenarioRecordsMutex.Lock()
+	defer scenarioRecordsMutex.Unlock()
+	r, ok := scenarioRecords[sc.Name]
+	if !ok || len(r.first) != len(sc.Phases) {
+		r = &scenarioRecord{first: make([]time.Time, len(sc.Phases)), last: make([]time.Time, len(sc.Phases))}
+		scenarioRecords[sc.Name] = r
+	}
+	r.mutex.Lock()
+	if r.scenario == nil {
+		r.scenario = sc
+	}
+	r.mutex.Unlock()
+	return r
+}
+
+// defaultScenarioStart returns when sc was first built, so reloading the config doesn't restart its
+// timeline, unless its phases have been rescheduled since
+func defaultScenarioStart(sc *Scenario) time.Time {
+	schedule := make([]string, 0, len(sc.Phases))
+	for _, p := range sc.Phases {
+		schedule = append(schedule, p.Name+"@"+p.At+"+"+p.Duration)
+	}
+	scenarioRecordsMutex.Lock()
+	defer scenarioRecordsMutex.Unlock()
+	if st, ok := scenarioStarts[sc.Name]; ok && reflect.DeepEqual(st.schedule, schedule) {
+		return st.start
+	}
+	now := time.Now()
+	scenarioStarts[sc.Name] = scenarioStart{start: now, schedule: schedule}
+	return now
+}
+
+// active returns true if the phase is active at now
+func (p *Phase) active(now time.Time) bool {
+	return !now.Before(p.start) && (p.end.IsZero() || now.Before(p.end))
+}
+
+// progress returns how far through the phase now is, from 0 to 1, for ramping
+func (p *Phase) progress(now time.Time) float64 {
+	if !p.Ramp || p.end.IsZero() {
+		return 1
+	}
+	return float64(now.Sub(p.start)) / float64(p.end.Sub(p.start))
+}
+
+// validateScenarios parses each scenario's schedule and attaches its phases to the samples they
+// change.  Invalid scenarios are ignored.
+func (c *Config) validateScenarios() {
+	for _, s := range c.Samples {
+		s.phases = nil
+	}
+	scenarios := make([]*Scenario, 0, len(c.Scenarios))
+	for _, sc := range c.Scenarios {
+		if err := c.validateScenario(sc); err != nil {
+			log.Errorf("Error in scenario '%s', ignoring it: %s", sc.Name, err)
+			continue
+		}
+		for i, p := range sc.Phases {
+			for _, pc := range p.Changes {
+				s := c.FindSampleByName(pc.Sample)
+				s.phases = append(s.phases, &samplePhase{scenario: sc, index: i, change: pc})
+			}
+			log.Infof("Scenario '%s' phase '%s' scheduled from %s to %s", sc.Name, p.Name, p.start, p.end)
+		}
+		sc.record = getScenarioRecord(sc)
+		scenarios = append(scenarios, sc)
+	}
+	c.Scenarios = scenarios
+}
+
+func (c *Config) validateScenario(sc *Scenario) error {
+	if sc.Name == "" {
+		return fmt.Errorf("Scenario has no name")
+	}
+	if len(sc.Phases) == 0 {
+		return fmt.Errorf("No phases")
+	}
+	for _, p := range sc.Phases {
+		for _, pc := range p.Changes {
+			s := c.FindSampleByName(pc.Sample)
+			if s == nil {
+				return fmt.Errorf("Sample '%s' not found in phase '%s'", pc.Sample, p.Name)
+			}
+			if pc.Rate < 0 {
+				return fmt.Errorf("Rate cannot be negative for sample '%s' in phase '%s'", pc.Sample, p.Name)
+			}
+			// Replay samples generate each event once, so phases can only stop and start them
+			if pc.Rate > 0 && s.Generator == "replay" {
+				return fmt.Errorf("Rate cannot be set for replay sample '%s' in phase '%s'", pc.Sample, p.Name)
+			}
+			for name, weights := range pc.Weights {
+				t := findToken(s, name)
+				if t == nil || t.Type != "weightedChoice" {
+					return fmt.Errorf("No weightedChoice token '%s' in sample '%s' in phase '%s'", name, pc.Sample, p.Name)
+				}
+				for choice, w := range weights {
+					if w < 0 {
+						return fmt.Errorf("Weight for choice '%s' cannot be negative in phase '%s'", choice, p.Name)
+					}
+				}
+			}
+		}
+	}
+
+	sc.StartParsed = time.Time{}
+	if sc.Start != "" {
+		var err error
+		if sc.StartParsed, err = timeparser.TimeParserNow(sc.Start, time.Now); err != nil {
+			return fmt.Errorf("Invalid start '%s': %s", sc.Start, err)
+		}
+	} else {
+		for _, p := range sc.Phases {
+			for _, pc := range p.Changes {
+				s := c.FindSampleByName(pc.Sample)
+				if !s.BeginParsed.IsZero() && (sc.StartParsed.IsZero() || s.BeginParsed.Before(sc.StartParsed)) {
+					sc.StartParsed = s.BeginParsed
+				}
+			}
+		}
+		if sc.StartParsed.IsZero() {
+			sc.StartParsed = defaultScenarioStart(sc)
+		}
+	}
+	for _, p := range sc.Phases {
+		var at, duration time.Duration
+		var err error
+		if p.At != "" {
+			if at, err = time.ParseDuration(p.At); err != nil || at < 0 {
+				return fmt.Errorf("Invalid at '%s' for phase '%s'", p.At, p.Name)
+			}
+		}
+		if p.Duration != "" {
+			if duration, err = time.ParseDuration(p.Duration); err != nil || duration <= 0 {
+				return fmt.Errorf("Invalid duration '%s' for phase '%s'", p.Duration, p.Name)
+			}
+		} else if p.Ramp {
+			return fmt.Errorf("Phase '%s' needs a duration to ramp over", p.Name)
+		}
+		p.start = sc.StartParsed.Add(at)
+		p.end = time.Time{}
+		if duration > 0 {
+			p.end = p.start.Add(duration)
+		}
+	}
+	return nil
+}
+
+// findToken returns the sample's token named name, or nil if it has none
+func findToken(s *Sample, name string) *Token {
+	for i := range s.Tokens {
+		if s.Tokens[i].Name == name {
+			return &s.Tokens[i]
+		}
+	}
+	return nil
+}
+
+// ScenarioRate returns how much the sample's active scenario phases multiply its count by at now,
+// which is zero while a phase has disabled it.  It also records which phases were active for
+// their scenario's manifest, so it should be called once for each interval generated.
+func (s *Sample) ScenarioRate(now time.Time) float64 {
+	if len(s.phases) == 0 {
+		return 1
+	}
+	rate := 1.0
+	onlyEnabled, enabled, disabled := false, false, false
+	for _, sp := range s.phases {
+		p := sp.scenario.Phases[sp.index]
+		pc := sp.change
+		if pc.Enabled != nil && *pc.Enabled {
+			onlyEnabled = true
+		}
+		if !p.active(now) {
+			continue
+		}
+		sp.scenario.record.seen(sp.scenario, sp.index, now)
+		if pc.Enabled != nil {
+			if *pc.Enabled {
+				enabled = true
+			} else {
+				disabled = true
+			}
+		}
+		if pc.Rate > 0 {
+			rate *= 1 + (pc.Rate-1)*p.progress(now)
+		}
+	}
+	if disabled || (onlyEnabled && !enabled) {
+		return 0
+	}
+	return rate
+}
+
+// scenarioWeights returns the weights for a weightedChoice token changed by an active scenario
+// phase at now, or nil if no phase changes them
+func (s *Sample) scenarioWeights(t *Token, now time.Time) []int {
+	var weights []int
+	for _, sp := range s.phases {
+		changed, ok := sp.change.Weights[t.Name]
+		if !ok {
+			continue
+		}
+		p := sp.scenario.Phases[sp.index]
+		if !p.active(now) {
+			continue
+		}
+		if weights == nil {
+			weights = make([]int, len(t.WeightedChoice))
+			for i, wc := range t.WeightedChoice {
+				weights[i] = wc.Weight
+			}
+		}
+		progress := p.progress(now)
+		for i, wc := range t.WeightedChoice {
+			if w, ok := changed[wc.Choice]; ok {
+				weights[i] = int(float64(weights[i]) + float64(w-weights[i])*progress + 0.5)
+			}
+		}
+	}
+	return weights
+}
+
+// seen records phase i of sc active at now, writing the manifest the first time it is.  The
+// manifest describes sc, as the config may have been built again since without generating.
+func (r *scenarioRecord) seen(sc *Scenario, i int, now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.scenario = sc
+	first := r.first[i].IsZero()
+	if first || now.Before(r.first[i]) {
+		r.first[i] = now
+	}
+	if now.After(r.last[i]) {
+		r.last[i] = now
+	}
+	if first {
+		log.Infof("Scenario '%s' phase '%s' active at %s", r.scenario.Name, r.scenario.Phases[i].Name, now)
+		r.save()
+	}
+}
+
+// manifestPhase is a phase's entry in a scenario manifest
+type manifestPhase struct {
+	Name    string         `json:"name"`
+	Start   time.Time      `json:"start"`
+	End     *time.Time     `json:"end,omitempty"`
+	Active  bool           `json:"active"`
+	First   *time.Time     `json:"firstSeen,omitempty"`
+	Last    *time.Time     `json:"lastSeen,omitempty"`
+	Changes []*PhaseChange `json:"changes"`
+}
+
+// save writes the scenario's manifest, must be called holding mutex
+func (r *scenarioRecord) save() {
+	sc := r.scenario
+	if sc.Manifest == "" {
+		return
+	}
+	m := struct {
+		Scenario string          `json:"scenario"`
+		Start    time.Time       `json:"start"`
+		Phases   []manifestPhase `json:"phases"`
+	}{Scenario: sc.Name, Start: sc.StartParsed}
+	for i, p := range sc.Phases {
+		mp := manifestPhase{Name: p.Name, Start: p.start, Changes: p.Changes}
+		if !p.end.IsZero() {
+			end := p.end
+			mp.End = &end
+		}
+		if !r.first[i].IsZero() {
+			first, last := r.first[i], r.last[i]
+			mp.Active, mp.First, mp.Last = true, &first, &last
+		}
+		m.Phases = append(m.Phases, mp)
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		log.Errorf("Error writing manifest for scenario '%s': %s", sc.Name, err)
+		return
+	}
+	// Write to a temporary file and rename so we never leave a partially written manifest
+	tmp := sc.Manifest + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		log.Errorf("Error writing manifest for scenario '%s': %s", sc.Name, err)
+		return
+	}
+	if err := os.Rename(tmp, sc.Manifest); err != nil {
+		log.Errorf("Error writing manifest for scenario '%s': %s", sc.Name, err)
+	}
+}
+
+// ResetScenarioManifests forgets when scenario phases were seen active, so a new run's manifests
+// only record that run
+func ResetScenarioManifests() {
+	scenarioRecordsMutex.Lock()
+	defer scenarioRecordsMutex.Unlock()
+	for _, r := range scenarioRecords {
+		r.mutex.Lock()
+		for i := range r.first {
+			r.first[i], r.last[i] = time.Time{}, time.Time{}
+		}
+		r.mutex.Unlock()
+	}
+}
+
+// SaveScenarioManifests writes the manifest of every scenario which has one, with when each of
+// its phases was active
+func SaveScenarioManifests() {
+	scenarioRecordsMutex.Lock()
+	defer scenarioRecordsMutex.Unlock()
+	for _, r := range scenarioRecords {
+		r.mutex.Lock()
+		r.save()
+		r.mutex.Unlock()
+	}
+}
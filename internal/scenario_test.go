@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newScenarioConfig(phases ...*Phase) (*Config, *Sample) {
+	s := &Sample{Name: "web", BeginParsed: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s.Tokens = []Token{{Name: "status", Type: "weightedChoice", Parent: s,
+		WeightedChoice: []WeightedChoice{{Weight: 90, Choice: "200"}, {Weight: 10, Choice: "500"}}}}
+	c := &Config{Samples: []*Sample{s}, Scenarios: []*Scenario{{Name: "test", Phases: phases}}}
+	return c, s
+}
+
+func TestScenarioRamp(t *testing.T) {
+	c, s := newScenarioConfig(&Phase{Name: "ramp", At: "10m", Duration: "10m", Ramp: true,
+		Changes: []*PhaseChange{{Sample: "web", Rate: 3, Weights: map[string]map[string]int{"status": {"200": 70, "500": 30}}}}})
+	c.validateScenarios()
+	assert.Equal(t, 1, len(c.Scenarios))
+	begin := s.BeginParsed
+	tok := &s.Tokens[0]
+
+	assert.Equal(t, 1.0, s.ScenarioRate(begin))
+	assert.Nil(t, s.scenarioWeights(tok, begin))
+	assert.Equal(t, 1.0, s.ScenarioRate(begin.Add(10*time.Minute)))
+	assert.Equal(t, []int{90, 10}, s.scenarioWeights(tok, begin.Add(10*time.Minute)))
+	assert.Equal(t, 2.0, s.ScenarioRate(begin.Add(15*time.Minute)))
+	assert.Equal(t, []int{80, 20}, s.scenarioWeights(tok, begin.Add(15*time.Minute)))
+	assert.Equal(t, 1.0, s.ScenarioRate(begin.Add(20*time.Minute)))
+	assert.Nil(t, s.scenarioWeights(tok, begin.Add(20*time.Minute)))
+}
+
+func TestScenarioEnabled(t *testing.T) {
+	enabled := true
+	c, s := newScenarioConfig(&Phase{Name: "on", At: "5m", Changes: []*PhaseChange{{Sample: "web", Enabled: &enabled}}})
+	c.validateScenarios()
+	begin := s.BeginParsed
+	// Samples enabled by a phase only generate while it's active, which without a duration is until the end
+	assert.Equal(t, 0.0, s.ScenarioRate(begin))
+	assert.Equal(t, 1.0, s.ScenarioRate(begin.Add(5*time.Minute)))
+	assert.Equal(t, 1.0, s.ScenarioRate(begin.Add(24*time.Hour)))
+}
+
+func TestScenarioDefaultStart(t *testing.T) {
+	build := func(at string) *Scenario {
+		c, s := newScenarioConfig(&Phase{Name: "later", At: at, Changes: []*PhaseChange{{Sample: "web", Rate: 2}}})
+		s.BeginParsed = time.Time{}
+		c.Scenarios[0].Name = "nobegin"
+		c.validateScenarios()
+		return c.Scenarios[0]
+	}
+	first := build("1h")
+	assert.False(t, first.StartParsed.IsZero())
+
+	// Reloading keeps the timeline where it was, until the phases are rescheduled
+	time.Sleep(10 * time.Millisecond)
+	assert.True(t, first.StartParsed.Equal(build("1h").StartParsed))
+	moved := build("2h")
+	assert.True(t, moved.StartParsed.After(first.StartParsed))
+	assert.True(t, moved.StartParsed.Equal(build("2h").StartParsed))
+}
+
+func TestScenarioValidation(t *testing.T) {
+	invalid := []*Phase{
+		{Name: "nosample", Changes: []*PhaseChange{{Sample: "bogus"}}},
+		{Name: "rate", Changes: []*PhaseChange{{Sample: "web", Rate: -1}}},
+		{Name: "notoken", Changes: []*PhaseChange{{Sample: "web", Weights: map[string]map[string]int{"bogus": {"200": 1}}}}},
+		{Name: "weight", Changes: []*PhaseChange{{Sample: "web", Weights: map[string]map[string]int{"status": {"200": -1}}}}},
+		{Name: "at", At: "soon"},
+		{Name: "duration", Duration: "-5m"},
+		{Name: "ramp", Ramp: true},
+	}
+	for _, p := range invalid {
+		c, s := newScenarioConfig(p)
+		c.validateScenarios()
+		assert.Equal(t, 0, len(c.Scenarios), p.Name)
+		assert.Nil(t, s.phases, p.Name)
+	}
+
+	c, s := newScenarioConfig(&Phase{Name: "replay", Changes: []*PhaseChange{{Sample: "web", Rate: 2}}})
+	s.Generator = "replay"
+	c.validateScenarios()
+	assert.Equal(t, 0, len(c.Scenarios))
+	enabled := false
+	c, s = newScenarioConfig(&Phase{Name: "replay", Changes: []*PhaseChange{{Sample: "web", Enabled: &enabled}}})
+	s.Generator = "replay"
+	c.validateScenarios()
+	assert.Equal(t, 1, len(c.Scenarios))
+}
@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// NewRand returns a random number generator for the stream identified by name.  If seed is non-zero,
+// the stream is derived from the seed and the name, so every sample, rater or worker gets its own
+// reproducible sequence regardless of what other streams are drawing.  A zero seed means we're not
+// running deterministically and we seed from the clock.
+func NewRand(seed int64, name string) *rand.Rand {
+	if seed == 0 {
+		return rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return rand.New(rand.NewSource(seed ^ int64(h.Sum64())))
+}
+
+// SetLuaRandom replaces math.random in the passed Lua state with an implementation which draws
+// from randgen instead of the process wide generator, so Lua scripts honor the configured seed.
+// gogen's Lua modules draw from randgen too.
+func SetLuaRandom(L *lua.LState, randgen *rand.Rand) {
+	L.G.Registry.RawSetString(luaRandKey, &lua.LUserData{Value: randgen})
+	math, ok := L.GetGlobal("math").(*lua.LTable)
+	if !ok {
+		return
+	}
+	math.RawSetString("random", L.NewFunction(func(L *lua.LState) int {
+		switch L.GetTop() {
+		case 0:
+			L.Push(lua.LNumber(randgen.Float64()))
+		case 1:
+			n := L.CheckInt(1)
+			if n < 1 {
+				L.ArgError(1, "interval is empty")
+			}
+			L.Push(lua.LNumber(randgen.Intn(n) + 1))
+		default:
+			min := L.CheckInt(1)
+			max := L.CheckInt(2)
+			if max < min {
+				L.ArgError(2, "interval is empty")
+			}
+			L.Push(lua.LNumber(randgen.Intn(max-min+1) + min))
+		}
+		return 1
+	}))
+}
@@ -0,0 +1,32 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestNewRand(t *testing.T) {
+	a := NewRand(42, "foo")
+	b := NewRand(42, "foo")
+	c := NewRand(42, "bar")
+	av := a.Int63()
+	assert.Equal(t, av, b.Int63())
+	assert.NotEqual(t, av, c.Int63())
+}
+
+func TestSetLuaRandom(t *testing.T) {
+	run := func() []float64 {
+		L := lua.NewState()
+		defer L.Close()
+		SetLuaRandom(L, NewRand(42, "lua"))
+		err := L.DoString(`return math.random(), math.random(10), math.random(5, 6)`)
+		assert.NoError(t, err)
+		return []float64{float64(L.ToNumber(1)), float64(L.ToNumber(2)), float64(L.ToNumber(3))}
+	}
+	first := run()
+	assert.Equal(t, first, run())
+	assert.True(t, first[1] >= 1 && first[1] <= 10)
+	assert.True(t, first[2] >= 5 && first[2] <= 6)
+}
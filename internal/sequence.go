@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/coccyx/gogen/logger"
+)
+
+// sequenceSaveInterval is how often a sequence's value is written to its state file while generating
+const sequenceSaveInterval = time.Second
+
+var (
+	sequencesMutex sync.Mutex
+	sequences      = make(map[string]*sequence)
+	// sequenceGeneration counts config builds, so we can tell a token changed by a reload from two
+	// tokens in the same config sharing a counter with different settings
+	sequenceGeneration int
+)
+
+// sequence is a counter shared by every sequence token in its scope, across generator workers
+type sequence struct {
+	mutex     sync.Mutex
+	value     int
+	start     int
+	step      int
+	end       int
+	stateFile string
+	dirty     bool
+	lastSave  time.Time
+	// generation is the config build which last used the sequence
+	generation int
+}
+
+// sequenceKey returns the key a sequence token shares its counter under.  Tokens scoped globally
+// share a counter with tokens of the same name in any sample, tokens scoped to a sample with tokens
+// of the same name in that sample, and otherwise each token has its own.
+func sequenceKey(s *Sample, t *Token, i int) string {
+	switch t.Scope {
+	case "global":
+		return "global/" + t.Name
+	case "sample":
+		return "sample/" + s.Name + "/" + t.Name
+	default:
+		return "token/" + s.Name + "/" + t.Name + "/" + strconv.Itoa(i)
+	}
+}
+
+// getSequence returns the sequence for key, creating it from t if it doesn't exist yet.  Sequences
+// live as long as the process, so they carry on across config reloads, unless a reload changes their
+// settings and they start again.  Tokens in the same config sharing a sequence with different
+// settings get the first token's sequence.
+func getSequence(key string, t *Token) *sequence {
+	sequencesMutex.Lock()
+	defer sequencesMutex.Unlock()
+	if seq, ok := sequences[key]; ok {
+		if seq.sameSettings(t) {
+			seq.generation = sequenceGeneration
+			return seq
+		}
+		if seq.generation == sequenceGeneration {
+			log.Errorf("Sequence token '%s' has different start, step, end or stateFile to another token sharing its sequence, using the first token's settings", t.Name)
+			return seq
+		}
+		log.Infof("Settings for sequence token '%s' have changed, starting sequence again", t.Name)
+		seq.mutex.Lock()
+		seq.save()
+		seq.mutex.Unlock()
+	}
+	seq := &sequence{value: t.Start, start: t.Start, step: t.Step, end: t.End, stateFile: t.StateFile, generation: sequenceGeneration}
+	if seq.stateFile != "" {
+		if b, err := ioutil.ReadFile(seq.stateFile); err == nil {
+			if v, err := strconv.Atoi(strings.TrimSpace(string(b))); err == nil {
+				log.Infof("Continuing sequence for token '%s' from %d", t.Name, v)
+				seq.value = v
+			} else {
+				log.Errorf("Error reading sequence state file '%s', starting from %d: %s", seq.stateFile, t.Start, err)
+			}
+		} else if !os.IsNotExist(err) {
+			log.Errorf("Error reading sequence state file '%s', starting from %d: %s", seq.stateFile, t.Start, err)
+		}
+	}
+	sequences[key] = seq
+	return seq
+}
+
+// sameSettings returns true if the sequence was created from a token with the same settings as t
+func (seq *sequence) sameSettings(t *Token) bool {
+	return seq.start == t.Start && seq.step == t.Step && seq.end == t.End && seq.stateFile == t.StateFile
+}
+
+// newSequenceGeneration starts a new config build, which may change the settings of sequences
+func newSequenceGeneration() {
+	sequencesMutex.Lock()
+	defer sequencesMutex.Unlock()
+	sequenceGeneration++
+}
+
+// next returns the sequence's current value and advances it, wrapping back to start once it
+// passes end
+func (seq *sequence) next() int {
+	seq.mutex.Lock()
+	defer seq.mutex.Unlock()
+	ret := seq.value
+	seq.value += seq.step
+	if seq.end != 0 && ((seq.step > 0 && seq.value > seq.end) || (seq.step < 0 && seq.value < seq.end)) {
+		seq.value = seq.start
+	}
+	seq.dirty = true
+	if seq.stateFile != "" && time.Since(seq.lastSave) >= sequenceSaveInterval {
+		seq.save()
+	}
+	return ret
+}
+
+// save writes the sequence's next value to its state file, must be called holding mutex
+func (seq *sequence) save() {
+	if seq.stateFile == "" || !seq.dirty {
+		return
+	}
+	seq.lastSave = time.Now()
+	seq.dirty = false
+	// Write to a temporary file and rename so we never leave a partially written state file
+	tmp := seq.stateFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(fmt.Sprintf("%d\n", seq.value)), 0644); err != nil {
+		log.Errorf("Error writing sequence state file '%s': %s", seq.stateFile, err)
+		return
+	}
+	if err := os.Rename(tmp, seq.stateFile); err != nil {
+		log.Errorf("Error writing sequence state file '%s': %s", seq.stateFile, err)
+	}
+}
+
+// SaveSequences writes every sequence with a state file, so the next run continues where this
+// one left off
+func SaveSequences() {
+	sequencesMutex.Lock()
+	defer sequencesMutex.Unlock()
+	for _, seq := range sequences {
+		seq.mutex.Lock()
+		seq.save()
+		seq.mutex.Unlock()
+	}
+}
@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSequenceToken(t *testing.T) {
+	os.Setenv("GOGEN_HOME", "..")
+	c := BuildConfig(ConfigConfig{FullConfig: filepath.Join("..", "tests", "tokens", "sequence.yml")})
+	s := c.FindSampleByName("sequence")
+	assert.False(t, s.Disabled)
+	randgen := rand.New(rand.NewSource(0))
+	now := time.Now()
+	gen := func(i int) string {
+		r, _, err := s.Tokens[i].GenReplacement(-1, now, now, now, randgen)
+		assert.NoError(t, err)
+		return r
+	}
+
+	assert.Equal(t, "001000", gen(0))
+	assert.Equal(t, "001010", gen(0))
+	// Sample scoped tokens share a counter
+	assert.Equal(t, "0", gen(1))
+	assert.Equal(t, "1", gen(2))
+	assert.Equal(t, "2", gen(1))
+	// Counting down and wrapping
+	assert.Equal(t, "3", gen(3))
+	assert.Equal(t, "2", gen(3))
+	assert.Equal(t, "1", gen(3))
+	assert.Equal(t, "3", gen(3))
+}
+
+func TestSequenceConcurrent(t *testing.T) {
+	seq := getSequence("test/concurrent", &Token{Name: "concurrent", Step: 1})
+	var wg sync.WaitGroup
+	seen := make([]map[int]bool, 4)
+	for i := range seen {
+		seen[i] = make(map[int]bool)
+		wg.Add(1)
+		go func(m map[int]bool) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				m[seq.next()] = true
+			}
+		}(seen[i])
+	}
+	wg.Wait()
+	all := make(map[int]bool)
+	for _, m := range seen {
+		for v := range m {
+			all[v] = true
+		}
+	}
+	assert.Equal(t, 4000, len(all))
+}
+
+func TestSequenceStateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gogen_sequence")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "state")
+	token := &Token{Name: "persisted", Start: 5, Step: 1, StateFile: stateFile}
+
+	seq := getSequence("test/persisted1", token)
+	assert.Equal(t, 5, seq.next())
+	assert.Equal(t, 6, seq.next())
+	SaveSequences()
+	b, err := ioutil.ReadFile(stateFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "7", strings.TrimSpace(string(b)))
+
+	// A new run continues where the last left off
+	seq = getSequence("test/persisted2", token)
+	assert.Equal(t, 7, seq.next())
+}
+
+func TestSequenceSettings(t *testing.T) {
+	newSequenceGeneration()
+	first := getSequence("test/settings", &Token{Name: "settings", Start: 1, Step: 1})
+	assert.Equal(t, 1, first.next())
+	// Another token sharing the sequence in the same config gets the first token's settings
+	assert.True(t, first == getSequence("test/settings", &Token{Name: "settings", Start: 100, Step: 1}))
+
+	// A reload with the same settings carries on the sequence
+	newSequenceGeneration()
+	assert.True(t, first == getSequence("test/settings", &Token{Name: "settings", Start: 1, Step: 1}))
+	assert.Equal(t, 2, first.next())
+
+	// A reload changing the settings starts again
+	newSequenceGeneration()
+	changed := getSequence("test/settings", &Token{Name: "settings", Start: 100, Step: 5})
+	assert.False(t, first == changed)
+	assert.Equal(t, 100, changed.next())
+	assert.Equal(t, 105, changed.next())
+}
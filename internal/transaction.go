@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	log "github.com/coccyx/gogen/logger"
+)
+
+// TransactionStep is one of the samples a transaction sample generates an event in.  Each step
+// happens between MinLatency and MaxLatency after the step before it, or after the start of the
+// transaction for the first step.
+type TransactionStep struct {
+	Sample     string  `json:"sample" yaml:"sample"`
+	MinLatency string  `json:"minLatency,omitempty" yaml:"minLatency,omitempty"`
+	MaxLatency string  `json:"maxLatency,omitempty" yaml:"maxLatency,omitempty"`
+	S          *Sample `json:"-" yaml:"-"`
+
+	minLatency time.Duration
+	maxLatency time.Duration
+}
+
+// Latency returns how long after the previous step this step happens
+func (ts *TransactionStep) Latency(randgen *rand.Rand) time.Duration {
+	if ts.maxLatency <= ts.minLatency {
+		return ts.minLatency
+	}
+	return ts.minLatency + time.Duration(randgen.Int63n(int64(ts.maxLatency-ts.minLatency)))
+}
+
+// TransactionContext describes the transaction a GenQueueItem is generating a step of, for
+// transaction tokens
+type TransactionContext struct {
+	ID   string
+	Name string
+	Step int
+}
+
+// Value returns the transaction's id, name or step number for a transaction token
+func (tc *TransactionContext) Value(replacement string) string {
+	if tc == nil {
+		return ""
+	}
+	switch replacement {
+	case "id":
+		return tc.ID
+	case "name":
+		return tc.Name
+	case "step":
+		return strconv.Itoa(tc.Step)
+	}
+	return ""
+}
+
+// validateTransaction resolves the samples in a transaction sample's steps.  Step samples only
+// generate as part of their transactions.
+func (c *Config) validateTransaction(s *Sample) {
+	if len(s.Steps) == 0 {
+		log.Errorf("No steps for transaction sample '%s', disabling sample", s.Name)
+		s.Disabled = true
+		return
+	}
+	for _, step := range s.Steps {
+		step.S = nil
+		for _, o := range c.Samples {
+			if o.Name == step.Sample && o != s {
+				step.S = o
+			}
+		}
+		if err := step.validate(); err != nil {
+			log.Errorf("%s in transaction sample '%s', disabling sample", err, s.Name)
+			s.Disabled = true
+			return
+		}
+	}
+	if !s.Disabled {
+		for _, step := range s.Steps {
+			step.S.inTransaction = true
+		}
+	}
+}
+
+func (ts *TransactionStep) validate() error {
+	if ts.S == nil {
+		return fmt.Errorf("Step sample '%s' not found", ts.Sample)
+	}
+	// Steps are generated one event at a time and must send it before returning, which only the
+	// sample generator does
+	if ts.S.Generator != "" && ts.S.Generator != defaultGenerator {
+		return fmt.Errorf("Step sample '%s' cannot use generator '%s', steps must use the sample generator", ts.Sample, ts.S.Generator)
+	}
+	var err error
+	if ts.MinLatency != "" {
+		if ts.minLatency, err = time.ParseDuration(ts.MinLatency); err != nil || ts.minLatency < 0 {
+			return fmt.Errorf("Invalid minLatency '%s' for step '%s'", ts.MinLatency, ts.Sample)
+		}
+	}
+	ts.maxLatency = ts.minLatency
+	if ts.MaxLatency != "" {
+		if ts.maxLatency, err = time.ParseDuration(ts.MaxLatency); err != nil || ts.maxLatency < ts.minLatency {
+			return fmt.Errorf("Invalid maxLatency '%s' for step '%s'", ts.MaxLatency, ts.Sample)
+		}
+	}
+	return nil
+}
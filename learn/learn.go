@@ -0,0 +1,526 @@
+// Package learn infers a gogen sample from example log lines.  Values which vary between lines,
+// like timestamps, IPs, GUIDs, numbers, hex strings and enumerations, are found and replaced with
+// template tokens of the matching type, so the sample generates lines shaped like the originals.
+package learn
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// DefaultMaxChoices is the most distinct values a typed value can have and still be learned as an
+// enumeration of the values seen, rather than generated at random
+const DefaultMaxChoices = 20
+
+// slot is a value found in a line, which may become a token
+type slot struct {
+	kind   string
+	value  string
+	start  int
+	end    int
+	format string // For timestamps, the format to generate them in
+	layout string // For timestamps, the Go layout to parse them with
+	key    string // Name of the field the value is in, if we could tell
+	token  *learned
+}
+
+// learned is a token we're learning the values of
+type learned struct {
+	name   string
+	kind   string
+	format string
+	layout string
+	counts map[string]int
+	order  []string
+	total  int
+	token  *config.Token
+}
+
+// detector finds values of a kind in a line, check rejects matches which aren't really of the kind
+type detector struct {
+	kind  string
+	re    *regexp.Regexp
+	check func(line string, m []int) (format, layout string, ok bool)
+}
+
+var months = `(?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec)`
+
+// detectors are tried in order, and a value found by one can't be part of a value found by a
+// later one, so timestamps come first and more specific kinds before general ones
+var detectors = []detector{
+	{"timestamp", regexp.MustCompile(`\b\d{4}([-/])\d{2}[-/]\d{2}([T ])\d{2}:\d{2}:\d{2}(?:([.,])(\d{1,9}))?(Z|[+-]\d{2}:?\d{2})?`), isoTimestamp},
+	{"timestamp", regexp.MustCompile(`\b\d{2}/` + months + `/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`), fixedTimestamp("%d/%b/%Y:%H:%M:%S %z", "02/Jan/2006:15:04:05 -0700")},
+	{"timestamp", regexp.MustCompile(`\b(?:Mon|Tue|Wed|Thu|Fri|Sat|Sun) ` + months + ` [ \d]\d \d{2}:\d{2}:\d{2} \d{4}\b`), fixedTimestamp("%a %b %e %H:%M:%S %Y", "Mon Jan _2 15:04:05 2006")},
+	{"timestamp", regexp.MustCompile(`\b` + months + ` [ \d]\d \d{2}:\d{2}:\d{2}\b`), fixedTimestamp("%b %e %H:%M:%S", "Jan _2 15:04:05")},
+	{"epochtimestamp", regexp.MustCompile(`\b1\d{9}\b`), epochTimestamp},
+	{"guid", regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`), nil},
+	{"mac", regexp.MustCompile(`\b[0-9a-fA-F]{2}(?::[0-9a-fA-F]{2}){5}\b`), nil},
+	{"ipv6", regexp.MustCompile(`[0-9a-fA-F:]*:[0-9a-fA-F:]*:[0-9a-fA-F:]*`), isIPv6},
+	{"ipv4", regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`), isIPv4},
+	{"hex", regexp.MustCompile(`\b[0-9a-fA-F]{8,}\b`), isHex},
+	{"number", regexp.MustCompile(`\b\d+(?:\.\d+)?\b`), isNumber},
+}
+
+// wordRe splits the text between typed values into words, which become enumerations if they vary
+var wordRe = regexp.MustCompile(`[^\s"'\[\](){}<>,;:=|&?]+`)
+
+// keyRe finds the name of the field a value is in, from the text before it, like key=value or "key": "value"
+var keyRe = regexp.MustCompile(`([A-Za-z_][\w.\-]*)["']?\s*[=:]\s*["']?$`)
+
+func isoTimestamp(line string, m []int) (string, string, bool) {
+	group := func(i int) string {
+		if m[i*2] < 0 {
+			return ""
+		}
+		return line[m[i*2]:m[i*2+1]]
+	}
+	dsep, tsep, fsep, frac, zone := group(1), group(2), group(3), group(4), group(5)
+	format := "%Y" + dsep + "%m" + dsep + "%d" + tsep + "%H:%M:%S"
+	layout := "2006" + dsep + "01" + dsep + "02" + tsep + "15:04:05"
+	strftime := true
+	if frac != "" {
+		layout += fsep + strings.Repeat("0", len(frac))
+		switch len(frac) {
+		case 3:
+			format += fsep + "%L"
+		case 6:
+			format += fsep + "%f"
+		case 9:
+			format += fsep + "%N"
+		default:
+			strftime = false
+		}
+	}
+	switch {
+	case zone == "Z":
+		layout += "Z07:00"
+		strftime = false
+	case strings.Contains(zone, ":"):
+		layout += "-07:00"
+		strftime = false
+	case zone != "":
+		layout += "-0700"
+		format += "%z"
+	}
+	if !strftime {
+		return "", layout, true
+	}
+	return format, layout, true
+}
+
+func fixedTimestamp(format, layout string) func(string, []int) (string, string, bool) {
+	return func(string, []int) (string, string, bool) {
+		return format, layout, true
+	}
+}
+
+func epochTimestamp(line string, m []int) (string, string, bool) {
+	// Fractional epoch times are left as numbers
+	if m[1]+1 < len(line) && line[m[1]] == '.' && line[m[1]+1] >= '0' && line[m[1]+1] <= '9' {
+		return "", "", false
+	}
+	return "", "", true
+}
+
+func isIPv6(line string, m []int) (string, string, bool) {
+	v := line[m[0]:m[1]]
+	ip := net.ParseIP(v)
+	return "", "", ip != nil && ip.To4() == nil && bounded(line, m[0], m[1])
+}
+
+func isIPv4(line string, m []int) (string, string, bool) {
+	return "", "", net.ParseIP(line[m[0]:m[1]]) != nil
+}
+
+func isHex(line string, m []int) (string, string, bool) {
+	v := line[m[0]:m[1]]
+	return "", "", strings.ContainsAny(v, "0123456789") && strings.ContainsAny(v, "abcdefABCDEF")
+}
+
+func isNumber(line string, m []int) (string, string, bool) {
+	// Numbers with leading zeroes are codes rather than quantities, so they're left as words
+	v := line[m[0]:m[1]]
+	return "", "", !(len(v) > 1 && v[0] == '0' && v[1] != '.')
+}
+
+// bounded returns true if the text from start to end isn't part of a longer word
+func bounded(line string, start, end int) bool {
+	isWord := func(c byte) bool {
+		return c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+	}
+	return (start == 0 || !isWord(line[start-1])) && (end == len(line) || !isWord(line[end]))
+}
+
+// parse finds the typed values and words in a line, in the order they appear
+func parse(line string) []*slot {
+	taken := make([]bool, len(line)+1)
+	var slots []*slot
+	for _, d := range detectors {
+	matches:
+		for _, m := range d.re.FindAllStringSubmatchIndex(line, -1) {
+			for i := m[0]; i < m[1]; i++ {
+				if taken[i] {
+					continue matches
+				}
+			}
+			s := &slot{kind: d.kind, value: line[m[0]:m[1]], start: m[0], end: m[1]}
+			if d.check != nil {
+				var ok bool
+				if s.format, s.layout, ok = d.check(line, m); !ok {
+					continue
+				}
+			}
+			if s.kind == "timestamp" && s.format == "" {
+				s.kind = "gotimestamp"
+				s.format = s.layout
+			}
+			for i := m[0]; i < m[1]; i++ {
+				taken[i] = true
+			}
+			slots = append(slots, s)
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].start < slots[j].start })
+
+	// Words are whatever's left between the typed values
+	var all []*slot
+	last := 0
+	words := func(end int) {
+		for _, m := range wordRe.FindAllStringIndex(line[last:end], -1) {
+			all = append(all, &slot{kind: "word", value: line[last+m[0] : last+m[1]], start: last + m[0], end: last + m[1]})
+		}
+	}
+	for _, s := range slots {
+		words(s.start)
+		all = append(all, s)
+		last = s.end
+	}
+	words(len(line))
+	for _, s := range all {
+		if m := keyRe.FindStringSubmatch(line[:s.start]); m != nil {
+			s.key = m[1]
+		}
+	}
+	return all
+}
+
+// shape describes a line's structure, lines with the same shape differ only in their values
+func shape(line string, slots []*slot) string {
+	var b strings.Builder
+	last := 0
+	for _, s := range slots {
+		b.WriteString(line[last:s.start])
+		kind := s.kind
+		if kind == "timestamp" || kind == "gotimestamp" {
+			kind += s.format
+		}
+		b.WriteString("\x00" + kind + "\x00")
+		last = s.end
+	}
+	b.WriteString(line[last:])
+	return b.String()
+}
+
+// defaultNames are the names for tokens of each kind when we can't tell what field they're in
+var defaultNames = map[string]string{"timestamp": "ts", "gotimestamp": "ts", "epochtimestamp": "ts", "guid": "guid", "mac": "mac",
+	"ipv4": "ip", "ipv6": "ip", "hex": "hex", "number": "num", "word": "word"}
+
+// Learn infers a sample called name from lines.  The sample's Lines are the original lines with
+// each varying value replaced by a template token.  Values with up to maxChoices distinct values
+// which repeat are learned as choices from the values seen.
+func Learn(name string, lines []string, maxChoices int) *config.Sample {
+	if maxChoices <= 0 {
+		maxChoices = DefaultMaxChoices
+	}
+	parsed := make([][]*slot, len(lines))
+	groups := make(map[string][]int)
+	var order []string
+	for i, line := range lines {
+		parsed[i] = parse(line)
+		sh := shape(line, parsed[i])
+		if _, ok := groups[sh]; !ok {
+			order = append(order, sh)
+		}
+		groups[sh] = append(groups[sh], i)
+	}
+
+	var tokens []*learned
+	byID := make(map[string]*learned)
+	lookup := func(id, base, kind string, s *slot) *learned {
+		if l, ok := byID[id]; ok {
+			return l
+		}
+		l := &learned{name: base, kind: kind, format: s.format, layout: s.layout, counts: make(map[string]int)}
+		byID[id] = l
+		tokens = append(tokens, l)
+		return l
+	}
+
+	for g, sh := range order {
+		members := groups[sh]
+		for pos := range parsed[members[0]] {
+			first := parsed[members[0]][pos]
+			// Words are only values if they vary between lines of the same shape
+			if first.kind == "word" {
+				varies := false
+				for _, i := range members {
+					if parsed[i][pos].value != first.value {
+						varies = true
+						break
+					}
+				}
+				if !varies {
+					continue
+				}
+			}
+			// Values in named fields and timestamps are shared between shapes, others are particular to theirs
+			kind := first.kind
+			if kind == "timestamp" || kind == "gotimestamp" {
+				kind += first.format
+			}
+			var id, base string
+			switch {
+			case first.key != "":
+				id, base = "key/"+first.key+"/"+kind, first.key
+			case first.kind == "timestamp" || first.kind == "gotimestamp" || first.kind == "epochtimestamp":
+				id, base = "ts/"+kind, "ts"
+			default:
+				id, base = fmt.Sprintf("shape/%d/%d", g, pos), defaultNames[first.kind]
+			}
+			// Named values can appear more than once in a line, each time is its own token
+			for n := 0; n < pos; n++ {
+				if prev := parsed[members[0]][n]; prev.token != nil && prev.token == byID[id] {
+					id += "/again"
+				}
+			}
+			l := lookup(id, base, first.kind, first)
+			for _, i := range members {
+				s := parsed[i][pos]
+				s.token = l
+				if l.counts[s.value] == 0 {
+					l.order = append(l.order, s.value)
+				}
+				l.counts[s.value]++
+				l.total++
+			}
+		}
+	}
+
+	sample := &config.Sample{Name: name, Description: "Learned from example lines", Interval: 1, Count: 1}
+	// Tokens are only named once we know which values vary, so the names don't skip numbers
+	names := make(map[string]bool)
+	for _, l := range tokens {
+		t := l.build(maxChoices)
+		if t == nil {
+			continue
+		}
+		base := l.name
+		for i := 2; names[l.name]; i++ {
+			l.name = base + strconv.Itoa(i)
+		}
+		names[l.name] = true
+		t.Name, t.Format, t.Token = l.name, "template", "$"+l.name+"$"
+		l.token = t
+		sample.Tokens = append(sample.Tokens, *t)
+	}
+	for i, line := range lines {
+		var b strings.Builder
+		last := 0
+		for _, s := range parsed[i] {
+			if s.token == nil || s.token.token == nil {
+				continue
+			}
+			b.WriteString(line[last:s.start])
+			b.WriteString(s.token.token.Token)
+			last = s.end
+		}
+		b.WriteString(line[last:])
+		sample.Lines = append(sample.Lines, map[string]string{"_raw": b.String()})
+	}
+	if count := estimateCount(tokens, len(lines)); count > 0 {
+		sample.Count = count
+	}
+	return sample
+}
+
+// build returns the token for the values learned, without its name, or nil if they're all the same
+// and so should be left as they are
+func (l *learned) build(maxChoices int) *config.Token {
+	t := &config.Token{}
+	switch l.kind {
+	case "timestamp", "gotimestamp", "epochtimestamp":
+		t.Type = l.kind
+		t.Replacement = l.format
+		return t
+	}
+	if len(l.counts) < 2 {
+		return nil
+	}
+	switch {
+	case l.kind == "guid":
+		t.Type, t.Replacement = "random", "guid"
+	case l.kind == "word" || (len(l.counts) <= maxChoices && l.total >= 2*len(l.counts)):
+		l.choices(t)
+	case l.kind == "mac":
+		t.Type, t.Replacement = "fake", "mac"
+	case l.kind == "ipv4" || l.kind == "ipv6":
+		t.Type, t.Replacement = "random", l.kind
+		t.AddressSpace = "private"
+		for v := range l.counts {
+			if !isPrivate(net.ParseIP(v)) {
+				t.AddressSpace = ""
+				break
+			}
+		}
+	case l.kind == "hex":
+		t.Type, t.Replacement = "random", "hex"
+		for v := range l.counts {
+			if len(v) > t.Length {
+				t.Length = len(v)
+			}
+		}
+	case l.kind == "number":
+		if !l.number(t) {
+			l.choices(t)
+		}
+	}
+	return t
+}
+
+// choices makes t pick from the values seen, weighted by how often they were seen if that varies
+func (l *learned) choices(t *config.Token) {
+	values := append([]string(nil), l.order...)
+	sort.SliceStable(values, func(i, j int) bool { return l.counts[values[i]] > l.counts[values[j]] })
+	even := true
+	for _, v := range values {
+		if l.counts[v] != l.counts[values[0]] {
+			even = false
+		}
+	}
+	if even {
+		t.Type = "choice"
+		t.Choice = values
+		return
+	}
+	t.Type = "weightedChoice"
+	for _, v := range values {
+		t.WeightedChoice = append(t.WeightedChoice, config.WeightedChoice{Weight: l.counts[v], Choice: v})
+	}
+}
+
+// number makes t a random int or float in the range seen, returning false if the values are too
+// large to generate
+func (l *learned) number(t *config.Token) bool {
+	min, max := math.Inf(1), math.Inf(-1)
+	precision := 0
+	for v := range l.counts {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f > math.MaxInt32 {
+			return false
+		}
+		min, max = math.Min(min, f), math.Max(max, f)
+		if dot := strings.IndexByte(v, '.'); dot >= 0 && len(v)-dot-1 > precision {
+			precision = len(v) - dot - 1
+		}
+	}
+	t.Type = "random"
+	if precision == 0 {
+		t.Replacement = "int"
+		t.Lower, t.Upper = int(min), int(max)+1
+		return true
+	}
+	t.Replacement = "float"
+	t.Precision = precision
+	t.Lower, t.Upper = int(math.Floor(min)), int(math.Ceil(max))
+	if t.Upper == t.Lower {
+		t.Upper++
+	}
+	return true
+}
+
+var privateNets = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"}
+
+func isPrivate(ip net.IP) bool {
+	for _, c := range privateNets {
+		_, n, _ := net.ParseCIDR(c)
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// estimateCount returns how many events a second the lines were logged at, from the span of the
+// first timestamp, or 0 if we can't tell
+func estimateCount(tokens []*learned, lines int) int {
+	for _, l := range tokens {
+		if l.kind != "timestamp" && l.kind != "gotimestamp" && l.kind != "epochtimestamp" {
+			continue
+		}
+		var first, last time.Time
+		for v := range l.counts {
+			var t time.Time
+			var err error
+			if l.kind == "epochtimestamp" {
+				var secs int64
+				secs, err = strconv.ParseInt(v, 10, 64)
+				t = time.Unix(secs, 0)
+			} else {
+				t, err = time.Parse(l.layout, v)
+			}
+			if err != nil {
+				continue
+			}
+			if first.IsZero() || t.Before(first) {
+				first = t
+			}
+			if t.After(last) {
+				last = t
+			}
+		}
+		span := last.Sub(first).Seconds()
+		if span < 1 {
+			return 0
+		}
+		count := int(float64(lines)/span + 0.5)
+		if count < 1 {
+			count = 1
+		}
+		return count
+	}
+	return 0
+}
+
+// Write writes the learned sample to dir as name.sample, holding its lines, and name.yml, holding
+// the rest of the sample which reads its lines from name.sample.  Running gogen with dir as its
+// samples directory generates from it.
+func Write(s *config.Sample, dir string) error {
+	var b strings.Builder
+	for _, l := range s.Lines {
+		b.WriteString(l["_raw"])
+		b.WriteString("\n")
+	}
+	linesFile := s.Name + ".sample"
+	if err := ioutil.WriteFile(filepath.Join(dir, linesFile), []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	out := *s
+	out.Lines = nil
+	out.FromSample = linesFile
+	outb, err := yaml.Marshal(&out)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, s.Name+".yml"), outb, 0644)
+}
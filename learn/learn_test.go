@@ -0,0 +1,119 @@
+package learn
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimestamps(t *testing.T) {
+	tests := []struct {
+		line   string
+		kind   string
+		format string
+	}{
+		{"2024-03-05T10:00:00.807Z hello", "gotimestamp", "2006-01-02T15:04:05.000Z07:00"},
+		{"2024-03-05 10:00:00,807 hello", "timestamp", "%Y-%m-%d %H:%M:%S,%L"},
+		{"2024/03/05 10:00:00 hello", "timestamp", "%Y/%m/%d %H:%M:%S"},
+		{"2024-03-05T10:00:00.123456+0100 hello", "timestamp", "%Y-%m-%dT%H:%M:%S.%f%z"},
+		{"2024-03-05T10:00:00+01:00 hello", "gotimestamp", "2006-01-02T15:04:05-07:00"},
+		{`1.2.3.4 - - [05/Mar/2024:10:00:00 +0000] "GET /"`, "timestamp", "%d/%b/%Y:%H:%M:%S %z"},
+		{"Tue Mar  5 10:00:00 2024 hello", "timestamp", "%a %b %e %H:%M:%S %Y"},
+		{"Mar  5 10:00:00 host sshd[123]: hello", "timestamp", "%b %e %H:%M:%S"},
+		{"time=1709632800 hello", "epochtimestamp", ""},
+	}
+	for _, test := range tests {
+		var found *slot
+		for _, s := range parse(test.line) {
+			if s.kind == test.kind {
+				found = s
+			}
+		}
+		if assert.NotNil(t, found, test.line) {
+			assert.Equal(t, test.format, found.format, test.line)
+		}
+	}
+}
+
+func TestParseKinds(t *testing.T) {
+	slots := parse(`id=3f2504e0-4f89-41d3-9a0c-0305e82c3301 mac=00:1a:2b:3c:4d:5e src=10.1.2.3 dst=fe80::1 hash=deadbeef01 n=42 f=1.5 code=007 msg="hi"`)
+	kinds := make(map[string]string)
+	for _, s := range slots {
+		if s.key != "" {
+			kinds[s.key] = s.kind
+		}
+	}
+	assert.Equal(t, map[string]string{"id": "guid", "mac": "mac", "src": "ipv4", "dst": "ipv6", "hash": "hex", "n": "number",
+		"f": "number", "code": "word", "msg": "word"}, kinds)
+}
+
+func TestLearn(t *testing.T) {
+	var lines []string
+	methods := []string{"GET", "GET", "GET", "POST"}
+	statuses := []string{"200", "200", "200", "404", "500"}
+	for i := 0; i < 100; i++ {
+		lines = append(lines, fmt.Sprintf(`10.0.%d.%d - - [05/Mar/2024:10:%02d:%02d +0000] "%s /item/%s HTTP/1.1" %s %d req=%08x-0000-4000-8000-%012x`,
+			i%7, i%13, i/60, i%60, methods[i%4], []string{"a", "b", "c"}[i%3], statuses[i%5], 100+i*37, i, i))
+	}
+	lines = append(lines, "Mar  5 10:02:00 web01 sshd[2201]: Server listening on 0.0.0.0 port 22")
+	s := Learn("web", lines, DefaultMaxChoices)
+
+	tokens := make(map[string]config.Token)
+	for _, tok := range s.Tokens {
+		tokens[tok.Name] = tok
+	}
+	assert.Equal(t, "random", tokens["ip"].Type)
+	assert.Equal(t, "ipv4", tokens["ip"].Replacement)
+	assert.Equal(t, "private", tokens["ip"].AddressSpace)
+	assert.Equal(t, "timestamp", tokens["ts"].Type)
+	assert.Equal(t, "%d/%b/%Y:%H:%M:%S %z", tokens["ts"].Replacement)
+	assert.Equal(t, "timestamp", tokens["ts2"].Type)
+	assert.Equal(t, "%b %e %H:%M:%S", tokens["ts2"].Replacement)
+	assert.Equal(t, "weightedChoice", tokens["word"].Type)
+	assert.Equal(t, []config.WeightedChoice{{Weight: 75, Choice: "GET"}, {Weight: 25, Choice: "POST"}}, tokens["word"].WeightedChoice)
+	assert.Equal(t, []config.WeightedChoice{{Weight: 34, Choice: "/item/a"}, {Weight: 33, Choice: "/item/b"}, {Weight: 33, Choice: "/item/c"}},
+		tokens["word2"].WeightedChoice)
+	assert.Equal(t, "weightedChoice", tokens["num"].Type)
+	assert.Equal(t, "random", tokens["num2"].Type)
+	assert.Equal(t, "int", tokens["num2"].Replacement)
+	assert.Equal(t, 100, tokens["num2"].Lower)
+	assert.Equal(t, 100+99*37+1, tokens["num2"].Upper)
+	assert.Equal(t, "guid", tokens["req"].Replacement)
+	assert.Equal(t, 8, len(s.Tokens))
+
+	assert.Equal(t, `$ip$ - - [$ts$] "$word$ $word2$ HTTP/1.1" $num$ $num2$ req=$req$`, s.Lines[0]["_raw"])
+	// Lines with nothing varying are left as they are, apart from their timestamps
+	assert.Equal(t, "$ts2$ web01 sshd[2201]: Server listening on 0.0.0.0 port 22", s.Lines[100]["_raw"])
+	// 101 lines over two minutes
+	assert.Equal(t, 1, s.Count)
+}
+
+func TestWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gogenlearn")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	var lines []string
+	for i := 0; i < 20; i++ {
+		lines = append(lines, fmt.Sprintf("2024-03-05 10:00:%02d level=%s user=user%d", i, []string{"INFO", "WARN"}[i%2], i%4))
+	}
+	s := Learn("app", lines, DefaultMaxChoices)
+	assert.NoError(t, Write(s, dir))
+	b, err := ioutil.ReadFile(filepath.Join(dir, "app.sample"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "$ts$ level=$level$ user=$user$\n")
+
+	// The written sample is ready to generate from with dir as the samples directory
+	os.Setenv("GOGEN_HOME", dir)
+	c := config.BuildConfig(config.ConfigConfig{ConfigDir: dir, SamplesDir: dir})
+	learned := c.FindSampleByName("app")
+	if assert.NotNil(t, learned) {
+		assert.False(t, learned.Disabled)
+		assert.Equal(t, 20, len(learned.Lines))
+		assert.Equal(t, 3, len(learned.Tokens))
+	}
+}
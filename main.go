@@ -1,15 +1,19 @@
 package main
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	config "github.com/coccyx/gogen/internal"
+	"github.com/coccyx/gogen/learn"
 	log "github.com/coccyx/gogen/logger"
+	"github.com/coccyx/gogen/outputter"
 	"github.com/coccyx/gogen/run"
 	"github.com/ghodss/yaml"
 	"github.com/olekukonko/tablewriter"
@@ -171,55 +175,99 @@ func main() {
 					Name:  "realtime, r",
 					Usage: "Set to real time, don't stop until killed",
 				},
+				cli.Int64Flag{
+					Name:  "seed",
+					Usage: "Seed random generation with `number` for reproducible output",
+				},
+				cli.Float64Flag{
+					Name:  "targetEPS",
+					Usage: "Generate at a total of `number` events per second, overriding count",
+				},
+				cli.Float64Flag{
+					Name:  "targetGBPerDay",
+					Usage: "Generate at a total of `number` GB per day, overriding count",
+				},
+				cli.StringFlag{
+					Name:  "metrics-addr",
+					Usage: "Serve Prometheus metrics at http://`address`/metrics, e.g. :9090",
+				},
+				cli.BoolFlag{
+					Name:  "watch",
+					Usage: "Watch config files and reload samples when they change, also done on SIGHUP",
+				},
+				cli.StringFlag{
+					Name:  "api-addr",
+					Usage: "Serve a REST API to control samples at http://`address`/api, e.g. :9091",
+				},
 			},
 			Action: func(clic *cli.Context) error {
 				if len(c.Samples) == 0 {
 					fmt.Printf("No samples configured, exiting\n")
 					os.Exit(1)
 				}
-				for i := 0; i < len(c.Samples); i++ {
+				if clic.Int64("seed") != 0 {
+					log.Infof("Setting seed to %d", clic.Int64("seed"))
+					c.Global.Seed = clic.Int64("seed")
+				}
+				if clic.Float64("targetEPS") > 0 {
+					log.Infof("Setting target events per second to %.2f", clic.Float64("targetEPS"))
+					c.Global.TargetEPS = clic.Float64("targetEPS")
+				}
+				if clic.Float64("targetGBPerDay") > 0 {
+					log.Infof("Setting target GB per day to %.2f", clic.Float64("targetGBPerDay"))
+					c.Global.TargetGBPerDay = clic.Float64("targetGBPerDay")
+				}
+				if len(clic.String("metrics-addr")) > 0 {
+					c.Global.MetricsAddr = clic.String("metrics-addr")
+				}
+				if len(clic.String("api-addr")) > 0 {
+					c.Global.APIAddr = clic.String("api-addr")
+				}
+				// Overrides are applied again to samples in a reloaded config
+				c.SampleOverrides = func(s *config.Sample) {
 					if clic.Int("interval") > 0 {
-						log.Infof("Setting interval to %d for sample '%s'", clic.Int("interval"), c.Samples[i].Name)
-						c.Samples[i].Interval = clic.Int("interval")
+						log.Infof("Setting interval to %d for sample '%s'", clic.Int("interval"), s.Name)
+						s.Interval = clic.Int("interval")
 					}
 					if clic.Int("endIntervals") > 0 {
 						log.Infof("Setting endIntervals to %d", clic.Int("endIntervals"))
-						c.Samples[i].EndIntervals = clic.Int("endIntervals")
-						config.ParseBeginEnd(c.Samples[i])
+						s.EndIntervals = clic.Int("endIntervals")
+						config.ParseBeginEnd(s)
 					}
 					if clic.Int("count") > 0 {
-						log.Infof("Setting count to %d for sample '%s'", clic.Int("count"), c.Samples[i].Name)
-						c.Samples[i].Count = clic.Int("count")
+						log.Infof("Setting count to %d for sample '%s'", clic.Int("count"), s.Name)
+						s.Count = clic.Int("count")
 					}
 					if len(clic.String("begin")) > 0 {
-						log.Infof("Setting begin to %s for sample '%s'", clic.String("begin"), c.Samples[i].Name)
-						c.Samples[i].Begin = clic.String("begin")
+						log.Infof("Setting begin to %s for sample '%s'", clic.String("begin"), s.Name)
+						s.Begin = clic.String("begin")
 					}
 					if len(clic.String("end")) > 0 {
-						log.Infof("Setting end to %s for sample '%s'", clic.String("end"), c.Samples[i].Name)
-						c.Samples[i].End = clic.String("end")
+						log.Infof("Setting end to %s for sample '%s'", clic.String("end"), s.Name)
+						s.End = clic.String("end")
 					}
 					if len(clic.String("begin")) > 0 || len(clic.String("end")) > 0 {
 						if clic.Int("endIntervals") == 0 {
-							c.Samples[i].EndIntervals = 0
+							s.EndIntervals = 0
 						}
-						config.ParseBeginEnd(c.Samples[i])
+						config.ParseBeginEnd(s)
 					}
 					if clic.Bool("realtime") {
 						if clic.Int("endIntervals") == 0 {
-							c.Samples[i].EndIntervals = 0
+							s.EndIntervals = 0
 						}
-						c.Samples[i].Realtime = true
+						s.Realtime = true
+					}
+					if len(clic.String("sample")) > 0 && s.Name != clic.String("sample") {
+						s.Disabled = true
 					}
 				}
 				if len(clic.String("sample")) > 0 {
 					log.Infof("Generating only for sample '%s'", clic.String("sample"))
 					matched := false
-					for i := 0; i < len(c.Samples); i++ {
-						if c.Samples[i].Name == clic.String("sample") {
+					for _, s := range c.Samples {
+						if s.Name == clic.String("sample") {
 							matched = true
-						} else {
-							c.Samples[i].Disabled = true
 						}
 					}
 					if !matched {
@@ -227,6 +275,12 @@ func main() {
 						os.Exit(1)
 					}
 				}
+				for _, s := range c.Samples {
+					c.SampleOverrides(s)
+				}
+				if clic.Bool("watch") {
+					c.Global.WatchConfig = true
+				}
 				run.Run(c)
 				return nil
 			},
@@ -263,6 +317,108 @@ func main() {
 				return nil
 			},
 		},
+		{
+			Name:  "learn",
+			Usage: "Infer a sample from a log file",
+			ArgsUsage: "[file]\n\n" + "Finds timestamps, IPs, GUIDs, numbers, hex strings and enumerations in the file's lines and writes a\n" +
+				"sample with tokens in their place to <name>.yml and <name>.sample in --dir.  Generate from it with\n" +
+				"gogen --samplesDir <dir> gen.",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "name, n",
+					Usage: "Name the sample `name`, defaults to the file's name",
+				},
+				cli.StringFlag{
+					Name:  "dir, d",
+					Value: ".",
+					Usage: "Write the sample to `directory`",
+				},
+				cli.IntFlag{
+					Name:  "maxChoices, m",
+					Value: learn.DefaultMaxChoices,
+					Usage: "Learn values with up to `number` distinct values as a choice of them",
+				},
+				cli.IntFlag{
+					Name:  "lines, l",
+					Value: 10000,
+					Usage: "Learn from the first `number` lines of the file",
+				},
+			},
+			Action: func(clic *cli.Context) error {
+				if len(clic.Args()) == 0 {
+					fmt.Println("Error: Must specify a file to learn from")
+					os.Exit(1)
+				}
+				filename := clic.Args().First()
+				f, err := os.Open(filename)
+				if err != nil {
+					log.WithError(err).Fatalf("Error opening file '%s'", filename)
+				}
+				defer f.Close()
+				var lines []string
+				scanner := bufio.NewScanner(f)
+				scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+				for scanner.Scan() && len(lines) < clic.Int("lines") {
+					if len(strings.TrimSpace(scanner.Text())) > 0 {
+						lines = append(lines, scanner.Text())
+					}
+				}
+				if err := scanner.Err(); err != nil {
+					log.WithError(err).Fatalf("Error reading file '%s'", filename)
+				}
+				name := clic.String("name")
+				if name == "" {
+					name = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+				}
+				s := learn.Learn(name, lines, clic.Int("maxChoices"))
+				if err := learn.Write(s, clic.String("dir")); err != nil {
+					log.WithError(err).Fatalf("Error writing sample '%s'", name)
+				}
+				fmt.Printf("Learned sample '%s' with %d tokens from %d lines, written to %s\n", name, len(s.Tokens), len(lines),
+					filepath.Join(clic.String("dir"), name+".yml"))
+				return nil
+			},
+		},
+		{
+			Name:  "replay-dlq",
+			Usage: "Resend batches spooled to an http output's dead letter file",
+			ArgsUsage: "[file]\n\n" + "Defaults to the deadLetterFile set in the running config.  Batches are sent to the endpoints they\n" +
+				"were originally destined for, or to --url if set, with the output's headers and --splunkHECToken.\n" +
+				"Batches which fail again are left in the file.",
+			Action: func(clic *cli.Context) error {
+				o := c.Global.Output
+				filename := o.DeadLetterFile
+				if len(clic.Args()) > 0 {
+					filename = clic.Args().First()
+				}
+				if len(filename) == 0 {
+					fmt.Println("Error: Must specify a dead letter file or set deadLetterFile in the output config")
+					os.Exit(1)
+				}
+				o.Endpoints = nil
+				if len(clic.GlobalString("url")) > 0 {
+					o.Endpoints = []string{clic.GlobalString("url")}
+				}
+				// Dead letters don't keep their headers, so they're sent with the config's
+				if len(clic.GlobalString("splunkHECToken")) > 0 {
+					headers := make(map[string]string, len(o.Headers)+1)
+					for k, v := range o.Headers {
+						headers[k] = v
+					}
+					headers["Authorization"] = "Splunk " + clic.GlobalString("splunkHECToken")
+					o.Headers = headers
+				}
+				sent, failed, err := outputter.ReplayDeadLetters(filename, &o)
+				if err != nil {
+					log.WithError(err).Fatalf("Error replaying dead letter file '%s'", filename)
+				}
+				fmt.Printf("Replayed %d batches from '%s', %d failed\n", sent, filename, failed)
+				if failed > 0 {
+					os.Exit(1)
+				}
+				return nil
+			},
+		},
 		{
 			Name:  "login",
 			Usage: "Login to GitHub",
@@ -444,7 +600,7 @@ func main() {
 		},
 		cli.StringFlag{
 			Name:   "outputter, o",
-			Usage:  "Use outputter `(stdout|devnull|file|http) for output",
+			Usage:  "Use outputter `(stdout|devnull|file|http|splunktcp|splunkhec|kafka|syslog)` for output",
 			EnvVar: "GOGEN_OUT",
 		},
 		cli.StringFlag{
@@ -0,0 +1,245 @@
+// Package metrics keeps counters, gauges and histograms about generation and output and exposes
+// them over HTTP in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/coccyx/gogen/logger"
+)
+
+// DefBuckets are the default latency histogram buckets, in seconds
+var DefBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var (
+	// EventsGenerated counts events handed to the output queue per sample
+	EventsGenerated = NewCounterVec("gogen_events_generated_total", "Events generated", "sample")
+	// EventsWritten counts events written by outputters per sample
+	EventsWritten = NewCounterVec("gogen_events_written_total", "Events written by outputters", "sample")
+	// BytesWritten counts bytes written by outputters per sample
+	BytesWritten = NewCounterVec("gogen_bytes_written_total", "Bytes written by outputters", "sample")
+	// OutputErrors counts errors returned from outputters per sample
+	OutputErrors = NewCounterVec("gogen_output_errors_total", "Errors returned by outputters", "sample")
+	// DestinationEventsWritten counts events written per output, for samples sent to several outputs
+	DestinationEventsWritten = NewCounterVec("gogen_destination_events_written_total", "Events written per output", "output")
+	// DestinationBytesWritten counts bytes written per output
+	DestinationBytesWritten = NewCounterVec("gogen_destination_bytes_written_total", "Bytes written per output", "output")
+	// DestinationErrors counts errors returned from outputters per output
+	DestinationErrors = NewCounterVec("gogen_destination_errors_total", "Errors returned by outputters per output", "output")
+	// GenLatency observes how long Generator.Gen takes per sample
+	GenLatency = NewHistogramVec("gogen_generator_gen_seconds", "Time spent in Generator.Gen", "sample", DefBuckets)
+	// SendLatency observes how long Outputter.Send takes per sample
+	SendLatency = NewHistogramVec("gogen_outputter_send_seconds", "Time spent in Outputter.Send", "sample", DefBuckets)
+)
+
+type collector interface {
+	write(w io.Writer)
+}
+
+var (
+	registry      = make(map[string]collector)
+	registryOrder []string
+	registryMutex sync.Mutex
+	serving       = make(map[string]bool)
+)
+
+func register(name string, c collector) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, ok := registry[name]; !ok {
+		registryOrder = append(registryOrder, name)
+	}
+	registry[name] = c
+}
+
+// CounterVec is a set of counters partitioned by a single label
+type CounterVec struct {
+	name   string
+	help   string
+	label  string
+	mutex  sync.Mutex
+	values map[string]float64
+}
+
+// NewCounterVec creates and registers a CounterVec
+func NewCounterVec(name string, help string, label string) *CounterVec {
+	c := &CounterVec{name: name, help: help, label: label, values: make(map[string]float64)}
+	register(name, c)
+	return c
+}
+
+// Add adds v to the counter for labelValue
+func (c *CounterVec) Add(labelValue string, v float64) {
+	c.mutex.Lock()
+	c.values[labelValue] += v
+	c.mutex.Unlock()
+}
+
+// Value returns the current value of the counter for labelValue
+func (c *CounterVec) Value(labelValue string) float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.values[labelValue]
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, lv := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %s\n", c.name, c.label, escape(lv), formatFloat(c.values[lv]))
+	}
+}
+
+// GaugeFunc is a gauge whose value is read from a function at scrape time
+type GaugeFunc struct {
+	name string
+	help string
+	f    func() float64
+}
+
+// NewGaugeFunc creates and registers a GaugeFunc, replacing any existing metric of the same name
+func NewGaugeFunc(name string, help string, f func() float64) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, f: f}
+	register(name, g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, g.help, g.name, g.name, formatFloat(g.f()))
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// HistogramVec is a set of histograms partitioned by a single label
+type HistogramVec struct {
+	name    string
+	help    string
+	label   string
+	buckets []float64
+	mutex   sync.Mutex
+	values  map[string]*histogram
+}
+
+// NewHistogramVec creates and registers a HistogramVec with the given upper bounds, which must be sorted
+func NewHistogramVec(name string, help string, label string, buckets []float64) *HistogramVec {
+	h := &HistogramVec{name: name, help: help, label: label, buckets: buckets, values: make(map[string]*histogram)}
+	register(name, h)
+	return h
+}
+
+// Observe adds a single observation to the histogram for labelValue
+func (h *HistogramVec) Observe(labelValue string, v float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	hist, ok := h.values[labelValue]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[labelValue] = hist
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		hist.counts[i]++
+	}
+	hist.sum += v
+	hist.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, lv := range keys {
+		hist := h.values[lv]
+		labels := fmt.Sprintf("%s=\"%s\"", h.label, escape(lv))
+		var cumulative uint64
+		for i, b := range h.buckets {
+			cumulative += hist.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", h.name, labels, formatFloat(b), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", h.name, labels, hist.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", h.name, labels, formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", h.name, labels, hist.count)
+	}
+}
+
+// Write writes all registered metrics in the Prometheus text format
+func Write(w io.Writer) {
+	registryMutex.Lock()
+	collectors := make([]collector, 0, len(registryOrder))
+	for _, name := range registryOrder {
+		collectors = append(collectors, registry[name])
+	}
+	registryMutex.Unlock()
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler returns an http.Handler which serves all registered metrics
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		Write(&buf)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(buf.Bytes())
+	})
+}
+
+// Serve starts serving metrics on addr at /metrics in the background.  Calling it again with the
+// same addr does nothing.
+func Serve(addr string) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if serving[addr] {
+		return
+	}
+	serving[addr] = true
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	log.Infof("Serving metrics at http://%s/metrics", addr)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Errorf("Error serving metrics on '%s': %s", addr, err)
+		}
+	}()
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func escape(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterVec(t *testing.T) {
+	c := NewCounterVec("test_counter_total", "A test counter", "sample")
+	c.Add("one", 1)
+	c.Add("one", 2)
+	c.Add(`we"ird`, 5)
+	assert.Equal(t, float64(3), c.Value("one"))
+
+	var buf bytes.Buffer
+	c.write(&buf)
+	assert.Equal(t, "# HELP test_counter_total A test counter\n# TYPE test_counter_total counter\n"+
+		"test_counter_total{sample=\"one\"} 3\ntest_counter_total{sample=\"we\\\"ird\"} 5\n", buf.String())
+}
+
+func TestHistogramVec(t *testing.T) {
+	h := NewHistogramVec("test_seconds", "A test histogram", "sample", []float64{0.1, 1})
+	h.Observe("s", 0.05)
+	h.Observe("s", 0.1)
+	h.Observe("s", 0.5)
+	h.Observe("s", 5)
+
+	var buf bytes.Buffer
+	h.write(&buf)
+	assert.Equal(t, "# HELP test_seconds A test histogram\n# TYPE test_seconds histogram\n"+
+		"test_seconds_bucket{sample=\"s\",le=\"0.1\"} 2\n"+
+		"test_seconds_bucket{sample=\"s\",le=\"1\"} 3\n"+
+		"test_seconds_bucket{sample=\"s\",le=\"+Inf\"} 4\n"+
+		"test_seconds_sum{sample=\"s\"} 5.65\n"+
+		"test_seconds_count{sample=\"s\"} 4\n", buf.String())
+}
+
+func TestHandler(t *testing.T) {
+	depth := 3
+	NewGaugeFunc("test_queue_depth", "A test gauge", func() float64 { return float64(depth) })
+	EventsWritten.Add("handler", 10)
+
+	ts := httptest.NewServer(Handler())
+	defer ts.Close()
+	resp, err := ts.Client().Get(ts.URL)
+	assert.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.True(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain"))
+	assert.Contains(t, string(body), "test_queue_depth 3\n")
+	assert.Contains(t, string(body), "gogen_events_written_total{sample=\"handler\"} 10\n")
+	assert.Contains(t, string(body), "# TYPE gogen_outputter_send_seconds histogram\n")
+
+	// Registering the same name again replaces the gauge
+	NewGaugeFunc("test_queue_depth", "A test gauge", func() float64 { return 7 })
+	var buf bytes.Buffer
+	Write(&buf)
+	assert.Contains(t, buf.String(), "test_queue_depth 7\n")
+	assert.Equal(t, 1, strings.Count(buf.String(), "# TYPE test_queue_depth"))
+}
@@ -2,13 +2,19 @@ package outputter
 
 import (
 	"io"
+	"sync"
 
 	config "github.com/coccyx/gogen/internal"
 )
 
+// bufMutex serializes writes from all output workers to the config's shared buffer
+var bufMutex sync.Mutex
+
 type buf struct{}
 
 func (foo buf) Send(item *config.OutQueueItem) error {
+	bufMutex.Lock()
+	defer bufMutex.Unlock()
 	_, err := io.Copy(item.S.Buf, item.IO.R)
 	return err
 }
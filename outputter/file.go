@@ -14,40 +14,76 @@ type file struct {
 	initialized bool
 	file        *os.File
 	fileSize    int64
-	mutex       *sync.Mutex
+	mutex       sync.Mutex
 	closed      bool
 }
 
+var (
+	filesMutex sync.Mutex
+	files      = make(map[string]*sharedFile)
+)
+
+// sharedFile is a file outputter shared by every output worker and sample writing to the same
+// file, so their writes are serialized.  The file is closed when the last of them closes it.
+type sharedFile struct {
+	*file
+	name string
+	refs int
+}
+
+// openFile returns the shared outputter for the named file
+func openFile(name string) config.Outputter {
+	filesMutex.Lock()
+	defer filesMutex.Unlock()
+	f, ok := files[name]
+	if !ok {
+		f = &sharedFile{file: new(file), name: name}
+		files[name] = f
+	}
+	f.refs++
+	return f
+}
+
+func (f *sharedFile) Close() error {
+	filesMutex.Lock()
+	defer filesMutex.Unlock()
+	f.refs--
+	if f.refs > 0 {
+		return nil
+	}
+	delete(files, f.name)
+	return f.file.Close()
+}
+
 func (f *file) Send(item *config.OutQueueItem) error {
+	// File output is the rare exception, we must be single threaded
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
 	if f.initialized == false {
-		info, err := os.Stat(item.S.Output.FileName)
+		info, err := os.Stat(item.Output.FileName)
 		// File doesn't exist, so create
 		if os.IsNotExist(err) {
-			f.file, err = os.Create(item.S.Output.FileName)
+			f.file, err = os.Create(item.Output.FileName)
 			if err != nil {
-				log.Panicf("Cannot create file referenced at '%s' for sample '%s' with error %s", item.S.Output.FileName, item.S.Name, err)
+				log.Panicf("Cannot create file referenced at '%s' for sample '%s' with error %s", item.Output.FileName, item.S.Name, err)
 			}
 			// We got an unexpected error from Stat
 		} else if err != nil {
-			log.Panicf("Cannot stat file referenced at '%s' for sample '%s' with error: %s", item.S.Output.FileName, item.S.Name, err)
+			log.Panicf("Cannot stat file referenced at '%s' for sample '%s' with error: %s", item.Output.FileName, item.S.Name, err)
 			// File exists, check the size and open it
 		} else {
 			f.fileSize = info.Size()
-			f.file, err = os.OpenFile(item.S.Output.FileName, os.O_APPEND|os.O_WRONLY, os.ModeAppend)
+			f.file, err = os.OpenFile(item.Output.FileName, os.O_APPEND|os.O_WRONLY, os.ModeAppend)
 			if err != nil {
-				log.Panicf("Cannot open file referenced at '%s' for sample '%s' with error: %s", item.S.Output.FileName, item.S.Name, err)
+				log.Panicf("Cannot open file referenced at '%s' for sample '%s' with error: %s", item.Output.FileName, item.S.Name, err)
 			}
 		}
-		f.mutex = &sync.Mutex{}
 		f.initialized = true
 	}
-	// File output is the rare exception, we must be single threaded
-	f.mutex.Lock()
-	defer f.mutex.Unlock()
 	bytes, err := io.Copy(f.file, item.IO.R)
 
 	f.fileSize += bytes
-	if f.fileSize >= item.S.Output.MaxBytes {
+	if f.fileSize >= item.Output.MaxBytes {
 		log.Infof("Reached %d bytes which exceeds MaxBytes for sample '%s', rotating files", f.fileSize, item.S.Name)
 		f.rotate(item)
 	}
@@ -55,7 +91,9 @@ func (f *file) Send(item *config.OutQueueItem) error {
 }
 
 func (f *file) Close() error {
-	if !f.closed {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if !f.closed && f.file != nil {
 		f.closed = true
 		return f.file.Close()
 	}
@@ -65,23 +103,23 @@ func (f *file) Close() error {
 func (f *file) rotate(item *config.OutQueueItem) {
 	f.file.Close()
 	// Remove the oldest file
-	_ = os.Remove(item.S.Output.FileName + "." + strconv.Itoa(item.S.Output.BackupFiles))
+	_ = os.Remove(item.Output.FileName + "." + strconv.Itoa(item.Output.BackupFiles))
 
 	// Rotate through all other files and move them to one older
-	for i := item.S.Output.BackupFiles; i > 1; i-- {
-		err := os.Rename(item.S.Output.FileName+"."+strconv.Itoa(i-1), item.S.Output.FileName+"."+strconv.Itoa(i))
+	for i := item.Output.BackupFiles; i > 1; i-- {
+		err := os.Rename(item.Output.FileName+"."+strconv.Itoa(i-1), item.Output.FileName+"."+strconv.Itoa(i))
 		if err != nil && !os.IsNotExist(err) {
-			log.Panicf("Could not rename '%s' to '%s' in sample '%s', err: %s", item.S.Output.FileName+"."+strconv.Itoa(i-1), item.S.Output.FileName+"."+strconv.Itoa(i), item.S.Name, err)
+			log.Panicf("Could not rename '%s' to '%s' in sample '%s', err: %s", item.Output.FileName+"."+strconv.Itoa(i-1), item.Output.FileName+"."+strconv.Itoa(i), item.S.Name, err)
 		}
 	}
 
-	err := os.Rename(item.S.Output.FileName, item.S.Output.FileName+".1")
+	err := os.Rename(item.Output.FileName, item.Output.FileName+".1")
 	if err != nil && !os.IsNotExist(err) {
-		log.Panicf("Could not rename '%s' to '%s' in sample '%s', err: %s", item.S.Output.FileName, item.S.Output.FileName+".1", item.S.Name, err)
+		log.Panicf("Could not rename '%s' to '%s' in sample '%s', err: %s", item.Output.FileName, item.Output.FileName+".1", item.S.Name, err)
 	}
-	f.file, err = os.Create(item.S.Output.FileName)
+	f.file, err = os.Create(item.Output.FileName)
 	if err != nil {
-		log.Panicf("Cannot create file referenced at '%s' for sample '%s' with error %s", item.S.Output.FileName, item.S.Name, err)
+		log.Panicf("Cannot create file referenced at '%s' for sample '%s' with error %s", item.Output.FileName, item.S.Name, err)
 	}
 	f.fileSize = 0
 }
@@ -2,91 +2,310 @@ package outputter
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/tls"
+	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
 
 	config "github.com/coccyx/gogen/internal"
 	log "github.com/coccyx/gogen/logger"
 )
 
+// dlqMutex serializes writes to dead letter files across output workers
+var dlqMutex sync.Mutex
+
+// httpout buffers output until BufferBytes and then POSTs it, retrying with exponential backoff
+// and failing over across Output.Endpoints.  Batches which still fail are spooled to
+// Output.DeadLetterFile, if set, for replaying later with ReplayDeadLetters.
 type httpout struct {
-	buf         *bufio.Writer
-	r           *io.PipeReader
-	w           *io.PipeWriter
-	resp        *http.Response
+	buf         bytes.Buffer
+	client      *http.Client
+	policy      httpPolicy
 	initialized bool
 	closed      bool
 	lastS       *config.Sample
-	sent        int64
-	done        chan int
+	output      *config.Output
+	rand        *rand.Rand
+}
+
+// httpPolicy controls retries for a POST
+type httpPolicy struct {
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
 }
 
 func (h *httpout) Send(item *config.OutQueueItem) error {
 	if h.initialized == false {
-		h.newPost(item)
+		var err error
+		if h.client, h.policy, err = newHTTPClient(item.Output); err != nil {
+			return err
+		}
 		h.initialized = true
 	}
-	bytes, err := io.Copy(h.buf, item.IO.R)
+	_, err := io.Copy(&h.buf, item.IO.R)
 	if err != nil {
 		return err
 	}
+	h.lastS = item.S
+	h.output = item.Output
+	h.rand = item.Rand
 
-	h.sent += bytes
-	if h.sent > int64(item.S.Output.BufferBytes) {
-		err := h.buf.Flush()
-		if err != nil {
-			return err
-		}
-		err = h.w.Close()
-		if err != nil {
-			return err
-		}
-		h.newPost(item)
-		h.sent = 0
+	if h.buf.Len() > item.Output.BufferBytes {
+		return h.flush()
 	}
-	h.lastS = item.S
 	return nil
 }
 
 func (h *httpout) Close() error {
 	if !h.closed {
-		err := h.buf.Flush()
-		if err != nil {
-			return err
-		}
-		err = h.w.Close()
-		if err != nil {
-			return err
-		}
-		<-h.done
 		h.closed = true
+		if h.buf.Len() > 0 {
+			return h.flush()
+		}
 	}
 	return nil
 }
 
-func (h *httpout) newPost(item *config.OutQueueItem) {
-	h.r, h.w = io.Pipe()
-	h.buf = bufio.NewWriter(h.w)
+// flush POSTs the buffered batch, spooling it to the dead letter file if it can't be delivered
+func (h *httpout) flush() error {
+	body := make([]byte, h.buf.Len())
+	copy(body, h.buf.Bytes())
+	h.buf.Reset()
+
+	o := h.output
+	if len(o.Endpoints) == 0 {
+		return fmt.Errorf("No endpoints configured for http output for sample '%s'", h.lastS.Name)
+	}
+	_, _, err := httpSend(h.client, h.policy, o.Endpoints, o.Headers, body, h.rand.Intn(len(o.Endpoints)))
+	if err != nil {
+		err = fmt.Errorf("Error sending batch from sample '%s': %s", h.lastS.Name, err)
+		spoolDeadLetter(o, h.lastS.Name, o.Endpoints, body, err)
+	}
+	return err
+}
+
+// spoolDeadLetter writes a batch which couldn't be delivered to the output's dead letter file, if set.
+// Headers aren't written, as they usually carry credentials.
+func spoolDeadLetter(o *config.Output, sample string, endpoints []string, body []byte, err error) {
+	if o.DeadLetterFile == "" {
+		return
+	}
+	dl := deadLetter{
+		Time:      time.Now().Format(time.RFC3339),
+		Sample:    sample,
+		Endpoints: endpoints,
+		Body:      string(body),
+		Error:     err.Error(),
+	}
+	if dlerr := writeDeadLetters(o.DeadLetterFile, os.O_APPEND, []deadLetter{dl}); dlerr != nil {
+		log.Errorf("Error writing dead letter file '%s': %s", o.DeadLetterFile, dlerr)
+	} else {
+		log.Errorf("Spooled %d bytes from sample '%s' to dead letter file '%s'", len(body), sample, o.DeadLetterFile)
+	}
+}
 
-	endpoint := item.S.Output.Endpoints[rand.Intn(len(item.S.Output.Endpoints))]
+// newHTTPClient returns a client with the output's timeout and its retry policy
+func newHTTPClient(o *config.Output) (*http.Client, httpPolicy, error) {
+	var p httpPolicy
+	timeout, err := outputDuration("timeout", o.Timeout)
+	if err != nil {
+		return nil, p, err
+	}
+	if p.backoff, err = outputDuration("retryBackoff", o.RetryBackoff); err != nil {
+		return nil, p, err
+	}
+	if p.maxBackoff, err = outputDuration("maxBackoff", o.MaxBackoff); err != nil {
+		return nil, p, err
+	}
+	// Negative retries disables retrying
+	if o.Retries > 0 {
+		p.retries = o.Retries
+	}
 	tr := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
-	client := &http.Client{Transport: tr}
-	req, err := http.NewRequest("POST", endpoint, h.r)
-	for k, v := range item.S.Output.Headers {
+	return &http.Client{Transport: tr, Timeout: timeout}, p, nil
+}
+
+// outputDuration parses a duration setting from the output config, with empty meaning zero
+func outputDuration(name string, v string) (time.Duration, error) {
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s '%s' for output: %s", name, v, err)
+	}
+	return d, nil
+}
+
+// httpSend POSTs body, starting with endpoints[start] and moving to the next endpoint on each
+// retry.  Connection errors, 429 and 5xx responses are retried after an exponential backoff, or
+// after Retry-After if the server sends one with a 429 or 503.  It returns the endpoint which
+// accepted the request and the response body.
+func httpSend(client *http.Client, p httpPolicy, endpoints []string, headers map[string]string, body []byte, start int) (string, []byte, error) {
+	var err error
+	for try := 0; try <= p.retries; try++ {
+		endpoint := endpoints[(start+try)%len(endpoints)]
+		var wait time.Duration
+		var retry bool
+		var resp []byte
+		if resp, wait, retry, err = httpPost(client, endpoint, headers, body); err == nil {
+			return endpoint, resp, nil
+		}
+		if !retry || try == p.retries {
+			break
+		}
+		if wait == 0 {
+			wait = p.backoff << uint(try)
+			if p.maxBackoff > 0 && (wait > p.maxBackoff || wait <= 0) {
+				wait = p.maxBackoff
+			}
+		}
+		log.Infof("Retrying after %s: %s", wait, err)
+		time.Sleep(wait)
+	}
+	return "", nil, err
+}
+
+// httpPost makes a single POST, returning the response body, or on failure how long the server
+// asked us to wait and whether it should be retried
+func httpPost(client *http.Client, endpoint string, headers map[string]string, body []byte) ([]byte, time.Duration, bool, error) {
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, false, err
+	}
+	for k, v := range headers {
 		req.Header.Add(k, v)
 	}
-	h.done = make(chan int)
-	go func() {
-		h.resp, err = client.Do(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, true, fmt.Errorf("Error making request to endpoint '%s': %s", endpoint, err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return respBody, 0, false, nil
+	}
+	err = fmt.Errorf("Error making request to endpoint '%s', status '%d': %s", endpoint, resp.StatusCode, respBody)
+	var wait time.Duration
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		wait = retryAfter(resp.Header.Get("Retry-After"))
+	}
+	return nil, wait, resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// retryAfter parses a Retry-After header, which is either seconds or an HTTP date
+func retryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(time.Now()); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// deadLetter is a batch which couldn't be delivered, stored one JSON object per line
+type deadLetter struct {
+	Time      string   `json:"time"`
+	Sample    string   `json:"sample"`
+	Endpoints []string `json:"endpoints"`
+	Body      string   `json:"body"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// writeDeadLetters appends to or, with os.O_TRUNC, replaces the dead letter file
+func writeDeadLetters(filename string, mode int, dls []deadLetter) error {
+	dlqMutex.Lock()
+	defer dlqMutex.Unlock()
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|mode, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, dl := range dls {
+		b, err := json.Marshal(dl)
 		if err != nil {
-			log.Errorf("Error making request from sample '%s' to endpoint '%s': %s", item.S.Name, endpoint, err)
-		} else if h.resp.StatusCode != 200 {
-			body, _ := ioutil.ReadAll(h.resp.Body)
-			log.Errorf("Error making request from sample '%s' to endpoint '%s', status '%d': %s", item.S.Name, endpoint, h.resp.StatusCode, body)
+			f.Close()
+			return err
+		}
+		w.Write(b)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReplayDeadLetters resends every batch in a dead letter file using the retry settings and headers
+// from o, overriding their endpoints with o.Endpoints if set.  Batches which fail again are left in the
+// file and the file is removed once everything has been delivered.
+func ReplayDeadLetters(filename string, o *config.Output) (sent int, failed int, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0, 0, err
+	}
+	var dls []deadLetter
+	r := bufio.NewReader(f)
+	for {
+		line, rerr := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var dl deadLetter
+			if err := json.Unmarshal(line, &dl); err != nil {
+				f.Close()
+				return 0, 0, fmt.Errorf("Error parsing dead letter file '%s': %s", filename, err)
+			}
+			dls = append(dls, dl)
+		}
+		if rerr == io.EOF {
+			break
+		} else if rerr != nil {
+			f.Close()
+			return 0, 0, rerr
 		}
-		h.done <- 1
-	}()
+	}
+	f.Close()
+
+	client, p, err := newHTTPClient(o)
+	if err != nil {
+		return 0, 0, err
+	}
+	var remaining []deadLetter
+	for _, dl := range dls {
+		endpoints := dl.Endpoints
+		if len(o.Endpoints) > 0 {
+			endpoints = o.Endpoints
+		}
+		if len(endpoints) == 0 {
+			err = fmt.Errorf("No endpoints for dead letter from sample '%s'", dl.Sample)
+		} else {
+			_, _, err = httpSend(client, p, endpoints, o.Headers, []byte(dl.Body), 0)
+		}
+		if err != nil {
+			log.Errorf("Error replaying batch from sample '%s': %s", dl.Sample, err)
+			dl.Error = err.Error()
+			remaining = append(remaining, dl)
+			continue
+		}
+		sent++
+	}
+	if len(remaining) == 0 {
+		return sent, 0, os.Remove(filename)
+	}
+	return sent, len(remaining), writeDeadLetters(filename, os.O_TRUNC, remaining)
 }
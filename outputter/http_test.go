@@ -0,0 +1,173 @@
+package outputter
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+// testHTTPServer replies with each status in turn, then 200, and records the bodies it accepts and
+// their Authorization headers
+type testHTTPServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	statuses []int
+	requests int
+	bodies   []string
+	auths    []string
+}
+
+func newTestHTTPServer(statuses ...int) *testHTTPServer {
+	ts := &testHTTPServer{statuses: statuses}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		ts.mutex.Lock()
+		defer ts.mutex.Unlock()
+		ts.requests++
+		if len(ts.statuses) > 0 {
+			status := ts.statuses[0]
+			ts.statuses = ts.statuses[1:]
+			if status == http.StatusServiceUnavailable {
+				w.Header().Set("Retry-After", "1")
+			}
+			w.WriteHeader(status)
+			return
+		}
+		ts.bodies = append(ts.bodies, string(body))
+		ts.auths = append(ts.auths, r.Header.Get("Authorization"))
+	}))
+	return ts
+}
+
+func httpTestItem(s *config.Sample, body string) *config.OutQueueItem {
+	item := testItem(s, []map[string]string{{"_raw": body}})
+	item.IO = config.NewOutputIO()
+	go func() {
+		item.IO.W.Write([]byte(body))
+		item.IO.W.Close()
+	}()
+	return item
+}
+
+func httpTestSample(endpoints ...string) *config.Sample {
+	return &config.Sample{
+		Name: "httpsample",
+		Output: &config.Output{
+			Outputter:    "http",
+			Endpoints:    endpoints,
+			BufferBytes:  1,
+			Retries:      3,
+			RetryBackoff: "10ms",
+			MaxBackoff:   "20ms",
+			Timeout:      "2s",
+		},
+	}
+}
+
+func TestHTTPRetry(t *testing.T) {
+	ts := newTestHTTPServer(http.StatusInternalServerError, http.StatusTooManyRequests)
+	defer ts.Close()
+	h := new(httpout)
+	assert.NoError(t, h.Send(httpTestItem(httpTestSample(ts.URL), "event1")))
+	assert.NoError(t, h.Close())
+	assert.Equal(t, 3, ts.requests)
+	assert.Equal(t, []string{"event1"}, ts.bodies)
+
+	// Retry-After on a 503 should be honored instead of our backoff
+	ts = newTestHTTPServer(http.StatusServiceUnavailable)
+	defer ts.Close()
+	h = new(httpout)
+	start := time.Now()
+	assert.NoError(t, h.Send(httpTestItem(httpTestSample(ts.URL), "event2")))
+	assert.True(t, time.Since(start) >= time.Second)
+	assert.Equal(t, []string{"event2"}, ts.bodies)
+
+	// Client errors aren't retried
+	ts = newTestHTTPServer(http.StatusBadRequest)
+	defer ts.Close()
+	h = new(httpout)
+	assert.Error(t, h.Send(httpTestItem(httpTestSample(ts.URL), "event3")))
+	assert.Equal(t, 1, ts.requests)
+}
+
+func TestHTTPFailover(t *testing.T) {
+	bad := newTestHTTPServer(http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	defer bad.Close()
+	good := newTestHTTPServer()
+	defer good.Close()
+	h := new(httpout)
+	assert.NoError(t, h.Send(httpTestItem(httpTestSample(bad.URL, good.URL), "event")))
+	assert.Equal(t, []string{"event"}, good.bodies)
+	assert.True(t, bad.requests <= 1)
+}
+
+func TestHTTPDeadLetter(t *testing.T) {
+	dlq := filepath.Join(os.TempDir(), "gogen_http_dlq_test.json")
+	os.Remove(dlq)
+	defer os.Remove(dlq)
+
+	ts := newTestHTTPServer(500, 500, 500, 500, 500, 500, 500, 500)
+	defer ts.Close()
+	s := httpTestSample(ts.URL)
+	s.Output.DeadLetterFile = dlq
+	s.Output.Headers = map[string]string{"Authorization": "Splunk token"}
+	h := new(httpout)
+	assert.Error(t, h.Send(httpTestItem(s, "lost1")))
+	assert.Error(t, h.Send(httpTestItem(s, "lost2")))
+	assert.Empty(t, ts.bodies)
+
+	b, err := ioutil.ReadFile(dlq)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(b), "\n"))
+	// Credentials in headers aren't written to disk, replays use the headers of the current config
+	assert.NotContains(t, string(b), "Splunk token")
+
+	// Replay with the original endpoint, which has recovered
+	o := &config.Output{Retries: 1, RetryBackoff: "10ms", Headers: map[string]string{"Authorization": "Splunk newtoken"}}
+	sent, failed, err := ReplayDeadLetters(dlq, o)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	assert.Equal(t, 0, failed)
+	assert.Equal(t, []string{"lost1", "lost2"}, ts.bodies)
+	assert.Equal(t, []string{"Splunk newtoken", "Splunk newtoken"}, ts.auths)
+	_, err = os.Stat(dlq)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestReplayDeadLettersFailure(t *testing.T) {
+	dlq := filepath.Join(os.TempDir(), "gogen_http_dlq_fail_test.json")
+	defer os.Remove(dlq)
+	dls := []deadLetter{{Sample: "one", Body: "a"}, {Sample: "two", Body: "b"}}
+	assert.NoError(t, writeDeadLetters(dlq, os.O_TRUNC, dls))
+
+	ts := newTestHTTPServer(http.StatusForbidden)
+	defer ts.Close()
+	sent, failed, err := ReplayDeadLetters(dlq, &config.Output{Endpoints: []string{ts.URL}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, []string{"b"}, ts.bodies)
+
+	b, err := ioutil.ReadFile(dlq)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(b), "\n"))
+	assert.Contains(t, string(b), `"sample":"one"`)
+	assert.Contains(t, string(b), "status '403'")
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, 5*time.Second, retryAfter("5"))
+	assert.Equal(t, time.Duration(0), retryAfter(""))
+	assert.Equal(t, time.Duration(0), retryAfter("bogus"))
+	d := retryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	assert.True(t, d > 59*time.Minute && d <= time.Hour)
+}
@@ -0,0 +1,310 @@
+package outputter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	log "github.com/coccyx/gogen/logger"
+)
+
+const (
+	kafkaClientID        = "gogen"
+	kafkaTimeout         = 10 * time.Second
+	kafkaMetadataTries   = 5
+	kafkaMetadataBackoff = 500 * time.Millisecond
+)
+
+// kafka produces events directly to Kafka brokers.  Output.Endpoints are the bootstrap brokers,
+// partition leaders are discovered through Metadata requests and each batch of events is sent
+// as one record batch per partition.
+type kafka struct {
+	initialized   bool
+	closed        bool
+	conns         map[string]net.Conn
+	brokers       map[int32]string
+	topics        map[string][]kafkaPartition
+	correlationID int32
+}
+
+func (k *kafka) Send(item *config.OutQueueItem) error {
+	if !k.initialized {
+		k.conns = make(map[string]net.Conn)
+		k.brokers = make(map[int32]string)
+		k.topics = make(map[string][]kafkaPartition)
+		k.initialized = true
+	}
+	o := item.Output
+	topic := item.S.Topic
+	if topic == "" {
+		topic = o.Topic
+	}
+	if topic == "" {
+		topic = item.S.Name
+	}
+	keyField := item.S.KeyField
+	if keyField == "" {
+		keyField = o.KeyField
+	}
+	compression, err := kafkaCompression(o.Compression)
+	if err != nil {
+		return err
+	}
+	acks, err := kafkaAcks(o.Acks)
+	if err != nil {
+		return err
+	}
+
+	partitions, err := k.partitions(item, topic, false)
+	if err != nil {
+		return err
+	}
+
+	// Build messages and assign them to partitions
+	var bytes int64
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	msgs := make(map[int32][]kafkaMessage)
+	for _, line := range item.Events {
+		var key []byte
+		if keyField != "" {
+			if v, ok := line[keyField]; ok {
+				key = []byte(v)
+			}
+		}
+		// Events without a partition field or key are spread over the partitions like keyless messages
+		var p kafkaPartition
+		if o.PartitionField != "" && line[o.PartitionField] != "" {
+			p = partitions[kafkaPartitionFor([]byte(line[o.PartitionField]), len(partitions))]
+		} else if len(key) > 0 {
+			p = partitions[kafkaPartitionFor(key, len(partitions))]
+		} else {
+			p = partitions[item.Rand.Intn(len(partitions))]
+		}
+		value, err := formatEvent(item.Output, line)
+		if err != nil {
+			log.Errorf("Error formatting event for sample '%s': %s", item.S.Name, err)
+			continue
+		}
+		msgs[p.id] = append(msgs[p.id], kafkaMessage{key: key, value: value, timestamp: now})
+		bytes += int64(len(value))
+	}
+
+	failed, err := k.produce(item, topic, partitions, msgs, compression, acks)
+	if err == nil && len(failed) > 0 {
+		// Leadership may have moved, refresh metadata and try the failed partitions once more
+		log.Infof("Retrying %d partitions for topic '%s' after refreshing metadata", len(failed), topic)
+		if partitions, err = k.partitions(item, topic, true); err != nil {
+			return err
+		}
+		retry := make(map[int32][]kafkaMessage)
+		for _, f := range failed {
+			retry[f.partition] = msgs[f.partition]
+		}
+		failed, err = k.produce(item, topic, partitions, retry, compression, acks)
+		if err == nil && len(failed) > 0 {
+			err = fmt.Errorf("Error producing to topic '%s' partition %d for sample '%s': error code %d", topic, failed[0].partition, item.S.Name, failed[0].err)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	Account(item, int64(len(item.Events)), bytes)
+	return nil
+}
+
+func (k *kafka) Close() error {
+	if !k.closed {
+		for addr, conn := range k.conns {
+			conn.Close()
+			delete(k.conns, addr)
+		}
+		k.closed = true
+	}
+	return nil
+}
+
+// sendsEvents implements eventSender
+func (k *kafka) sendsEvents() {}
+
+// produce sends one Produce request to each partition leader involved, returning partitions
+// which failed with a retriable error
+func (k *kafka) produce(item *config.OutQueueItem, topic string, partitions []kafkaPartition, msgs map[int32][]kafkaMessage, compression int16, acks int16) ([]kafkaProduceError, error) {
+	leaders := make(map[int32]int32, len(partitions))
+	for _, p := range partitions {
+		leaders[p.id] = p.leader
+	}
+	byLeader := make(map[int32]map[string]map[int32][]byte)
+	for p, m := range msgs {
+		batch, err := kafkaRecordBatch(m, compression)
+		if err != nil {
+			return nil, err
+		}
+		leader := leaders[p]
+		if byLeader[leader] == nil {
+			byLeader[leader] = map[string]map[int32][]byte{topic: make(map[int32][]byte)}
+		}
+		byLeader[leader][topic][p] = batch
+	}
+
+	var failed []kafkaProduceError
+	for leader, batches := range byLeader {
+		addr, ok := k.brokers[leader]
+		if !ok {
+			return nil, fmt.Errorf("No broker address known for leader %d of topic '%s'", leader, topic)
+		}
+		body := kafkaProduceRequest(acks, int32(kafkaTimeout/time.Millisecond), batches)
+		resp, err := k.roundTrip(addr, kafkaAPIProduce, kafkaProduceVersion, body, acks != 0)
+		if err != nil {
+			return nil, err
+		}
+		if acks == 0 {
+			continue
+		}
+		errs, err := kafkaProduceResponse(resp)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range errs {
+			switch e.err {
+			case kafkaErrNotLeaderForPartition, kafkaErrLeaderNotAvailable, kafkaErrUnknownTopicOrPartition:
+				failed = append(failed, e)
+			default:
+				return nil, fmt.Errorf("Error producing to topic '%s' partition %d for sample '%s': error code %d", e.topic, e.partition, item.S.Name, e.err)
+			}
+		}
+	}
+	return failed, nil
+}
+
+// partitions returns the partitions of topic, fetching metadata from the bootstrap brokers if
+// we don't have it cached or refresh is set
+func (k *kafka) partitions(item *config.OutQueueItem, topic string, refresh bool) ([]kafkaPartition, error) {
+	if p, ok := k.topics[topic]; ok && !refresh {
+		return p, nil
+	}
+	endpoints := item.Output.Endpoints
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("No endpoints configured for kafka output for sample '%s'", item.S.Name)
+	}
+	var lastErr error
+	for try := 0; try < kafkaMetadataTries; try++ {
+		if try > 0 {
+			time.Sleep(kafkaMetadataBackoff)
+		}
+		addr := endpoints[item.Rand.Intn(len(endpoints))]
+		resp, err := k.roundTrip(addr, kafkaAPIMetadata, kafkaMetadataVersion, kafkaMetadataRequest([]string{topic}), true)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		brokers, topics, err := kafkaMetadataResponse(resp)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, b := range brokers {
+			k.brokers[b.id] = b.addr
+		}
+		lastErr = fmt.Errorf("Topic '%s' not found in metadata from '%s'", topic, addr)
+		for _, t := range topics {
+			if t.name != topic {
+				continue
+			}
+			// A freshly auto created topic returns LEADER_NOT_AVAILABLE until leaders are elected
+			if t.err != 0 || len(t.partitions) == 0 {
+				lastErr = fmt.Errorf("Error fetching metadata for topic '%s': error code %d", topic, t.err)
+				break
+			}
+			lastErr = nil
+			for _, p := range t.partitions {
+				if p.err != 0 && p.err != kafkaErrLeaderNotAvailable {
+					lastErr = fmt.Errorf("Error fetching metadata for topic '%s' partition %d: error code %d", topic, p.id, p.err)
+				} else if p.leader < 0 {
+					lastErr = fmt.Errorf("No leader for topic '%s' partition %d", topic, p.id)
+				}
+			}
+			if lastErr == nil {
+				// Brokers don't promise any order, and keys hash to a partition id
+				sort.Slice(t.partitions, func(i, j int) bool { return t.partitions[i].id < t.partitions[j].id })
+				k.topics[topic] = t.partitions
+				return t.partitions, nil
+			}
+		}
+	}
+	return nil, lastErr
+}
+
+// roundTrip writes a request to the broker at addr and, if expectResponse is set, reads back the
+// response body following the correlation id.  Connections are dropped on any error so the next
+// request reconnects.
+func (k *kafka) roundTrip(addr string, apiKey int16, apiVersion int16, body []byte, expectResponse bool) ([]byte, error) {
+	conn, ok := k.conns[addr]
+	if !ok {
+		var err error
+		conn, err = net.DialTimeout("tcp", addr, 2*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		k.conns[addr] = conn
+	}
+	fail := func(err error) ([]byte, error) {
+		conn.Close()
+		delete(k.conns, addr)
+		return nil, fmt.Errorf("Error communicating with kafka broker '%s': %s", addr, err)
+	}
+	k.correlationID++
+	conn.SetDeadline(time.Now().Add(kafkaTimeout + 5*time.Second))
+	if _, err := conn.Write(kafkaRequest(apiKey, apiVersion, k.correlationID, kafkaClientID, body)); err != nil {
+		return fail(err)
+	}
+	if !expectResponse {
+		return nil, nil
+	}
+	var size int32
+	if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+		return fail(err)
+	}
+	if size < 4 {
+		return fail(fmt.Errorf("invalid response size %d", size))
+	}
+	resp := make([]byte, size)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return fail(err)
+	}
+	if cid := int32(binary.BigEndian.Uint32(resp)); cid != k.correlationID {
+		return fail(fmt.Errorf("correlation id mismatch, expected %d got %d", k.correlationID, cid))
+	}
+	return resp[4:], nil
+}
+
+func kafkaCompression(compression string) (int16, error) {
+	switch compression {
+	case "", "none":
+		return kafkaCompressionNone, nil
+	case "gzip":
+		return kafkaCompressionGzip, nil
+	case "snappy":
+		return kafkaCompressionSnappy, nil
+	}
+	return 0, fmt.Errorf("Unsupported kafka compression '%s'", compression)
+}
+
+func kafkaAcks(acks string) (int16, error) {
+	switch acks {
+	case "none":
+		return 0, nil
+	case "", "leader":
+		return 1, nil
+	case "all":
+		return -1, nil
+	}
+	if v, err := strconv.Atoi(acks); err == nil && v >= -1 && v <= 1 {
+		return int16(v), nil
+	}
+	return 0, fmt.Errorf("Unsupported kafka acks '%s', should be none, leader or all", acks)
+}
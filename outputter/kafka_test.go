@@ -0,0 +1,469 @@
+package outputter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeKafka is an in-process stand in for a Kafka broker which understands the Metadata and
+// Produce requests the kafka outputter sends
+type fakeKafka struct {
+	l          net.Listener
+	partitions int
+	reversed   bool // list partitions in descending id order in metadata responses
+	mutex      sync.Mutex
+	received   map[string]map[int32][]kafkaMessage
+	codecs     []int16
+	acks       []int16
+	errs       []error
+}
+
+func newFakeKafka(t *testing.T, partitions int) *fakeKafka {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %s", err)
+	}
+	f := &fakeKafka{l: l, partitions: partitions, received: make(map[string]map[int32][]kafkaMessage)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeKafka) addr() string {
+	return f.l.Addr().String()
+}
+
+// close stops the listener and synchronizes with the serving goroutines, so results can be inspected
+func (f *fakeKafka) close() {
+	f.l.Close()
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+}
+
+func (f *fakeKafka) fail(err error) {
+	f.mutex.Lock()
+	f.errs = append(f.errs, err)
+	f.mutex.Unlock()
+}
+
+func (f *fakeKafka) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var size int32
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return
+		}
+		req := make([]byte, size)
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+		d := &kafkaDecoder{b: req}
+		apiKey := d.int16()
+		apiVersion := d.int16()
+		correlationID := d.int32()
+		d.string() // client_id
+
+		e := &kafkaEncoder{}
+		e.putInt32(correlationID)
+		switch apiKey {
+		case kafkaAPIMetadata:
+			if apiVersion != kafkaMetadataVersion {
+				f.fail(fmt.Errorf("unexpected metadata version %d", apiVersion))
+			}
+			var topics []string
+			for n := d.int32(); n > 0; n-- {
+				topics = append(topics, d.string())
+			}
+			host, port, _ := net.SplitHostPort(f.addr())
+			portnum, _ := strconv.Atoi(port)
+			e.putInt32(0) // throttle_time_ms
+			e.putInt32(1)
+			e.putInt32(0)
+			e.putString(host)
+			e.putInt32(int32(portnum))
+			e.putNullString() // rack
+			e.putNullString() // cluster_id
+			e.putInt32(0)     // controller_id
+			e.putInt32(int32(len(topics)))
+			for _, t := range topics {
+				e.putInt16(0)
+				e.putString(t)
+				e.putInt8(0)
+				e.putInt32(int32(f.partitions))
+				for i := 0; i < f.partitions; i++ {
+					p := i
+					if f.reversed {
+						p = f.partitions - 1 - i
+					}
+					e.putInt16(0)
+					e.putInt32(int32(p))
+					e.putInt32(0) // leader
+					e.putInt32(1) // replicas
+					e.putInt32(0)
+					e.putInt32(1) // isr
+					e.putInt32(0)
+				}
+			}
+		case kafkaAPIProduce:
+			if apiVersion != kafkaProduceVersion {
+				f.fail(fmt.Errorf("unexpected produce version %d", apiVersion))
+			}
+			d.string() // transactional_id
+			acks := d.int16()
+			d.int32() // timeout
+			f.mutex.Lock()
+			f.acks = append(f.acks, acks)
+			f.mutex.Unlock()
+			topicCount := d.int32()
+			e.putInt32(topicCount)
+			for ; topicCount > 0; topicCount-- {
+				topic := d.string()
+				e.putString(topic)
+				np := d.int32()
+				e.putInt32(np)
+				for ; np > 0; np-- {
+					p := d.int32()
+					batch := d.bytes()
+					if err := f.readBatch(topic, p, batch); err != nil {
+						f.fail(err)
+					}
+					e.putInt32(p)
+					e.putInt16(0)
+					e.putInt64(0)
+					e.putInt64(-1)
+				}
+			}
+			e.putInt32(0) // throttle_time_ms
+			if acks == 0 {
+				continue
+			}
+		}
+		if d.err != nil {
+			f.fail(d.err)
+			return
+		}
+		resp := &kafkaEncoder{}
+		resp.putBytes(e.Bytes())
+		conn.Write(resp.Bytes())
+	}
+}
+
+func (f *fakeKafka) readBatch(topic string, p int32, batch []byte) error {
+	d := &kafkaDecoder{b: batch}
+	d.int64() // base_offset
+	if l := d.int32(); int(l) != len(batch)-12 {
+		return fmt.Errorf("batch length %d does not match %d", l, len(batch)-12)
+	}
+	d.int32() // partition_leader_epoch
+	if magic := d.int8(); magic != 2 {
+		return fmt.Errorf("unexpected magic %d", magic)
+	}
+	crc := uint32(d.int32())
+	if crc32.Checksum(batch[d.off:], crc32c) != crc {
+		return fmt.Errorf("crc mismatch")
+	}
+	codec := d.int16() & 7
+	d.int32() // last_offset_delta
+	baseTimestamp := d.int64()
+	d.int64() // max_timestamp
+	d.int64() // producer_id
+	d.int16() // producer_epoch
+	d.int32() // base_sequence
+	count := d.int32()
+	records := batch[d.off:]
+	switch codec {
+	case kafkaCompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(records))
+		if err != nil {
+			return err
+		}
+		if records, err = ioutil.ReadAll(r); err != nil {
+			return err
+		}
+	case kafkaCompressionSnappy:
+		var err error
+		if records, err = snappyXerialDecode(records); err != nil {
+			return err
+		}
+	}
+	rd := &kafkaDecoder{b: records}
+	var msgs []kafkaMessage
+	for i := int32(0); i < count; i++ {
+		rd.varint() // length
+		rd.int8()   // attributes
+		ts := rd.varint()
+		if offset := rd.varint(); offset != int64(i) {
+			return fmt.Errorf("unexpected offset delta %d", offset)
+		}
+		key := rd.varBytes()
+		value := rd.varBytes()
+		rd.varint() // headers
+		msgs = append(msgs, kafkaMessage{key: key, value: value, timestamp: baseTimestamp + ts})
+	}
+	if rd.err != nil {
+		return rd.err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.codecs = append(f.codecs, codec)
+	if f.received[topic] == nil {
+		f.received[topic] = make(map[int32][]kafkaMessage)
+	}
+	f.received[topic][p] = append(f.received[topic][p], msgs...)
+	return d.err
+}
+
+func snappyXerialDecode(src []byte) ([]byte, error) {
+	if !bytes.HasPrefix(src, snappyXerialHeader) {
+		return nil, fmt.Errorf("missing xerial header")
+	}
+	src = src[len(snappyXerialHeader)+8:]
+	var ret []byte
+	for len(src) > 0 {
+		l := int(binary.BigEndian.Uint32(src))
+		block, err := snappyDecode(src[4 : 4+l])
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, block...)
+		src = src[4+l:]
+	}
+	return ret, nil
+}
+
+func snappyDecode(src []byte) ([]byte, error) {
+	l, n := binary.Uvarint(src)
+	src = src[n:]
+	dst := make([]byte, 0, l)
+	for len(src) > 0 {
+		switch src[0] & 3 {
+		case 0:
+			length := int(src[0] >> 2)
+			src = src[1:]
+			if length >= 60 {
+				nb := length - 59
+				length = 0
+				for i := 0; i < nb; i++ {
+					length |= int(src[i]) << (8 * uint(i))
+				}
+				src = src[nb:]
+			}
+			length++
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+		default:
+			var length, offset int
+			switch src[0] & 3 {
+			case 1:
+				length = int(src[0]>>2&7) + 4
+				offset = int(src[0]&0xe0)<<3 | int(src[1])
+				src = src[2:]
+			case 2:
+				length = int(src[0]>>2) + 1
+				offset = int(src[1]) | int(src[2])<<8
+				src = src[3:]
+			case 3:
+				length = int(src[0]>>2) + 1
+				offset = int(binary.LittleEndian.Uint32(src[1:]))
+				src = src[5:]
+			}
+			if offset <= 0 || offset > len(dst) {
+				return nil, fmt.Errorf("invalid snappy copy offset %d", offset)
+			}
+			for i := 0; i < length; i++ {
+				dst = append(dst, dst[len(dst)-offset])
+			}
+		}
+	}
+	if uint64(len(dst)) != l {
+		return nil, fmt.Errorf("decoded length %d does not match %d", len(dst), l)
+	}
+	return dst, nil
+}
+
+func TestKafkaOutput(t *testing.T) {
+	startTestStats()
+	for codec, compression := range []string{"none", "gzip", "snappy"} {
+		f := newFakeKafka(t, 4)
+		s := &config.Sample{
+			Name:     "kafkasample",
+			KeyField: "host",
+			Output: &config.Output{
+				Outputter:      "kafka",
+				OutputTemplate: "raw",
+				Endpoints:      []string{f.addr()},
+				Topic:          "globaltopic",
+				Compression:    compression,
+				Acks:           "all",
+			},
+		}
+		events := make([]map[string]string, 0, 100)
+		for i := 0; i < 100; i++ {
+			events = append(events, map[string]string{"_raw": fmt.Sprintf("event %d %s", i, compression), "host": "host" + strconv.Itoa(i%10)})
+		}
+		k := new(kafka)
+		err := k.Send(testItem(s, events))
+		assert.NoError(t, err)
+		k.Close()
+		f.close()
+
+		assert.Empty(t, f.errs)
+		assert.NotEmpty(t, f.acks)
+		assert.Equal(t, int16(-1), f.acks[0])
+		assert.Equal(t, int16(codec), f.codecs[0])
+		total := 0
+		for p, msgs := range f.received["globaltopic"] {
+			for _, m := range msgs {
+				// Keyed messages should land on the partition the Java client would choose
+				assert.Equal(t, kafkaPartitionFor(m.key, 4), int(p))
+				total++
+			}
+		}
+		assert.Equal(t, 100, total, "compression %s", compression)
+	}
+}
+
+func TestKafkaPartitionMetadataOrder(t *testing.T) {
+	startTestStats()
+	f := newFakeKafka(t, 5)
+	f.reversed = true
+	s := &config.Sample{
+		Name:     "kafkasample",
+		KeyField: "host",
+		Output: &config.Output{
+			Outputter:      "kafka",
+			OutputTemplate: "raw",
+			Endpoints:      []string{f.addr()},
+			Topic:          "globaltopic",
+		},
+	}
+	events := make([]map[string]string, 0, 50)
+	for i := 0; i < 50; i++ {
+		events = append(events, map[string]string{"_raw": fmt.Sprintf("event %d", i), "host": "host" + strconv.Itoa(i%10)})
+	}
+	k := new(kafka)
+	assert.NoError(t, k.Send(testItem(s, events)))
+	k.Close()
+	f.close()
+
+	assert.Empty(t, f.errs)
+	total := 0
+	for p, msgs := range f.received["globaltopic"] {
+		for _, m := range msgs {
+			// The hash picks a partition id, not a position in the metadata response
+			assert.Equal(t, kafkaPartitionFor(m.key, 5), int(p))
+			total++
+		}
+	}
+	assert.Equal(t, 50, total)
+}
+
+func TestKafkaSampleTopicAndPartitionField(t *testing.T) {
+	startTestStats()
+	f := newFakeKafka(t, 3)
+	s := &config.Sample{
+		Name:  "kafkasample",
+		Topic: "sampletopic",
+		Output: &config.Output{
+			Outputter:      "kafka",
+			OutputTemplate: "json",
+			Endpoints:      []string{f.addr()},
+			Topic:          "globaltopic",
+			PartitionField: "user",
+		},
+	}
+	events := []map[string]string{
+		{"_raw": "one", "user": "alice"},
+		{"_raw": "two", "user": "bob"},
+		{"_raw": "three", "user": "alice"},
+	}
+	k := new(kafka)
+	assert.NoError(t, k.Send(testItem(s, events)))
+	assert.NoError(t, k.Send(testItem(s, events)))
+	k.Close()
+	f.close()
+
+	assert.Empty(t, f.errs)
+	assert.Nil(t, f.received["globaltopic"])
+	alice := int32(kafkaPartitionFor([]byte("alice"), 3))
+	var values []string
+	for _, m := range f.received["sampletopic"][alice] {
+		assert.Nil(t, m.key)
+		values = append(values, string(m.value))
+	}
+	assert.Contains(t, values, `{"_raw":"one","user":"alice"}`)
+	assert.Contains(t, values, `{"_raw":"three","user":"alice"}`)
+
+	// Events without the partition field don't all hash to the same partition
+	f = newFakeKafka(t, 3)
+	s.Output.Endpoints = []string{f.addr()}
+	events = nil
+	for i := 0; i < 30; i++ {
+		events = append(events, map[string]string{"_raw": fmt.Sprintf("event %d", i)})
+	}
+	k = new(kafka)
+	assert.NoError(t, k.Send(testItem(s, events)))
+	k.Close()
+	f.close()
+	assert.Empty(t, f.errs)
+	assert.True(t, len(f.received["sampletopic"]) > 1)
+}
+
+func TestKafkaMurmur2(t *testing.T) {
+	// Values from the Kafka Java client's own tests
+	assert.Equal(t, int32(-973932308), kafkaMurmur2([]byte("21")))
+	assert.Equal(t, int32(-790332482), kafkaMurmur2([]byte("foobar")))
+	assert.Equal(t, int32(-985981536), kafkaMurmur2([]byte("a-little-bit-long-string")))
+	assert.Equal(t, int32(-1486304829), kafkaMurmur2([]byte("a-little-bit-longer-string")))
+	assert.Equal(t, int32(-58897971), kafkaMurmur2([]byte("lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8")))
+	assert.Equal(t, int32(479470107), kafkaMurmur2([]byte("abc")))
+}
+
+func TestSnappyEncode(t *testing.T) {
+	src := bytes.Repeat([]byte("gogen generates events, lots of events. "), 5000)
+	src = append(src, []byte("and a unique tail")...)
+	enc := snappyXerialEncode(src)
+	assert.True(t, len(enc) < len(src)/4)
+	dec, err := snappyXerialDecode(enc)
+	assert.NoError(t, err)
+	assert.Equal(t, src, dec)
+}
+
+func TestSnappyXerialFixtures(t *testing.T) {
+	// Encoded by github.com/eapache/go-xerial-snappy, which the Sarama Kafka client uses
+	header := []byte{0x82, 'S', 'N', 'A', 'P', 'P', 'Y', 0, 0, 0, 0, 1, 0, 0, 0, 1}
+	assert.Equal(t, append(header, 0, 0, 0, 7, 0x05, 0x10, 'g', 'o', 'g', 'e', 'n'), snappyXerialEncode([]byte("gogen")))
+	assert.Equal(t, append(header, 0, 0, 0, 9, 0x14, 0x0c, 'a', 'b', 'c', 'd', 0x3e, 0x04, 0x00),
+		snappyXerialEncode([]byte("abcdabcdabcdabcdabcd")))
+
+	// A stream of two chunks, which our decoder must read the same as theirs
+	fixture, err := ioutil.ReadFile(filepath.Join("..", "tests", "kafka", "xerial.snappy"))
+	assert.NoError(t, err)
+	src := append(bytes.Repeat([]byte("gogen "), 7000), []byte("end")...)
+	dec, err := snappyXerialDecode(fixture)
+	assert.NoError(t, err)
+	assert.Equal(t, src, dec)
+	dec, err = snappyXerialDecode(snappyXerialEncode(src))
+	assert.NoError(t, err)
+	assert.Equal(t, src, dec)
+}
@@ -0,0 +1,410 @@
+package outputter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// Just enough of the Kafka wire protocol to look up partition leaders and produce record batches.
+// We speak Metadata v4 and Produce v3, which every broker since 0.11 understands and which are
+// still supported by current brokers.
+
+const (
+	kafkaAPIProduce  int16 = 0
+	kafkaAPIMetadata int16 = 3
+
+	kafkaProduceVersion  int16 = 3
+	kafkaMetadataVersion int16 = 4
+
+	kafkaCompressionNone   int16 = 0
+	kafkaCompressionGzip   int16 = 1
+	kafkaCompressionSnappy int16 = 2
+
+	kafkaErrUnknownTopicOrPartition int16 = 3
+	kafkaErrLeaderNotAvailable      int16 = 5
+	kafkaErrNotLeaderForPartition   int16 = 6
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// kafkaMessage is a single record to produce
+type kafkaMessage struct {
+	key       []byte
+	value     []byte
+	timestamp int64
+}
+
+// kafkaEncoder builds big endian encoded requests
+type kafkaEncoder struct {
+	bytes.Buffer
+}
+
+func (e *kafkaEncoder) putInt8(v int8)   { e.WriteByte(byte(v)) }
+func (e *kafkaEncoder) putInt16(v int16) { binary.Write(e, binary.BigEndian, v) }
+func (e *kafkaEncoder) putInt32(v int32) { binary.Write(e, binary.BigEndian, v) }
+func (e *kafkaEncoder) putInt64(v int64) { binary.Write(e, binary.BigEndian, v) }
+
+func (e *kafkaEncoder) putString(v string) {
+	e.putInt16(int16(len(v)))
+	e.WriteString(v)
+}
+
+func (e *kafkaEncoder) putNullString() { e.putInt16(-1) }
+
+func (e *kafkaEncoder) putBytes(v []byte) {
+	e.putInt32(int32(len(v)))
+	e.Write(v)
+}
+
+func (e *kafkaEncoder) putVarint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	e.Write(b[:binary.PutVarint(b[:], v)])
+}
+
+func (e *kafkaEncoder) putVarBytes(v []byte) {
+	if v == nil {
+		e.putVarint(-1)
+		return
+	}
+	e.putVarint(int64(len(v)))
+	e.Write(v)
+}
+
+// kafkaDecoder reads big endian encoded responses.  The first error encountered is kept and
+// every subsequent read returns zero values, so callers can check err once at the end.
+type kafkaDecoder struct {
+	b   []byte
+	off int
+	err error
+}
+
+func (d *kafkaDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || d.off+n > len(d.b) {
+		d.err = fmt.Errorf("Kafka response truncated at offset %d reading %d bytes", d.off, n)
+		return nil
+	}
+	ret := d.b[d.off : d.off+n]
+	d.off += n
+	return ret
+}
+
+func (d *kafkaDecoder) int8() int8 {
+	if b := d.next(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	if b := d.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	if b := d.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) string() string {
+	l := d.int16()
+	if l < 0 {
+		return ""
+	}
+	return string(d.next(int(l)))
+}
+
+func (d *kafkaDecoder) bytes() []byte {
+	l := d.int32()
+	if l < 0 {
+		return nil
+	}
+	return d.next(int(l))
+}
+
+func (d *kafkaDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b[d.off:])
+	if n <= 0 {
+		d.err = fmt.Errorf("Kafka response has bad varint at offset %d", d.off)
+		return 0
+	}
+	d.off += n
+	return v
+}
+
+func (d *kafkaDecoder) varBytes() []byte {
+	l := d.varint()
+	if l < 0 {
+		return nil
+	}
+	return d.next(int(l))
+}
+
+// kafkaRequest frames a request body with the size and request header
+func kafkaRequest(apiKey int16, apiVersion int16, correlationID int32, clientID string, body []byte) []byte {
+	e := &kafkaEncoder{}
+	e.putInt32(int32(2 + 2 + 4 + 2 + len(clientID) + len(body)))
+	e.putInt16(apiKey)
+	e.putInt16(apiVersion)
+	e.putInt32(correlationID)
+	e.putString(clientID)
+	e.Write(body)
+	return e.Bytes()
+}
+
+// kafkaMetadataRequest asks for partition metadata of the passed topics, creating them if the
+// broker allows auto creation
+func kafkaMetadataRequest(topics []string) []byte {
+	e := &kafkaEncoder{}
+	e.putInt32(int32(len(topics)))
+	for _, t := range topics {
+		e.putString(t)
+	}
+	e.putInt8(1) // allow_auto_topic_creation
+	return e.Bytes()
+}
+
+// kafkaBroker is a broker as returned by a Metadata response
+type kafkaBroker struct {
+	id   int32
+	addr string
+}
+
+// kafkaPartition is a partition and its leader as returned by a Metadata response
+type kafkaPartition struct {
+	err    int16
+	id     int32
+	leader int32
+}
+
+// kafkaTopic is a topic as returned by a Metadata response
+type kafkaTopic struct {
+	err        int16
+	name       string
+	partitions []kafkaPartition
+}
+
+// kafkaMetadataResponse decodes a Metadata v4 response body, after the correlation id
+func kafkaMetadataResponse(b []byte) ([]kafkaBroker, []kafkaTopic, error) {
+	d := &kafkaDecoder{b: b}
+	d.int32() // throttle_time_ms
+	nb := d.int32()
+	if d.err == nil && nb < 0 {
+		d.err = fmt.Errorf("Kafka metadata response has invalid broker count %d", nb)
+	}
+	if d.err != nil {
+		return nil, nil, d.err
+	}
+	brokers := make([]kafkaBroker, nb)
+	for i := range brokers {
+		brokers[i].id = d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		brokers[i].addr = fmt.Sprintf("%s:%d", host, port)
+	}
+	d.string() // cluster_id
+	d.int32()  // controller_id
+	n := d.int32()
+	if d.err == nil && n < 0 {
+		d.err = fmt.Errorf("Kafka metadata response has invalid topic count %d", n)
+	}
+	if d.err != nil {
+		return nil, nil, d.err
+	}
+	topics := make([]kafkaTopic, n)
+	for i := range topics {
+		topics[i].err = d.int16()
+		topics[i].name = d.string()
+		d.int8() // is_internal
+		np := d.int32()
+		if d.err == nil && np < 0 {
+			d.err = fmt.Errorf("Kafka metadata response has invalid partition count %d", np)
+		}
+		if d.err != nil {
+			return nil, nil, d.err
+		}
+		topics[i].partitions = make([]kafkaPartition, np)
+		for j := range topics[i].partitions {
+			topics[i].partitions[j].err = d.int16()
+			topics[i].partitions[j].id = d.int32()
+			topics[i].partitions[j].leader = d.int32()
+			for k := d.int32(); k > 0 && d.err == nil; k-- { // replica_nodes
+				d.int32()
+			}
+			for k := d.int32(); k > 0 && d.err == nil; k-- { // isr_nodes
+				d.int32()
+			}
+		}
+	}
+	return brokers, topics, d.err
+}
+
+// kafkaProduceRequest builds a Produce v3 request body from record batches keyed by topic and partition
+func kafkaProduceRequest(acks int16, timeoutMs int32, batches map[string]map[int32][]byte) []byte {
+	e := &kafkaEncoder{}
+	e.putNullString() // transactional_id
+	e.putInt16(acks)
+	e.putInt32(timeoutMs)
+	e.putInt32(int32(len(batches)))
+	for topic, partitions := range batches {
+		e.putString(topic)
+		e.putInt32(int32(len(partitions)))
+		for p, batch := range partitions {
+			e.putInt32(p)
+			e.putBytes(batch)
+		}
+	}
+	return e.Bytes()
+}
+
+// kafkaProduceError is the error code returned for one partition in a Produce response
+type kafkaProduceError struct {
+	topic     string
+	partition int32
+	err       int16
+}
+
+// kafkaProduceResponse decodes a Produce v3 response body, after the correlation id, returning
+// any partitions which reported an error
+func kafkaProduceResponse(b []byte) ([]kafkaProduceError, error) {
+	var ret []kafkaProduceError
+	d := &kafkaDecoder{b: b}
+	for nt := d.int32(); nt > 0 && d.err == nil; nt-- {
+		topic := d.string()
+		for np := d.int32(); np > 0 && d.err == nil; np-- {
+			p := d.int32()
+			code := d.int16()
+			d.int64() // base_offset
+			d.int64() // log_append_time_ms
+			if code != 0 {
+				ret = append(ret, kafkaProduceError{topic: topic, partition: p, err: code})
+			}
+		}
+	}
+	d.int32() // throttle_time_ms
+	return ret, d.err
+}
+
+// kafkaRecordBatch encodes messages as a v2 record batch, optionally compressing the records
+func kafkaRecordBatch(msgs []kafkaMessage, compression int16) ([]byte, error) {
+	if len(msgs) == 0 {
+		return nil, fmt.Errorf("Cannot create an empty record batch")
+	}
+	baseTimestamp := msgs[0].timestamp
+	maxTimestamp := baseTimestamp
+	records := &kafkaEncoder{}
+	for i, m := range msgs {
+		if m.timestamp > maxTimestamp {
+			maxTimestamp = m.timestamp
+		}
+		r := &kafkaEncoder{}
+		r.putInt8(0) // attributes
+		r.putVarint(m.timestamp - baseTimestamp)
+		r.putVarint(int64(i))
+		r.putVarBytes(m.key)
+		r.putVarBytes(m.value)
+		r.putVarint(0) // headers
+		records.putVarint(int64(r.Len()))
+		records.Write(r.Bytes())
+	}
+
+	var recordBytes []byte
+	switch compression {
+	case kafkaCompressionGzip:
+		buf := &bytes.Buffer{}
+		w := gzip.NewWriter(buf)
+		if _, err := w.Write(records.Bytes()); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		recordBytes = buf.Bytes()
+	case kafkaCompressionSnappy:
+		recordBytes = snappyXerialEncode(records.Bytes())
+	default:
+		recordBytes = records.Bytes()
+	}
+
+	// Everything from attributes on is covered by the CRC
+	crced := &kafkaEncoder{}
+	crced.putInt16(compression)
+	crced.putInt32(int32(len(msgs) - 1)) // last_offset_delta
+	crced.putInt64(baseTimestamp)
+	crced.putInt64(maxTimestamp)
+	crced.putInt64(-1) // producer_id
+	crced.putInt16(-1) // producer_epoch
+	crced.putInt32(-1) // base_sequence
+	crced.putInt32(int32(len(msgs)))
+	crced.Write(recordBytes)
+
+	batch := &kafkaEncoder{}
+	batch.putInt64(0)                              // base_offset
+	batch.putInt32(int32(4 + 1 + 4 + crced.Len())) // batch_length
+	batch.putInt32(-1)                             // partition_leader_epoch
+	batch.putInt8(2)                               // magic
+	binary.Write(batch, binary.BigEndian, crc32.Checksum(crced.Bytes(), crc32c))
+	batch.Write(crced.Bytes())
+	return batch.Bytes(), nil
+}
+
+// kafkaPartitionFor picks a partition for a key the same way the Java client's default
+// partitioner does, so keyed data lands where other producers would put it
+func kafkaPartitionFor(key []byte, partitions int) int {
+	return int(kafkaMurmur2(key)&0x7fffffff) % partitions
+}
+
+// kafkaMurmur2 is the murmur2 hash as implemented by the Kafka Java client
+func kafkaMurmur2(data []byte) int32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+	length := len(data)
+	h := seed ^ uint32(length)
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	tail := length &^ 3
+	switch length % 4 {
+	case 3:
+		h ^= uint32(data[tail+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[tail+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[tail])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
@@ -1,13 +1,17 @@
 package outputter
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"math/rand"
+	"strconv"
+	"sync"
 	"time"
 
 	config "github.com/coccyx/gogen/internal"
 	log "github.com/coccyx/gogen/logger"
+	"github.com/coccyx/gogen/metrics"
 	"github.com/coccyx/gogen/template"
 )
 
@@ -16,9 +20,26 @@ var (
 	bytesWritten  int64
 	lastTS        time.Time
 	rotchan       chan *config.OutputStats
-	gout          [config.MaxOutputThreads]config.Outputter
 )
 
+// output is the outputter for one Output config on one output worker.  Each has its own queue and
+// goroutine, so a slow destination only holds up the others once its queue is full.
+type output struct {
+	out config.Outputter
+	// sample is the last sample sent, for logging and metrics when closing
+	sample  string
+	items   chan *config.OutQueueItem
+	rand    *rand.Rand
+	dropped int
+}
+
+// eventSender is implemented by outputters which encode item.Events themselves, like message
+// oriented protocols, rather than reading the formatted stream from item.IO.  They are
+// responsible for calling Account for what they've written.
+type eventSender interface {
+	sendsEvents()
+}
+
 // ROT starts the Read Out Thread which will log statistics about what's being output
 // ROT is intended to be started as a goroutine which will log output every c.
 func ROT(c *config.Config) {
@@ -56,100 +77,185 @@ func readStats() {
 	}
 }
 
-// Account sends eventsWritten and bytesWritten to the readStats() thread
-func Account(eventsWritten int64, bytesWritten int64) {
+// Account records eventsWritten and bytesWritten against the item's output in metrics.  Only what's
+// written to the sample's first output counts towards the sample's stats and is sent to the
+// readStats() thread, so samples sent to several outputs aren't counted more than once.
+func Account(item *config.OutQueueItem, eventsWritten int64, bytesWritten int64) {
+	if item.Output != nil {
+		metrics.DestinationEventsWritten.Add(item.Output.DisplayName(), float64(eventsWritten))
+		metrics.DestinationBytesWritten.Add(item.Output.DisplayName(), float64(bytesWritten))
+	}
+	if item.Output != nil && item.Output != item.S.Output {
+		return
+	}
+	metrics.EventsWritten.Add(item.S.Name, float64(eventsWritten))
+	metrics.BytesWritten.Add(item.S.Name, float64(bytesWritten))
 	os := new(config.OutputStats)
 	os.EventsWritten = eventsWritten
 	os.BytesWritten = bytesWritten
 	rotchan <- os
 }
 
-// Start starts an output thread and runs until notified to shut down
-func Start(oq chan *config.OutQueueItem, oqs chan int, num int) {
-	source := rand.NewSource(time.Now().UnixNano())
-	generator := rand.New(source)
-
-	var lastS *config.Sample
-	var out config.Outputter
+// Start starts an output thread and runs until oq is closed.  If ctx is cancelled first, remaining
+// items are dropped rather than output so the outputter can be closed quickly.  Outputters which
+// pick at random draw from generators seeded with seed.
+func Start(ctx context.Context, oq chan *config.OutQueueItem, oqs chan int, num int, seed int64) {
+	// Each distinct Output config gets its own outputter, so samples can go to different places
+	outs := make(map[*config.Output]*output)
+	var wg sync.WaitGroup
+	dropped := 0
 	for {
 		item, ok := <-oq
 		if !ok {
-			if lastS != nil {
-				log.Infof("Closing output for sample '%s'", lastS.Name)
-				out.Close()
-				gout[num] = nil
+			for _, out := range outs {
+				close(out.items)
+			}
+			wg.Wait()
+			for _, out := range outs {
+				dropped += out.dropped
+			}
+			if dropped > 0 {
+				log.Errorf("Outputter %d dropped %d batches after drain timeout", num, dropped)
 			}
 			oqs <- 1
 			break
 		}
-		out = setup(generator, item, num)
-		if len(item.Events) > 0 {
-			go func() {
-				var bytes int64
-				defer item.IO.W.Close()
-				switch item.S.Output.OutputTemplate {
-				case "raw", "json", "splunktcp":
-					for _, line := range item.Events {
-						var tempbytes int
-						var err error
-						if item.S.Output.Outputter != "devnull" {
-							switch item.S.Output.OutputTemplate {
-							case "raw":
-								tempbytes, err = io.WriteString(item.IO.W, line["_raw"])
-								if err != nil {
-									log.Errorf("Error writing to IO Buffer: %s", err)
-								}
-							case "json":
-								jb, err := json.Marshal(line)
-								if err != nil {
-									log.Errorf("Error marshaling json: %s", err)
-								}
-								tempbytes, err = item.IO.W.Write(jb)
-								if err != nil {
-									log.Errorf("Error writing to IO Buffer: %s", err)
-								}
-							case "splunktcp":
-								tempbytes, err = item.IO.W.Write(encodeEvent(line))
-								if err != nil {
-									log.Errorf("Error writing to IO Buffer: %s", err)
-								}
-							}
-						} else {
-							tempbytes = len(line["_raw"])
+		if ctx.Err() != nil {
+			dropped++
+			continue
+		}
+		// The same batch goes to each of the sample's outputs, each formatting it for itself
+		outputs := item.S.Outputs
+		if len(outputs) == 0 {
+			outputs = []*config.Output{item.S.Output}
+		}
+		for _, o := range outputs {
+			out, ok := outs[o]
+			if !ok {
+				log.Infof("Setting sample '%s' to output '%s' with outputter '%s'", item.S.Name, o.DisplayName(), o.Outputter)
+				out = &output{
+					out:   newOutputter(o),
+					items: make(chan *config.OutQueueItem, config.MaxOutQueueLength),
+					rand:  config.NewRand(seed, "outputter"+strconv.Itoa(num)+o.DisplayName()),
+				}
+				outs[o] = out
+				wg.Add(1)
+				go out.run(ctx, o, &wg)
+			}
+			di := *item
+			di.Output = o
+			select {
+			case out.items <- &di:
+			case <-ctx.Done():
+				dropped++
+			}
+		}
+	}
+}
+
+// run delivers items from the output's queue until it's closed, and then closes the outputter
+func (out *output) run(ctx context.Context, o *config.Output, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for item := range out.items {
+		if ctx.Err() != nil {
+			out.dropped++
+			continue
+		}
+		out.deliver(item)
+	}
+	log.Infof("Closing output '%s' for sample '%s'", o.DisplayName(), out.sample)
+	if err := out.out.Close(); err != nil {
+		metrics.OutputErrors.Add(out.sample, 1)
+		metrics.DestinationErrors.Add(o.DisplayName(), 1)
+		log.Errorf("Error closing output '%s' for sample '%s': %s", o.DisplayName(), out.sample, err)
+	}
+}
+
+// deliver formats item for its Output and sends it to the outputter
+func (out *output) deliver(item *config.OutQueueItem) {
+	item.Rand = out.rand
+	item.IO = config.NewOutputIO()
+	out.sample = item.S.Name
+	if len(item.Events) == 0 {
+		return
+	}
+	if _, ok := out.out.(eventSender); ok {
+		send(out.out, item)
+		return
+	}
+	go func() {
+		var bytes int64
+		defer item.IO.W.Close()
+		switch item.Output.OutputTemplate {
+		case "raw", "json", "splunktcp":
+			for _, line := range item.Events {
+				var tempbytes int
+				var err error
+				if item.Output.Outputter != "devnull" {
+					switch item.Output.OutputTemplate {
+					case "raw":
+						tempbytes, err = io.WriteString(item.IO.W, line["_raw"])
+						if err != nil {
+							log.Errorf("Error writing to IO Buffer: %s", err)
+						}
+					case "json":
+						jb, err := json.Marshal(line)
+						if err != nil {
+							log.Errorf("Error marshaling json: %s", err)
 						}
-						bytes += int64(tempbytes) + 1
-						if item.S.Output.Outputter != "devnull" {
-							_, err = io.WriteString(item.IO.W, "\n")
-							if err != nil {
-								log.Errorf("Error writing to IO Buffer: %s", err)
-							}
+						tempbytes, err = item.IO.W.Write(jb)
+						if err != nil {
+							log.Errorf("Error writing to IO Buffer: %s", err)
+						}
+					case "splunktcp":
+						tempbytes, err = item.IO.W.Write(encodeEvent(line))
+						if err != nil {
+							log.Errorf("Error writing to IO Buffer: %s", err)
 						}
 					}
-				default:
-					// We'll crash on empty events, but don't do that!
-					bytes += int64(getLine("header", item.S, item.Events[0], item.IO.W))
-					// log.Debugf("Out Queue Item %#v", item)
-					var last int
-					for i, line := range item.Events {
-						bytes += int64(getLine("row", item.S, line, item.IO.W))
-						last = i
+				} else {
+					tempbytes = len(line["_raw"])
+				}
+				bytes += int64(tempbytes) + 1
+				if item.Output.Outputter != "devnull" {
+					_, err = io.WriteString(item.IO.W, "\n")
+					if err != nil {
+						log.Errorf("Error writing to IO Buffer: %s", err)
 					}
-					bytes += int64(getLine("footer", item.S, item.Events[last], item.IO.W))
 				}
-				Account(int64(len(item.Events)), bytes)
-			}()
-			err := out.Send(item)
-			if err != nil {
-				log.Errorf("Error with Send(): %s", err)
 			}
+		default:
+			// We'll crash on empty events, but don't do that!
+			bytes += int64(getLine("header", item, item.Events[0], item.IO.W))
+			// log.Debugf("Out Queue Item %#v", item)
+			var last int
+			for i, line := range item.Events {
+				bytes += int64(getLine("row", item, line, item.IO.W))
+				last = i
+			}
+			bytes += int64(getLine("footer", item, item.Events[last], item.IO.W))
 		}
-		lastS = item.S
+		Account(item, int64(len(item.Events)), bytes)
+	}()
+	send(out.out, item)
+}
+
+// send calls Send on the outputter, recording its latency and any error in metrics
+func send(out config.Outputter, item *config.OutQueueItem) {
+	start := time.Now()
+	err := out.Send(item)
+	metrics.SendLatency.Observe(item.S.Name, time.Since(start).Seconds())
+	if err != nil {
+		metrics.OutputErrors.Add(item.S.Name, 1)
+		metrics.DestinationErrors.Add(item.Output.DisplayName(), 1)
+		log.Errorf("Error with Send() to output '%s': %s", item.Output.DisplayName(), err)
 	}
 }
 
-func getLine(templatename string, s *config.Sample, line map[string]string, w io.Writer) (bytes int) {
-	if template.Exists(s.Output.OutputTemplate + "_" + templatename) {
-		linestr, err := template.Exec(s.Output.OutputTemplate+"_"+templatename, line)
+func getLine(templatename string, item *config.OutQueueItem, line map[string]string, w io.Writer) (bytes int) {
+	s := item.S
+	if template.Exists(item.Output.OutputTemplate + "_" + templatename) {
+		linestr, err := template.Exec(item.Output.OutputTemplate+"_"+templatename, line)
 		if err != nil {
 			log.Errorf("Error from sample '%s' in template execution: %v", s.Name, err)
 		}
@@ -157,34 +263,50 @@ func getLine(templatename string, s *config.Sample, line map[string]string, w io
 		bytes, err = w.Write([]byte(linestr))
 		_, err = w.Write([]byte("\n"))
 		if err != nil {
-			log.Errorf("Error sending event for sample '%s' to outputter '%s': %s", s.Name, s.Output.Outputter, err)
+			log.Errorf("Error sending event for sample '%s' to outputter '%s': %s", s.Name, item.Output.Outputter, err)
 		}
 	}
 	return bytes
 }
 
-func setup(generator *rand.Rand, item *config.OutQueueItem, num int) config.Outputter {
-	item.Rand = generator
-	item.IO = config.NewOutputIO()
+// formatEvent renders a single event according to the output's template, without the newline
+// which separates events in the formatted stream
+func formatEvent(o *config.Output, line map[string]string) ([]byte, error) {
+	switch o.OutputTemplate {
+	case "raw":
+		return []byte(line["_raw"]), nil
+	case "json":
+		return json.Marshal(line)
+	case "splunktcp":
+		return encodeEvent(line), nil
+	default:
+		linestr, err := template.Exec(o.OutputTemplate+"_row", line)
+		return []byte(linestr), err
+	}
+}
 
-	if gout[num] == nil {
-		log.Infof("Setting sample '%s' to outputter '%s'", item.S.Name, item.S.Output.Outputter)
-		switch item.S.Output.Outputter {
-		case "stdout":
-			gout[num] = new(stdout)
-		case "devnull":
-			gout[num] = new(devnull)
-		case "file":
-			gout[num] = new(file)
-		case "http":
-			gout[num] = new(httpout)
-		case "buf":
-			gout[num] = new(buf)
-		case "splunktcp":
-			gout[num] = new(splunktcp)
-		default:
-			gout[num] = new(stdout)
-		}
+// newOutputter returns a new outputter for o
+func newOutputter(o *config.Output) config.Outputter {
+	switch o.Outputter {
+	case "stdout":
+		return new(stdout)
+	case "devnull":
+		return new(devnull)
+	case "file":
+		return openFile(o.FileName)
+	case "http":
+		return new(httpout)
+	case "buf":
+		return new(buf)
+	case "splunktcp":
+		return new(splunktcp)
+	case "kafka":
+		return new(kafka)
+	case "syslog":
+		return new(syslog)
+	case "splunkhec":
+		return new(splunkhec)
+	default:
+		return new(stdout)
 	}
-	return gout[num]
 }
@@ -0,0 +1,66 @@
+package outputter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+// testItem returns an item of events to send to s's output
+func testItem(s *config.Sample, events []map[string]string) *config.OutQueueItem {
+	return &config.OutQueueItem{S: s, Output: s.Output, Events: events, Rand: rand.New(rand.NewSource(0))}
+}
+
+// startTestStats reads the stats outputters send, so sending doesn't block without a ROT running
+func startTestStats() {
+	if rotchan == nil {
+		rotchan = make(chan *config.OutputStats)
+		go readStats()
+	}
+}
+
+func TestStartBlockedOutput(t *testing.T) {
+	startTestStats()
+	release := make(chan struct{})
+	blocked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer blocked.Close()
+
+	primary := &config.Output{Name: "primary", Outputter: "buf", OutputTemplate: "raw"}
+	stuck := &config.Output{Name: "stuck", Outputter: "http", OutputTemplate: "raw", Endpoints: []string{blocked.URL}, Timeout: "10s"}
+	s := &config.Sample{Name: "blocked", Output: primary, Outputs: []*config.Output{primary, stuck}, Buf: new(bytes.Buffer)}
+	oq := make(chan *config.OutQueueItem)
+	oqs := make(chan int)
+	go Start(context.Background(), oq, oqs, 0, 0)
+	go func() {
+		for i := 0; i < 5; i++ {
+			oq <- &config.OutQueueItem{S: s, Events: []map[string]string{{"_raw": fmt.Sprintf("event %d", i)}}}
+		}
+		close(oq)
+	}()
+
+	// The http output is stuck on its first batch, which mustn't hold up the buf output
+	var n int
+	for deadline := time.Now().Add(2 * time.Second); n < 5 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		bufMutex.Lock()
+		n = strings.Count(s.Buf.String(), "\n")
+		bufMutex.Unlock()
+	}
+	assert.Equal(t, 5, n)
+	close(release)
+	select {
+	case <-oqs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Outputter didn't finish")
+	}
+}
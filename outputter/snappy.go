@@ -0,0 +1,118 @@
+package outputter
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Snappy block compression, enough of it to compress Kafka message batches.  Kafka expects the
+// xerial framing used by the Java client around standard Snappy blocks.
+
+const (
+	snappyMaxBlockSize   = 65536
+	snappyTableBits      = 14
+	snappyXerialChunk    = 32768
+	snappyMaxCopyLength  = 64
+	snappyMinMatchLength = 4
+)
+
+var snappyXerialHeader = []byte{0x82, 'S', 'N', 'A', 'P', 'P', 'Y', 0}
+
+// snappyXerialEncode compresses src in the xerial framing format: a magic header followed by a
+// version and compatible version, then length prefixed Snappy blocks of up to 32k of input each
+func snappyXerialEncode(src []byte) []byte {
+	buf := &bytes.Buffer{}
+	buf.Write(snappyXerialHeader)
+	binary.Write(buf, binary.BigEndian, int32(1))
+	binary.Write(buf, binary.BigEndian, int32(1))
+	for len(src) > 0 {
+		n := len(src)
+		if n > snappyXerialChunk {
+			n = snappyXerialChunk
+		}
+		block := snappyEncode(src[:n])
+		binary.Write(buf, binary.BigEndian, int32(len(block)))
+		buf.Write(block)
+		src = src[n:]
+	}
+	return buf.Bytes()
+}
+
+// snappyEncode returns src encoded as a single Snappy block
+func snappyEncode(src []byte) []byte {
+	dst := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(src)+len(src)/6+32)
+	dst = dst[:binary.PutUvarint(dst, uint64(len(src)))]
+	for len(src) > 0 {
+		n := len(src)
+		if n > snappyMaxBlockSize {
+			n = snappyMaxBlockSize
+		}
+		dst = snappyEncodeBlock(dst, src[:n])
+		src = src[n:]
+	}
+	return dst
+}
+
+// snappyEncodeBlock appends the encoding of src, which must be no longer than 64k so every
+// offset fits in a two byte copy, to dst
+func snappyEncodeBlock(dst []byte, src []byte) []byte {
+	var table [1 << snappyTableBits]int32
+	hash := func(u uint32) uint32 {
+		return (u * 0x1e35a7bd) >> (32 - snappyTableBits)
+	}
+	lit := 0
+	s := 0
+	for s+snappyMinMatchLength <= len(src) {
+		v := binary.LittleEndian.Uint32(src[s:])
+		h := hash(v)
+		candidate := int(table[h]) - 1
+		table[h] = int32(s + 1)
+		if candidate < 0 || binary.LittleEndian.Uint32(src[candidate:]) != v {
+			s++
+			continue
+		}
+		dst = snappyEmitLiteral(dst, src[lit:s])
+		base := s
+		s += snappyMinMatchLength
+		candidate += snappyMinMatchLength
+		for s < len(src) && src[s] == src[candidate] {
+			s++
+			candidate++
+		}
+		dst = snappyEmitCopy(dst, base-(candidate-(s-base)), s-base)
+		lit = s
+	}
+	return snappyEmitLiteral(dst, src[lit:])
+}
+
+func snappyEmitLiteral(dst []byte, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+	n := len(lit) - 1
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2)
+	case n < 1<<8:
+		dst = append(dst, 60<<2, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+func snappyEmitCopy(dst []byte, offset int, length int) []byte {
+	for length > 0 {
+		n := length
+		if n > snappyMaxCopyLength {
+			n = snappyMaxCopyLength
+		}
+		dst = append(dst, byte(n-1)<<2|2, byte(offset), byte(offset>>8))
+		length -= n
+	}
+	return dst
+}
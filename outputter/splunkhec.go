@@ -0,0 +1,298 @@
+package outputter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	log "github.com/coccyx/gogen/logger"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	splunkHECEventPath = "/services/collector/event"
+	splunkHECAckPath   = "/services/collector/ack"
+	splunkHECChannel   = "X-Splunk-Request-Channel"
+)
+
+// splunkhec sends batches of events to Splunk's HTTP Event Collector.  Index, host, source and
+// sourcetype are sent as HEC metadata and other fields as indexed fields.  With Output.UseAck set,
+// batches are tracked by ack id and re-sent if the indexers haven't acknowledged them within
+// Output.AckTimeout.
+type splunkhec struct {
+	buf         bytes.Buffer
+	client      *http.Client
+	policy      httpPolicy
+	ackTimeout  time.Duration
+	ackInterval time.Duration
+	channel     string
+	headers     map[string]string
+	endpoints   []string
+	initialized bool
+	closed      bool
+	lastS       *config.Sample
+	output      *config.Output
+	rand        *rand.Rand
+	pending     []*hecBatch
+	lastPoll    time.Time
+}
+
+// hecBatch is a batch of events waiting to be acknowledged
+type hecBatch struct {
+	body     []byte
+	endpoint string
+	ackID    int64
+	sent     time.Time
+	attempts int
+}
+
+func (h *splunkhec) Send(item *config.OutQueueItem) error {
+	if !h.initialized {
+		if err := h.init(item); err != nil {
+			return err
+		}
+		h.initialized = true
+	}
+	h.lastS = item.S
+	h.output = item.Output
+	h.rand = item.Rand
+
+	var bytes int64
+	for _, line := range item.Events {
+		b, err := hecEvent(line)
+		if err != nil {
+			log.Errorf("Error formatting event for sample '%s': %s", item.S.Name, err)
+			continue
+		}
+		h.buf.Write(b)
+		h.buf.WriteByte('\n')
+		bytes += int64(len(b)) + 1
+	}
+	Account(item, int64(len(item.Events)), bytes)
+
+	var err error
+	if h.buf.Len() > item.Output.BufferBytes {
+		err = h.flush()
+	}
+	if item.Output.UseAck && time.Since(h.lastPoll) >= h.ackInterval {
+		h.poll()
+	}
+	return err
+}
+
+func (h *splunkhec) Close() error {
+	if h.closed || !h.initialized {
+		return nil
+	}
+	h.closed = true
+	var err error
+	if h.buf.Len() > 0 {
+		err = h.flush()
+	}
+	// Every pending batch is eventually acknowledged, or times out and is re-sent until it runs out of
+	// retries.  Slow polls and re-sends can stretch that out, so give up once every attempt should have
+	// timed out and spool whatever is left.
+	deadline := time.Now().Add(h.ackTimeout*time.Duration(h.policy.retries+1) + h.ackInterval)
+	for len(h.pending) > 0 && time.Now().Before(deadline) {
+		time.Sleep(h.ackInterval)
+		h.poll()
+	}
+	for _, b := range h.pending {
+		err := fmt.Errorf("Batch from sample '%s' with ackId %d not acknowledged by '%s' before close", h.lastS.Name, b.ackID, b.endpoint)
+		log.Error(err)
+		spoolDeadLetter(h.output, h.lastS.Name, h.endpoints, b.body, err)
+	}
+	h.pending = nil
+	return err
+}
+
+// sendsEvents implements eventSender
+func (h *splunkhec) sendsEvents() {}
+
+func (h *splunkhec) init(item *config.OutQueueItem) error {
+	o := item.Output
+	var err error
+	if h.client, h.policy, err = newHTTPClient(o); err != nil {
+		return err
+	}
+	if h.ackTimeout, err = outputDuration("ackTimeout", o.AckTimeout); err != nil {
+		return err
+	}
+	if h.ackInterval, err = outputDuration("ackInterval", o.AckInterval); err != nil {
+		return err
+	}
+	if len(o.Endpoints) == 0 {
+		return fmt.Errorf("No endpoints configured for splunkhec output for sample '%s'", item.S.Name)
+	}
+	for _, e := range o.Endpoints {
+		u, err := url.Parse(e)
+		if err != nil {
+			return fmt.Errorf("Invalid splunkhec endpoint '%s': %s", e, err)
+		}
+		if u.Path == "" || u.Path == "/" {
+			u.Path = splunkHECEventPath
+		}
+		h.endpoints = append(h.endpoints, u.String())
+	}
+
+	h.channel = o.Channel
+	if h.channel == "" {
+		var u uuid.UUID
+		item.Rand.Read(u[:])
+		u.SetVersion(4)
+		u.SetVariant()
+		h.channel = u.String()
+	}
+	h.headers = map[string]string{splunkHECChannel: h.channel}
+	for k, v := range o.Headers {
+		h.headers[k] = v
+	}
+	return nil
+}
+
+// flush sends the buffered events as a new batch
+func (h *splunkhec) flush() error {
+	b := &hecBatch{body: make([]byte, h.buf.Len())}
+	copy(b.body, h.buf.Bytes())
+	h.buf.Reset()
+	return h.send(b)
+}
+
+// send posts a batch and, with acks on, adds it to the pending list
+func (h *splunkhec) send(b *hecBatch) error {
+	endpoint, resp, err := httpSend(h.client, h.policy, h.endpoints, h.headers, b.body, h.rand.Intn(len(h.endpoints)))
+	if err != nil {
+		err = fmt.Errorf("Error sending batch from sample '%s': %s", h.lastS.Name, err)
+		spoolDeadLetter(h.output, h.lastS.Name, h.endpoints, b.body, err)
+		return err
+	}
+	if !h.output.UseAck {
+		return nil
+	}
+	var r struct {
+		AckID *int64 `json:"ackId"`
+	}
+	if err := json.Unmarshal(resp, &r); err != nil || r.AckID == nil {
+		return fmt.Errorf("No ackId returned from '%s', is indexer acknowledgement enabled for the token? Response: %s", endpoint, resp)
+	}
+	b.endpoint = endpoint
+	b.ackID = *r.AckID
+	b.sent = time.Now()
+	h.pending = append(h.pending, b)
+	return nil
+}
+
+// poll queries each endpoint with pending batches for acknowledgements.  Batches which haven't been
+// acknowledged within ackTimeout are re-sent, or spooled to the dead letter file once they've used
+// up their retries.
+func (h *splunkhec) poll() {
+	h.lastPoll = time.Now()
+	byEndpoint := make(map[string][]int64)
+	var order []string
+	for _, b := range h.pending {
+		if _, ok := byEndpoint[b.endpoint]; !ok {
+			order = append(order, b.endpoint)
+		}
+		byEndpoint[b.endpoint] = append(byEndpoint[b.endpoint], b.ackID)
+	}
+	acked := make(map[string]map[int64]bool)
+	for _, endpoint := range order {
+		a, err := h.queryAcks(endpoint, byEndpoint[endpoint])
+		if err != nil {
+			log.Errorf("Error polling acknowledgements from '%s': %s", endpoint, err)
+			continue
+		}
+		acked[endpoint] = a
+	}
+
+	var pending, expired []*hecBatch
+	for _, b := range h.pending {
+		if acked[b.endpoint][b.ackID] {
+			continue
+		}
+		if time.Since(b.sent) > h.ackTimeout {
+			expired = append(expired, b)
+			continue
+		}
+		pending = append(pending, b)
+	}
+	h.pending = pending
+	for _, b := range expired {
+		if b.attempts >= h.policy.retries {
+			err := fmt.Errorf("Batch from sample '%s' with ackId %d not acknowledged by '%s' after %d attempts", h.lastS.Name, b.ackID, b.endpoint, b.attempts+1)
+			log.Error(err)
+			spoolDeadLetter(h.output, h.lastS.Name, h.endpoints, b.body, err)
+			continue
+		}
+		log.Infof("Re-sending batch from sample '%s', ackId %d not acknowledged by '%s' within %s", h.lastS.Name, b.ackID, b.endpoint, h.ackTimeout)
+		b.attempts++
+		if err := h.send(b); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// queryAcks asks endpoint which of ids have been acknowledged
+func (h *splunkhec) queryAcks(endpoint string, ids []int64) (map[int64]bool, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = splunkHECAckPath
+	u.RawQuery = url.Values{"channel": []string{h.channel}}.Encode()
+	body, err := json.Marshal(map[string][]int64{"acks": ids})
+	if err != nil {
+		return nil, err
+	}
+	resp, _, _, err := httpPost(h.client, u.String(), h.headers, body)
+	if err != nil {
+		return nil, err
+	}
+	var r struct {
+		Acks map[string]bool `json:"acks"`
+	}
+	if err := json.Unmarshal(resp, &r); err != nil {
+		return nil, fmt.Errorf("Error parsing ack response '%s': %s", resp, err)
+	}
+	acked := make(map[int64]bool, len(r.Acks))
+	for k, v := range r.Acks {
+		if id, err := strconv.ParseInt(k, 10, 64); err == nil && v {
+			acked[id] = true
+		}
+	}
+	return acked, nil
+}
+
+// hecEvent encodes an event for HEC.  _raw becomes the event, _time the time, index, host, source
+// and sourcetype become metadata and everything else becomes indexed fields.  Events without _raw
+// send their fields as a JSON event instead.
+func hecEvent(line map[string]string) ([]byte, error) {
+	ev := make(map[string]interface{}, 6)
+	fields := make(map[string]string)
+	for k, v := range line {
+		switch k {
+		case "_raw":
+			ev["event"] = v
+		case "_time":
+			if _, err := strconv.ParseFloat(v, 64); err == nil {
+				ev["time"] = json.Number(v)
+			}
+		case "index", "host", "source", "sourcetype":
+			ev[k] = v
+		default:
+			fields[k] = v
+		}
+	}
+	if _, ok := ev["event"]; !ok {
+		ev["event"] = fields
+	} else if len(fields) > 0 {
+		ev["fields"] = fields
+	}
+	return json.Marshal(ev)
+}
@@ -0,0 +1,182 @@
+package outputter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeHEC hands out sequential ack ids and acknowledges them, except for those in withhold.  Ack
+// polls are answered after pollDelay.
+type fakeHEC struct {
+	*httptest.Server
+	mutex     sync.Mutex
+	nextAck   int64
+	withhold  map[int64]bool
+	batches   []string
+	channels  map[string]bool
+	polls     int
+	pollDelay time.Duration
+}
+
+func newFakeHEC(withhold ...int64) *fakeHEC {
+	f := &fakeHEC{withhold: make(map[int64]bool), channels: make(map[string]bool)}
+	for _, id := range withhold {
+		f.withhold[id] = true
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path == splunkHECAckPath {
+			time.Sleep(f.pollDelay)
+		}
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		switch r.URL.Path {
+		case splunkHECEventPath:
+			f.channels[r.Header.Get(splunkHECChannel)] = true
+			f.batches = append(f.batches, string(body))
+			w.Write([]byte(`{"text":"Success","code":0,"ackId":` + strconv.FormatInt(f.nextAck, 10) + `}`))
+			f.nextAck++
+		case splunkHECAckPath:
+			f.polls++
+			f.channels[r.URL.Query().Get("channel")] = true
+			var req struct {
+				Acks []int64 `json:"acks"`
+			}
+			json.Unmarshal(body, &req)
+			acks := make(map[string]bool)
+			for _, id := range req.Acks {
+				acks[strconv.FormatInt(id, 10)] = !f.withhold[id]
+			}
+			b, _ := json.Marshal(map[string]interface{}{"acks": acks})
+			w.Write(b)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return f
+}
+
+func hecTestSample(endpoint string) *config.Sample {
+	return &config.Sample{
+		Name: "hecsample",
+		Output: &config.Output{
+			Outputter:    "splunkhec",
+			Endpoints:    []string{endpoint},
+			BufferBytes:  1,
+			Retries:      2,
+			RetryBackoff: "10ms",
+			Timeout:      "2s",
+			UseAck:       true,
+			AckTimeout:   "50ms",
+			AckInterval:  "10ms",
+		},
+	}
+}
+
+func TestHECEvent(t *testing.T) {
+	b, err := hecEvent(map[string]string{"_raw": "foo", "_time": "1003579200.250", "host": "h", "index": "main", "source": "s", "sourcetype": "st", "user": "bob"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"event":"foo","time":1003579200.250,"host":"h","index":"main","source":"s","sourcetype":"st","fields":{"user":"bob"}}`, string(b))
+	assert.Contains(t, string(b), `"time":1003579200.250`)
+
+	b, err = hecEvent(map[string]string{"user": "bob", "action": "login", "host": "h"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"event":{"user":"bob","action":"login"},"host":"h"}`, string(b))
+}
+
+func TestSplunkHECAck(t *testing.T) {
+	startTestStats()
+	f := newFakeHEC(0)
+	s := hecTestSample(f.URL)
+	s.Output.Channel = "mychannel"
+	h := new(splunkhec)
+	assert.NoError(t, h.Send(testItem(s, []map[string]string{{"_raw": "one", "host": "h1"}})))
+	assert.NoError(t, h.Send(testItem(s, []map[string]string{{"_raw": "two", "host": "h2"}})))
+	assert.NoError(t, h.Close())
+	f.Close()
+
+	// The first batch was never acknowledged, so it should be re-sent
+	assert.Equal(t, 3, len(f.batches))
+	assert.Equal(t, f.batches[0], f.batches[2])
+	assert.Contains(t, f.batches[0], `"event":"one"`)
+	assert.Contains(t, f.batches[1], `"host":"h2"`)
+	assert.Equal(t, map[string]bool{"mychannel": true}, f.channels)
+	assert.True(t, f.polls > 0)
+	assert.Empty(t, h.pending)
+}
+
+func TestSplunkHECAckDeadLetter(t *testing.T) {
+	startTestStats()
+	dlq := filepath.Join(os.TempDir(), "gogen_hec_dlq_test.json")
+	os.Remove(dlq)
+	defer os.Remove(dlq)
+
+	f := newFakeHEC(0, 1, 2)
+	s := hecTestSample(f.URL)
+	s.Output.DeadLetterFile = dlq
+	h := new(splunkhec)
+	assert.NoError(t, h.Send(testItem(s, []map[string]string{{"_raw": "lost"}})))
+	assert.NoError(t, h.Close())
+	f.Close()
+
+	assert.Equal(t, 3, len(f.batches))
+	assert.Equal(t, 1, len(f.channels))
+	b, err := ioutil.ReadFile(dlq)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(b), "\n"))
+	assert.Contains(t, string(b), "not acknowledged")
+}
+
+func TestSplunkHECCloseDeadline(t *testing.T) {
+	startTestStats()
+	dlq := filepath.Join(os.TempDir(), "gogen_hec_close_test.json")
+	os.Remove(dlq)
+	defer os.Remove(dlq)
+
+	// Each poll outlasts the ack timeout, so retrying every batch would take far longer than the deadline
+	f := newFakeHEC(0, 1, 2, 3, 4, 5)
+	f.pollDelay = 200 * time.Millisecond
+	s := hecTestSample(f.URL)
+	s.Output.DeadLetterFile = dlq
+	h := new(splunkhec)
+	assert.NoError(t, h.Send(testItem(s, []map[string]string{{"_raw": "slow"}})))
+	start := time.Now()
+	assert.NoError(t, h.Close())
+	elapsed := time.Since(start)
+	f.Close()
+
+	assert.True(t, elapsed < 500*time.Millisecond, "Close took %s", elapsed)
+	assert.Empty(t, h.pending)
+	b, err := ioutil.ReadFile(dlq)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(b), "\n"))
+	assert.Contains(t, string(b), "before close")
+}
+
+func TestSplunkHECNoAck(t *testing.T) {
+	startTestStats()
+	f := newFakeHEC()
+	s := hecTestSample(f.URL + "/")
+	s.Output.UseAck = false
+	s.Output.BufferBytes = 1024
+	h := new(splunkhec)
+	assert.NoError(t, h.Send(testItem(s, []map[string]string{{"_raw": "one"}, {"_raw": "two"}})))
+	assert.NoError(t, h.Close())
+	f.Close()
+
+	assert.Equal(t, 1, len(f.batches))
+	assert.Equal(t, 2, strings.Count(f.batches[0], "\n"))
+	assert.Equal(t, 0, f.polls)
+}
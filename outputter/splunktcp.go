@@ -5,7 +5,6 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"math/rand"
 	"net"
 	"strings"
 	"sync"
@@ -184,7 +183,7 @@ func (st *splunktcp) Send(item *config.OutQueueItem) error {
 	}
 
 	st.sent += bytes
-	if st.sent > int64(item.S.Output.BufferBytes) {
+	if st.sent > int64(item.Output.BufferBytes) {
 		err := st.buf.Flush()
 		if err != nil {
 			return err
@@ -208,7 +207,7 @@ func (st *splunktcp) Close() error {
 }
 
 func (st *splunktcp) newBuf(item *config.OutQueueItem) error {
-	st.endpoint = item.S.Output.Endpoints[rand.Intn(len(item.S.Output.Endpoints))]
+	st.endpoint = item.Output.Endpoints[item.Rand.Intn(len(item.Output.Endpoints))]
 	err := st.connect(st.endpoint)
 	if err != nil {
 		return err
@@ -0,0 +1,273 @@
+package outputter
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	log "github.com/coccyx/gogen/logger"
+)
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11, "ntp": 12, "security": 13, "console": 14,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+var syslogSeverities = map[string]int{
+	"emerg": 0, "alert": 1, "crit": 2, "err": 3, "warning": 4, "notice": 5, "info": 6, "debug": 7,
+}
+
+const (
+	defaultSyslogFacility = "user"
+	defaultSyslogSeverity = "notice"
+	syslogReconnectTries  = 3
+)
+
+// syslog sends each event's _raw wrapped in an RFC 5424 or RFC 3164 header.  Hostname comes from
+// the host field, app name from source or sourcetype, and PRI from a priority field or
+// facility and severity fields, falling back to the output's configured facility and severity.
+type syslog struct {
+	initialized bool
+	closed      bool
+	conn        net.Conn
+	endpoint    string
+	hostname    string
+}
+
+func (sl *syslog) Send(item *config.OutQueueItem) error {
+	o := item.Output
+	if !sl.initialized {
+		sl.hostname, _ = os.Hostname()
+		if sl.hostname == "" {
+			sl.hostname = "-"
+		}
+		sl.initialized = true
+	}
+
+	msgs := make([][]byte, 0, len(item.Events))
+	var bytes int64
+	for _, line := range item.Events {
+		header, err := sl.header(o, line)
+		if err != nil {
+			return fmt.Errorf("Error building syslog header for sample '%s': %s", item.S.Name, err)
+		}
+		body, err := formatEvent(item.Output, line)
+		if err != nil {
+			log.Errorf("Error formatting event for sample '%s': %s", item.S.Name, err)
+			continue
+		}
+		msg := append([]byte(header), body...)
+		msgs = append(msgs, msg)
+		bytes += int64(len(msg))
+	}
+
+	// After a failed write, carry on from the first message which didn't make it out in full, so
+	// stream transports don't see the earlier ones twice
+	var err error
+	var sent int
+	for try := 0; try < syslogReconnectTries; try++ {
+		if sl.conn == nil {
+			if err = sl.connect(item); err != nil {
+				log.Errorf("Error connecting to syslog endpoint for sample '%s': %s", item.S.Name, err)
+				continue
+			}
+		}
+		var n int
+		n, err = sl.write(o, msgs[sent:])
+		sent += n
+		if err == nil {
+			Account(item, int64(len(msgs)), bytes)
+			return nil
+		}
+		log.Errorf("Error writing to syslog endpoint '%s' for sample '%s' after %d of %d messages, reconnecting: %s",
+			sl.endpoint, item.S.Name, sent, len(msgs), err)
+		sl.disconnect()
+	}
+	return err
+}
+
+func (sl *syslog) Close() error {
+	if !sl.closed {
+		sl.closed = true
+		sl.disconnect()
+	}
+	return nil
+}
+
+// sendsEvents implements eventSender
+func (sl *syslog) sendsEvents() {}
+
+func (sl *syslog) connect(item *config.OutQueueItem) error {
+	o := item.Output
+	if len(o.Endpoints) == 0 {
+		return fmt.Errorf("No endpoints configured for syslog output")
+	}
+	sl.endpoint = o.Endpoints[item.Rand.Intn(len(o.Endpoints))]
+	var err error
+	switch o.Protocol {
+	case "", "udp":
+		sl.conn, err = net.DialTimeout("udp", sl.endpoint, 2*time.Second)
+	case "tcp":
+		sl.conn, err = net.DialTimeout("tcp", sl.endpoint, 2*time.Second)
+	case "tls":
+		sl.conn, err = tls.DialWithDialer(&net.Dialer{Timeout: 2 * time.Second}, "tcp", sl.endpoint, &tls.Config{InsecureSkipVerify: true})
+	default:
+		return fmt.Errorf("Unsupported syslog protocol '%s', should be udp, tcp or tls", o.Protocol)
+	}
+	if err != nil {
+		sl.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (sl *syslog) disconnect() {
+	if sl.conn != nil {
+		sl.conn.Close()
+		sl.conn = nil
+	}
+}
+
+// write frames and sends messages, returning how many were written in full.  UDP sends one
+// datagram per message, stream transports use octet counting from RFC 6587 unless newline framing
+// is requested.
+func (sl *syslog) write(o *config.Output, msgs [][]byte) (int, error) {
+	if o.Protocol == "" || o.Protocol == "udp" {
+		for i, msg := range msgs {
+			if _, err := sl.conn.Write(msg); err != nil {
+				return i, err
+			}
+		}
+		return len(msgs), nil
+	}
+	var buf bytes.Buffer
+	ends := make([]int, 0, len(msgs))
+	for _, msg := range msgs {
+		switch o.Framing {
+		case "", "octet":
+			buf.WriteString(strconv.Itoa(len(msg)) + " ")
+			buf.Write(msg)
+		case "newline":
+			buf.Write(msg)
+			buf.WriteByte('\n')
+		default:
+			return 0, fmt.Errorf("Unsupported syslog framing '%s', should be octet or newline", o.Framing)
+		}
+		ends = append(ends, buf.Len())
+	}
+	n, err := sl.conn.Write(buf.Bytes())
+	if err != nil {
+		return sort.SearchInts(ends, n+1), err
+	}
+	return len(msgs), nil
+}
+
+// header builds the syslog header for an event, including the trailing space before the message
+func (sl *syslog) header(o *config.Output, line map[string]string) (string, error) {
+	pri, err := syslogPri(o, line)
+	if err != nil {
+		return "", err
+	}
+	ts := syslogTime(line)
+	hostname := line["host"]
+	if hostname == "" {
+		hostname = sl.hostname
+	}
+	appname := line["source"]
+	if appname == "" {
+		appname = line["sourcetype"]
+	}
+	if appname == "" {
+		appname = "gogen"
+	}
+
+	switch o.SyslogFormat {
+	case "", "rfc5424":
+		return fmt.Sprintf("<%d>1 %s %s %s - - - ", pri, ts.Format("2006-01-02T15:04:05.000000Z07:00"),
+			syslogField(hostname, 255), syslogField(appname, 48)), nil
+	case "rfc3164":
+		// The tag is alphanumeric only and a maximum of 32 characters
+		tag := strings.Map(func(r rune) rune {
+			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
+				return r
+			}
+			return -1
+		}, appname)
+		if len(tag) > 32 {
+			tag = tag[:32]
+		}
+		return fmt.Sprintf("<%d>%s %s %s: ", pri, ts.Format(time.Stamp), syslogField(hostname, 255), tag), nil
+	}
+	return "", fmt.Errorf("Unsupported syslog format '%s', should be rfc5424 or rfc3164", o.SyslogFormat)
+}
+
+// syslogPri returns the PRI value for an event, from a priority field, facility and severity
+// fields, or the configured defaults
+func syslogPri(o *config.Output, line map[string]string) (int, error) {
+	if p, ok := line["priority"]; ok {
+		pri, err := strconv.Atoi(p)
+		if err != nil || pri < 0 || pri > 191 {
+			return 0, fmt.Errorf("Invalid priority '%s'", p)
+		}
+		return pri, nil
+	}
+	facility := line["facility"]
+	if facility == "" {
+		facility = o.Facility
+	}
+	if facility == "" {
+		facility = defaultSyslogFacility
+	}
+	severity := line["severity"]
+	if severity == "" {
+		severity = o.Severity
+	}
+	if severity == "" {
+		severity = defaultSyslogSeverity
+	}
+	f, ok := syslogFacilities[facility]
+	if !ok {
+		return 0, fmt.Errorf("Invalid facility '%s'", facility)
+	}
+	s, ok := syslogSeverities[severity]
+	if !ok {
+		return 0, fmt.Errorf("Invalid severity '%s'", severity)
+	}
+	return f*8 + s, nil
+}
+
+// syslogTime returns the event's time from an epoch _time field if present, or now
+func syslogTime(line map[string]string) time.Time {
+	if t, ok := line["_time"]; ok {
+		if f, err := strconv.ParseFloat(t, 64); err == nil {
+			sec := int64(f)
+			return time.Unix(sec, int64((f-float64(sec))*float64(time.Second)))
+		}
+	}
+	return time.Now()
+}
+
+// syslogField makes a header field safe, replacing anything not printable or a space and
+// truncating to max length, using the nil value if empty
+func syslogField(v string, max int) string {
+	b := bytes.Buffer{}
+	for i := 0; i < len(v) && b.Len() < max; i++ {
+		if v[i] > 32 && v[i] < 127 {
+			b.WriteByte(v[i])
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "-"
+	}
+	return b.String()
+}
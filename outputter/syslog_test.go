@@ -0,0 +1,230 @@
+package outputter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func syslogTestSample(protocol string, framing string, endpoint string) *config.Sample {
+	return &config.Sample{
+		Name: "syslogsample",
+		Output: &config.Output{
+			Outputter:      "syslog",
+			OutputTemplate: "raw",
+			Endpoints:      []string{endpoint},
+			Protocol:       protocol,
+			Framing:        framing,
+		},
+	}
+}
+
+func TestSyslogHeader(t *testing.T) {
+	sl := &syslog{hostname: "localhost"}
+	o := &config.Output{Facility: "local0", Severity: "info"}
+	line := map[string]string{"_time": "1003579200.25", "host": "fw01", "sourcetype": "cisco:asa"}
+
+	h, err := sl.header(o, line)
+	assert.NoError(t, err)
+	ts := time.Unix(1003579200, 250000000).Format("2006-01-02T15:04:05.000000Z07:00")
+	assert.Equal(t, "<134>1 "+ts+" fw01 cisco:asa - - - ", h)
+
+	line["source"] = "my app"
+	line["severity"] = "err"
+	o.SyslogFormat = "rfc3164"
+	h, err = sl.header(o, line)
+	assert.NoError(t, err)
+	assert.Equal(t, "<131>"+time.Unix(1003579200, 0).Format(time.Stamp)+" fw01 myapp: ", h)
+
+	h, err = sl.header(o, map[string]string{"priority": "0"})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(h, "<0>"))
+	assert.True(t, strings.HasSuffix(h, " localhost gogen: "))
+
+	_, err = sl.header(o, map[string]string{"facility": "bogus"})
+	assert.Error(t, err)
+	_, err = sl.header(&config.Output{SyslogFormat: "bogus"}, line)
+	assert.Error(t, err)
+
+	pri, err := syslogPri(&config.Output{}, map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, 13, pri)
+}
+
+func TestSyslogTCP(t *testing.T) {
+	startTestStats()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	received := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			for {
+				lenstr, err := r.ReadString(' ')
+				if err != nil {
+					break
+				}
+				n, _ := strconv.Atoi(strings.TrimSpace(lenstr))
+				msg := make([]byte, n)
+				if _, err := io.ReadFull(r, msg); err != nil {
+					break
+				}
+				received <- string(msg)
+				// Drop the connection after the first message to exercise reconnecting
+				if strings.HasSuffix(string(msg), "first") {
+					break
+				}
+			}
+			conn.Close()
+		}
+	}()
+
+	s := syslogTestSample("tcp", "", l.Addr().String())
+	sl := new(syslog)
+	assert.NoError(t, sl.Send(testItem(s, []map[string]string{{"_raw": "first", "host": "router1"}})))
+	assert.True(t, strings.HasSuffix(<-received, " router1 gogen - - - first"))
+
+	// The first write after the server hangs up may appear to succeed, keep sending until one lands
+	var msg string
+	for i := 0; i < 10 && msg == ""; i++ {
+		assert.NoError(t, sl.Send(testItem(s, []map[string]string{{"_raw": "second"}})))
+		select {
+		case msg = <-received:
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+	assert.True(t, strings.HasSuffix(msg, " - - - second"))
+	sl.Close()
+}
+
+// killConn passes limit bytes through to its connection and then kills it
+type killConn struct {
+	net.Conn
+	limit int
+}
+
+func (k *killConn) Write(b []byte) (int, error) {
+	if len(b) <= k.limit {
+		k.limit -= len(b)
+		return k.Conn.Write(b)
+	}
+	n, _ := k.Conn.Write(b[:k.limit])
+	k.limit = 0
+	k.Conn.Close()
+	return n, errors.New("connection killed")
+}
+
+func TestSyslogPartialWrite(t *testing.T) {
+	startTestStats()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	received := make(chan string, 100)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					msg, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					received <- msg
+				}
+			}()
+		}
+	}()
+
+	s := syslogTestSample("tcp", "newline", l.Addr().String())
+	events := make([]map[string]string, 0, 10)
+	for i := 0; i < 10; i++ {
+		events = append(events, map[string]string{"_raw": fmt.Sprintf("event %d", i)})
+	}
+	sl := new(syslog)
+	item := testItem(s, events)
+	assert.NoError(t, sl.connect(item))
+	// Every message is over 40 bytes framed, so the connection dies part way through the batch
+	sl.conn = &killConn{Conn: sl.conn, limit: 200}
+	assert.NoError(t, sl.Send(item))
+	sl.Close()
+
+	counts := make(map[string]int)
+	for len(counts) < 10 {
+		select {
+		case msg := <-received:
+			counts[msg[strings.LastIndex(msg, "event"):]]++
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Only received %d of 10 events", len(counts))
+		}
+	}
+	// Give any duplicates time to arrive
+	time.Sleep(100 * time.Millisecond)
+	for len(received) > 0 {
+		msg := <-received
+		counts[msg[strings.LastIndex(msg, "event"):]]++
+	}
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, 1, counts[fmt.Sprintf("event %d\n", i)], "event %d", i)
+	}
+}
+
+func TestSyslogNewlineAndUDP(t *testing.T) {
+	startTestStats()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	lines := make(chan string, 10)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	s := syslogTestSample("tcp", "newline", l.Addr().String())
+	sl := new(syslog)
+	assert.NoError(t, sl.Send(testItem(s, []map[string]string{{"_raw": "one"}, {"_raw": "two"}})))
+	assert.True(t, strings.HasSuffix(<-lines, " one"))
+	assert.True(t, strings.HasSuffix(<-lines, " two"))
+	sl.Close()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer pc.Close()
+	s = syslogTestSample("udp", "", pc.LocalAddr().String())
+	sl = new(syslog)
+	assert.NoError(t, sl.Send(testItem(s, []map[string]string{{"_raw": "datagram", "priority": "14"}})))
+	pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := pc.ReadFrom(buf)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(buf[:n]), "<14>1 "))
+	assert.True(t, strings.HasSuffix(string(buf[:n]), " datagram"))
+	sl.Close()
+}
@@ -0,0 +1,273 @@
+package rater
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	log "github.com/coccyx/gogen/logger"
+)
+
+// maxBurstEvents caps how many past events a burst schedule remembers of each type, forgetting the
+// oldest, so a long realtime run doesn't grow forever
+const maxBurstEvents = 10000
+
+// burstSaveInterval is how often, at most, newly injected events are appended to a Schedule file
+const burstSaveInterval = time.Second
+
+// BurstRater rates at 1, apart from random bursts where the rate jumps to between BurstMagnitude
+// and BurstMaxMagnitude for BurstDuration, and random outages where the rate drops to 0 for
+// OutageDuration.  Bursts and outages arrive as Poisson processes, on average every BurstInterval
+// and OutageInterval.  Every sample and token using the same rater shares its schedule, so they
+// all burst and go down together.  Events are appended to Schedule, one JSON object per line, as
+// they're injected.
+type BurstRater struct {
+	c *config.RaterConfig
+
+	schedule *burstSchedule
+	once     sync.Once
+}
+
+// BurstEvent is a burst or outage injected by a BurstRater
+type BurstEvent struct {
+	Type      string    `json:"type"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Magnitude float64   `json:"magnitude"`
+}
+
+// burstSchedule is the shared state of every BurstRater for the same rater
+type burstSchedule struct {
+	c       *config.RaterConfig
+	options map[string]interface{}
+
+	burstInterval, burstDuration   time.Duration
+	outageInterval, outageDuration time.Duration
+	minMagnitude, maxMagnitude     float64
+
+	nextBurst, nextOutage time.Time
+	bursts, outages       []BurstEvent
+	mutex                 sync.Mutex
+
+	// Events injected since the schedule was last written, and when that was
+	unsaved  []BurstEvent
+	lastSave time.Time
+	created  bool
+
+	// Bursts and outages draw from their own streams, so the schedule doesn't depend on how far
+	// ahead each is scheduled at a time
+	burstRand, outageRand *rand.Rand
+}
+
+var (
+	burstSchedules      = make(map[string]*burstSchedule)
+	burstSchedulesMutex sync.Mutex
+)
+
+// GetRate implements Rater interface
+func (br *BurstRater) GetRate(now time.Time) float64 {
+	br.once.Do(func() {
+		br.schedule = getBurstSchedule(br.c)
+	})
+	return br.schedule.rate(now)
+}
+
+// Schedule returns the bursts and outages injected so far, in order of when they start
+func (br *BurstRater) Schedule() []BurstEvent {
+	br.once.Do(func() {
+		br.schedule = getBurstSchedule(br.c)
+	})
+	br.schedule.mutex.Lock()
+	defer br.schedule.mutex.Unlock()
+	return br.schedule.events()
+}
+
+// getBurstSchedule returns the schedule shared by raters named r.Name, starting a new one if the
+// rater's options have changed since, when the config's been reloaded
+func getBurstSchedule(r *config.RaterConfig) *burstSchedule {
+	burstSchedulesMutex.Lock()
+	defer burstSchedulesMutex.Unlock()
+	if bs, ok := burstSchedules[r.Name]; ok && reflect.DeepEqual(bs.options, r.Options) {
+		return bs
+	}
+	c := config.NewConfig()
+	bs := &burstSchedule{c: r, options: r.Options, burstRand: config.NewRand(c.Global.Seed, r.Name+"burst"),
+		outageRand: config.NewRand(c.Global.Seed, r.Name+"outage")}
+	duration := func(k string, def time.Duration) time.Duration {
+		if v, ok := r.Options[k]; ok {
+			d, _ := time.ParseDuration(fmt.Sprint(v))
+			return d
+		}
+		return def
+	}
+	bs.burstInterval = duration("BurstInterval", 0)
+	bs.burstDuration = duration("BurstDuration", 5*time.Minute)
+	bs.outageInterval = duration("OutageInterval", 0)
+	bs.outageDuration = duration("OutageDuration", 10*time.Minute)
+	bs.minMagnitude = 5.0
+	if v, ok := r.Options["BurstMagnitude"]; ok {
+		bs.minMagnitude = v.(float64)
+	}
+	bs.maxMagnitude = bs.minMagnitude
+	if v, ok := r.Options["BurstMaxMagnitude"]; ok {
+		bs.maxMagnitude = v.(float64)
+	}
+	burstSchedules[r.Name] = bs
+	return bs
+}
+
+// rate schedules bursts and outages up to now and returns the rate at now
+func (bs *burstSchedule) rate(now time.Time) float64 {
+	bs.mutex.Lock()
+	defer bs.mutex.Unlock()
+	if bs.nextBurst.IsZero() && bs.nextOutage.IsZero() {
+		bs.nextBurst = arrival(bs.burstRand, now, bs.burstInterval)
+		bs.nextOutage = arrival(bs.outageRand, now, bs.outageInterval)
+	}
+	for !bs.nextBurst.IsZero() && !bs.nextBurst.After(now) {
+		magnitude := bs.minMagnitude
+		if bs.maxMagnitude > bs.minMagnitude {
+			magnitude += bs.burstRand.Float64() * (bs.maxMagnitude - bs.minMagnitude)
+		}
+		bs.bursts = bs.inject(bs.bursts, BurstEvent{Type: "burst", Start: bs.nextBurst,
+			End: bs.nextBurst.Add(bs.burstDuration), Magnitude: magnitude})
+		bs.nextBurst = arrival(bs.burstRand, bs.nextBurst, bs.burstInterval)
+	}
+	for !bs.nextOutage.IsZero() && !bs.nextOutage.After(now) {
+		bs.outages = bs.inject(bs.outages, BurstEvent{Type: "outage", Start: bs.nextOutage,
+			End: bs.nextOutage.Add(bs.outageDuration)})
+		bs.nextOutage = arrival(bs.outageRand, bs.nextOutage, bs.outageInterval)
+	}
+	// Write the schedule as it grows so it's there while we're still running, but not on every
+	// injection when we're generating quickly through a backfill
+	if len(bs.unsaved) > 0 && time.Since(bs.lastSave) >= burstSaveInterval {
+		bs.save()
+	}
+
+	if len(active(bs.outages, now)) > 0 {
+		return 0.0
+	}
+	rate := 1.0
+	for _, e := range active(bs.bursts, now) {
+		if e.Magnitude > rate {
+			rate = e.Magnitude
+		}
+	}
+	return rate
+}
+
+// arrival returns when the next event arrives after from, on average every interval, or zero time
+// if there's no interval and so no events
+func arrival(randgen *rand.Rand, from time.Time, interval time.Duration) time.Time {
+	if interval <= 0 {
+		return time.Time{}
+	}
+	wait := time.Duration(randgen.ExpFloat64() * float64(interval))
+	// Events arriving at the same instant as the last would be lost in it
+	if wait <= 0 {
+		wait = time.Nanosecond
+	}
+	return from.Add(wait)
+}
+
+func (bs *burstSchedule) inject(events []BurstEvent, e BurstEvent) []BurstEvent {
+	log.Infof("Rater '%s' injecting %s from %s to %s", bs.c.Name, e.Type, e.Start, e.End)
+	events = append(events, e)
+	if _, ok := bs.c.Options["Schedule"]; ok {
+		bs.unsaved = append(bs.unsaved, e)
+	}
+	if len(events) > maxBurstEvents {
+		events = events[len(events)-maxBurstEvents:]
+	}
+	return events
+}
+
+// events returns every event in order of when they start, must be called holding mutex
+func (bs *burstSchedule) events() []BurstEvent {
+	events := make([]BurstEvent, 0, len(bs.bursts)+len(bs.outages))
+	events = append(events, bs.bursts...)
+	events = append(events, bs.outages...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Start.Before(events[j].Start) })
+	return events
+}
+
+// active returns the events active at now.  Events of a type all last as long, so they end in the
+// same order they start in.  Samples may be at different times, so now can be before events we've
+// already scheduled.
+func active(events []BurstEvent, now time.Time) []BurstEvent {
+	end := sort.Search(len(events), func(i int) bool { return events[i].Start.After(now) })
+	start := sort.Search(end, func(i int) bool { return events[i].End.After(now) })
+	return events[start:end]
+}
+
+// save appends the events injected since the last save to the rater's Schedule file, starting the
+// file afresh for a new schedule, must be called holding mutex
+func (bs *burstSchedule) save() {
+	file, ok := bs.c.Options["Schedule"]
+	if !ok || (len(bs.unsaved) == 0 && bs.created) {
+		return
+	}
+	bs.lastSave = time.Now()
+	flag := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if !bs.created {
+		flag |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(fmt.Sprint(file), flag, 0644)
+	if err != nil {
+		log.Errorf("Error writing schedule for rater '%s': %s", bs.c.Name, err)
+		return
+	}
+	defer f.Close()
+	bs.created = true
+
+	// Bursts and outages are injected separately, so put them back in order of when they start
+	sort.SliceStable(bs.unsaved, func(i, j int) bool { return bs.unsaved[i].Start.Before(bs.unsaved[j].Start) })
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range bs.unsaved {
+		enc.Encode(struct {
+			Rater string `json:"rater"`
+			BurstEvent
+		}{Rater: bs.c.Name, BurstEvent: e})
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		log.Errorf("Error writing schedule for rater '%s': %s", bs.c.Name, err)
+		return
+	}
+	bs.unsaved = nil
+}
+
+// ResetBurstSchedules forgets every burst schedule, so a new run schedules its own bursts and outages
+func ResetBurstSchedules() {
+	burstSchedulesMutex.Lock()
+	defer burstSchedulesMutex.Unlock()
+	burstSchedules = make(map[string]*burstSchedule)
+}
+
+// SaveBurstSchedules writes any events not yet saved for every burst rater which has a Schedule file
+func SaveBurstSchedules() {
+	burstSchedulesMutex.Lock()
+	defer burstSchedulesMutex.Unlock()
+	for _, bs := range burstSchedules {
+		bs.mutex.Lock()
+		bs.save()
+		bs.mutex.Unlock()
+	}
+}
+
+// EventRate takes a given sample and current count and returns the rated count
+func (br *BurstRater) EventRate(s *config.Sample, now time.Time, count int) int {
+	return EventRate(s, now, count)
+}
+
+// TokenRate takes a token and returns the rated value
+func (br *BurstRater) TokenRate(t config.Token, now time.Time) float64 {
+	return TokenRate(t, now)
+}
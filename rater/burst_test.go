@@ -0,0 +1,136 @@
+package rater
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBurstRater(t *testing.T) {
+	// Setup environment
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "rater", "burstrater.yml"))
+	ResetBurstSchedules()
+
+	c := config.NewConfig()
+	r := c.FindRater("spiky")
+	br := BurstRater{c: r}
+
+	start := time.Date(2001, 10, 20, 0, 0, 0, 0, time.UTC)
+	var rates []float64
+	for i := 0; i < 2*24*60; i++ {
+		rates = append(rates, br.GetRate(start.Add(time.Duration(i)*time.Minute)))
+	}
+	schedule := br.Schedule()
+	bursts, outages := 0, 0
+	for _, e := range schedule {
+		if e.Type == "burst" {
+			bursts++
+			assert.Equal(t, 5*time.Minute, e.End.Sub(e.Start))
+			assert.True(t, e.Magnitude >= 4 && e.Magnitude <= 8, "magnitude %f out of bounds", e.Magnitude)
+		} else {
+			outages++
+			assert.Equal(t, 15*time.Minute, e.End.Sub(e.Start))
+		}
+	}
+	// Two days of bursts every half an hour and outages every four hours, on average
+	assert.InDelta(t, 96, bursts, 30)
+	assert.InDelta(t, 12, outages, 8)
+
+	// Every rate is what the schedule says it should be
+	for i, rate := range rates {
+		now := start.Add(time.Duration(i) * time.Minute)
+		expected := 1.0
+		for _, e := range schedule {
+			if e.Type == "burst" && !now.Before(e.Start) && now.Before(e.End) && e.Magnitude > expected {
+				expected = e.Magnitude
+			}
+		}
+		for _, e := range schedule {
+			if e.Type == "outage" && !now.Before(e.Start) && now.Before(e.End) {
+				expected = 0
+			}
+		}
+		assert.Equal(t, expected, rate, now.String())
+	}
+
+	// Raters with the same name share the schedule, even behind now
+	other := BurstRater{c: c.FindRater("spiky")}
+	for i := range rates {
+		assert.Equal(t, rates[i], other.GetRate(start.Add(time.Duration(i)*time.Minute)))
+	}
+	assert.Equal(t, schedule, other.Schedule())
+
+	// A new run with the same seed schedules the same events
+	ResetBurstSchedules()
+	again := BurstRater{c: c.FindRater("spiky")}
+	again.GetRate(start)
+	again.GetRate(start.Add(2 * 24 * time.Hour))
+	assert.Equal(t, schedule, again.Schedule()[:len(schedule)])
+}
+
+func TestBurstRaterSchedule(t *testing.T) {
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	os.Setenv("GOGEN_FULLCONFIG", "")
+	ResetBurstSchedules()
+	dir, err := ioutil.TempDir("", "burstschedule")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "schedule.json")
+
+	// The schedule is written as events are injected, not just when the run finishes, but a quick
+	// backfill doesn't write it on every injection
+	r := &config.RaterConfig{Name: "scheduled", Type: "burst", Options: map[string]interface{}{"BurstInterval": "10m", "Schedule": file}}
+	br := BurstRater{c: r}
+	start := time.Date(2001, 10, 20, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 24*60; i++ {
+		br.GetRate(start.Add(time.Duration(i) * time.Minute))
+	}
+	schedule := br.Schedule()
+	assert.NotEmpty(t, schedule)
+	saved := readSchedule(t, file)
+	assert.NotEmpty(t, saved)
+	assert.True(t, len(saved) < len(schedule), "saved %d of %d events", len(saved), len(schedule))
+
+	// Saving appends the rest
+	SaveBurstSchedules()
+	saved = readSchedule(t, file)
+	if assert.Equal(t, len(schedule), len(saved)) {
+		for i := range schedule {
+			assert.Equal(t, "scheduled", saved[i].Rater)
+			assert.True(t, schedule[i].Start.Equal(saved[i].Start))
+		}
+	}
+}
+
+type savedBurstEvent struct {
+	Rater string `json:"rater"`
+	BurstEvent
+}
+
+func readSchedule(t *testing.T, file string) []savedBurstEvent {
+	f, err := os.Open(file)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	defer f.Close()
+	var events []savedBurstEvent
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var e savedBurstEvent
+		if !assert.NoError(t, dec.Decode(&e)) {
+			break
+		}
+		events = append(events, e)
+	}
+	return events
+}
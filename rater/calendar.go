@@ -0,0 +1,82 @@
+package rater
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	log "github.com/coccyx/gogen/logger"
+)
+
+// CalendarRater rates by the calendar in a given Timezone.  Like ConfigRater it multiplies by
+// HourOfDay and MinuteOfHour, and the day is rated by DayOfWeek and DayOfMonth, where negative days
+// count back from the end of the month, unless Dates overrides the day, for holidays or one off
+// events.  Every one of Ranges the day falls in multiplies the rate further.
+type CalendarRater struct {
+	c *config.RaterConfig
+
+	loc  *time.Location
+	once sync.Once
+}
+
+// GetRate implements Rater interface
+func (cr *CalendarRater) GetRate(now time.Time) float64 {
+	cr.once.Do(func() {
+		cr.loc = time.Local
+		if tz, ok := cr.c.Options["Timezone"]; ok {
+			loc, err := time.LoadLocation(fmt.Sprint(tz))
+			if err != nil {
+				log.Errorf("Error loading timezone for rater '%s', using local time: %s", cr.c.Name, err)
+			} else {
+				cr.loc = loc
+			}
+		}
+	})
+	now = now.In(cr.loc)
+
+	rate := 1.0
+	rate *= cr.lookup("HourOfDay", now.Hour())
+	rate *= cr.lookup("MinuteOfHour", now.Minute())
+
+	date := now.Format("2006-01-02")
+	dates, _ := cr.c.Options["Dates"].(map[string]float64)
+	if r, ok := dates[date]; ok {
+		rate *= r
+	} else if r, ok := dates[date[5:]]; ok {
+		rate *= r
+	} else {
+		rate *= cr.lookup("DayOfWeek", int(now.Weekday()))
+		rate *= cr.lookup("DayOfMonth", now.Day())
+		daysInMonth := time.Date(now.Year(), now.Month()+1, 0, 0, 0, 0, 0, cr.loc).Day()
+		rate *= cr.lookup("DayOfMonth", now.Day()-daysInMonth-1)
+	}
+
+	ranges, _ := cr.c.Options["Ranges"].([]config.CalendarRange)
+	for _, r := range ranges {
+		if r.Contains(date) {
+			rate *= r.Rate
+		}
+	}
+	return rate
+}
+
+// lookup returns the rate for k in the option opt, or 1 if it's not set
+func (cr *CalendarRater) lookup(opt string, k int) float64 {
+	if m, ok := cr.c.Options[opt].(map[int]float64); ok {
+		if r, ok := m[k]; ok {
+			return r
+		}
+	}
+	return 1.0
+}
+
+// EventRate takes a given sample and current count and returns the rated count
+func (cr *CalendarRater) EventRate(s *config.Sample, now time.Time, count int) int {
+	return EventRate(s, now, count)
+}
+
+// TokenRate takes a token and returns the rated value
+func (cr *CalendarRater) TokenRate(t config.Token, now time.Time) float64 {
+	return TokenRate(t, now)
+}
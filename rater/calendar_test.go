@@ -0,0 +1,70 @@
+package rater
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalendarRater(t *testing.T) {
+	// Setup environment
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "rater", "calendarrater.yml"))
+
+	c := config.NewConfig()
+	r := c.FindRater("retail")
+	assert.Equal(t, map[string]float64{"2023-11-23": 0.5, "2023-11-24": 5.0, "12-25": 0.2}, r.Options["Dates"])
+	cr := CalendarRater{c: r}
+
+	loc, _ := time.LoadLocation("Local")
+	day := func(month time.Month, day int) time.Time {
+		return time.Date(2023, month, day, 12, 0, 0, 0, loc)
+	}
+	assert.InDelta(t, 1.0, cr.GetRate(day(time.March, 15)), 1e-9)
+	// Weekends
+	assert.InDelta(t, 0.5, cr.GetRate(day(time.March, 18)), 1e-9)
+	// Month end
+	assert.InDelta(t, 1.5, cr.GetRate(day(time.March, 31)), 1e-9)
+	assert.InDelta(t, 1.5, cr.GetRate(day(time.February, 28)), 1e-9)
+	// Dates override the day, ranges still apply
+	assert.InDelta(t, 0.5*2.0, cr.GetRate(day(time.November, 23)), 1e-9)
+	assert.InDelta(t, 5.0*2.0, cr.GetRate(day(time.November, 24)), 1e-9)
+	assert.InDelta(t, 0.2*2.0, cr.GetRate(day(time.December, 25)), 1e-9)
+	assert.InDelta(t, 0.5*1.5*2.0, cr.GetRate(day(time.December, 31)), 1e-9)
+	// Days of the year repeat every year
+	assert.InDelta(t, 0.2*2.0, cr.GetRate(time.Date(2030, time.December, 25, 12, 0, 0, 0, loc)), 1e-9)
+}
+
+func TestCalendarRaterTimezone(t *testing.T) {
+	// Setup environment
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "rater", "calendarrater.yml"))
+
+	c := config.NewConfig()
+	r := c.FindRater("tokyo")
+	// The quarter close is in the evening UTC, which is already the next day in Tokyo
+	assert.Equal(t, map[string]float64{"2024-01-01": 3.0, "2024-07-05": 3.0, "2024-07-06": 3.0, "2024-07-07": 3.0,
+		"2024-10-01": 3.0, "12-25": 3.0}, r.Options["Dates"])
+	cr := CalendarRater{c: r}
+
+	// 9am in Tokyo is midnight UTC
+	assert.InDelta(t, 2.0, cr.GetRate(time.Date(2024, time.March, 12, 0, 0, 0, 0, time.UTC)), 1e-9)
+	assert.InDelta(t, 1.0, cr.GetRate(time.Date(2024, time.March, 12, 9, 0, 0, 0, time.UTC)), 1e-9)
+	// Already the 1st in Tokyo
+	assert.InDelta(t, 1.5, cr.GetRate(time.Date(2024, time.March, 31, 16, 0, 0, 0, time.UTC)), 1e-9)
+	// Ranges wrapping the new year, and holidays from the iCalendar file
+	assert.InDelta(t, 0.5, cr.GetRate(time.Date(2024, time.December, 30, 12, 0, 0, 0, time.UTC)), 1e-9)
+	assert.InDelta(t, 3.0*0.5, cr.GetRate(time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)), 1e-9)
+	assert.InDelta(t, 3.0*1.2, cr.GetRate(time.Date(2024, time.July, 7, 12, 0, 0, 0, time.UTC)), 1e-9)
+	assert.InDelta(t, 1.2, cr.GetRate(time.Date(2024, time.July, 8, 12, 0, 0, 0, time.UTC)), 1e-9)
+	// Yearly events repeat every year
+	assert.InDelta(t, 3.0, cr.GetRate(time.Date(2031, time.December, 25, 3, 0, 0, 0, time.UTC)), 1e-9)
+}
@@ -0,0 +1,48 @@
+package rater
+
+import (
+	"sync"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+)
+
+// CompositeRater combines other named raters, multiplying their rates together by default or
+// adding them up with an Operation of add
+type CompositeRater struct {
+	c *config.RaterConfig
+
+	raters []config.Rater
+	once   sync.Once
+}
+
+// GetRate implements Rater interface
+func (cr *CompositeRater) GetRate(now time.Time) float64 {
+	cr.once.Do(func() {
+		for _, name := range cr.c.Options["Raters"].([]string) {
+			cr.raters = append(cr.raters, GetRater(name))
+		}
+	})
+	if cr.c.Options["Operation"] == "add" {
+		rate := 0.0
+		for _, r := range cr.raters {
+			rate += r.GetRate(now)
+		}
+		return rate
+	}
+	rate := 1.0
+	for _, r := range cr.raters {
+		rate *= r.GetRate(now)
+	}
+	return rate
+}
+
+// EventRate takes a given sample and current count and returns the rated count
+func (cr *CompositeRater) EventRate(s *config.Sample, now time.Time, count int) int {
+	return EventRate(s, now, count)
+}
+
+// TokenRate takes a token and returns the rated value
+func (cr *CompositeRater) TokenRate(t config.Token, now time.Time) float64 {
+	return TokenRate(t, now)
+}
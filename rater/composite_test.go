@@ -0,0 +1,55 @@
+package rater
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompositeRater(t *testing.T) {
+	// Setup environment
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "rater", "curvesrater.yml"))
+
+	c := config.NewConfig()
+	r := c.FindRater("business")
+	assert.Equal(t, []string{"daily", "diurnal"}, r.Options["Raters"])
+	cr := CompositeRater{c: r}
+
+	loc, _ := time.LoadLocation("Local")
+	at := func(hour, min int) time.Time {
+		return time.Date(2001, 10, 20, hour, min, 0, 0, loc)
+	}
+	// At two daily is a third of the way from 0.5 to 1 and diurnal is at its lowest
+	assert.InDelta(t, 2.0/3*0.5, cr.GetRate(at(2, 0)), 1e-9)
+	// At eight daily is a sixth of the way from 3 back down to 0.5 and diurnal is at its middle
+	assert.InDelta(t, 13.0/6*1.0, cr.GetRate(at(20, 0)), 1e-9)
+
+	r = c.FindRater("combined")
+	cr = CompositeRater{c: r}
+	// hourly peaks at half past every hour and is at its lowest on the hour
+	assert.InDelta(t, 2.0/3*0.5+0.0, cr.GetRate(at(2, 0)), 1e-9)
+	assert.InDelta(t, 13.0/6*1.0+0.0, cr.GetRate(at(20, 0)), 1e-9)
+}
+
+func TestCompositeRaterEventRate(t *testing.T) {
+	// Setup environment
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "rater", "curvesrater.yml"))
+
+	c := config.NewConfig()
+	s := c.FindSampleByName("curves")
+	assert.Equal(t, "business", s.RaterString)
+	loc, _ := time.LoadLocation("Local")
+	ret := EventRate(s, time.Date(2001, 10, 20, 2, 0, 0, 0, loc), 100)
+	assert.IsType(t, &CompositeRater{}, s.Rater)
+	assert.Equal(t, 33, ret)
+}
@@ -0,0 +1,79 @@
+package rater
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+)
+
+// InterpolatedRater draws a smooth curve through rates anchored at times of day, wrapping around
+// midnight so the last point of the day flows into the first
+type InterpolatedRater struct {
+	c *config.RaterConfig
+
+	points []point
+	once   sync.Once
+}
+
+type point struct {
+	at   float64 // seconds since midnight
+	rate float64
+}
+
+// GetRate implements Rater interface
+func (ir *InterpolatedRater) GetRate(now time.Time) float64 {
+	ir.once.Do(ir.parse)
+	if len(ir.points) == 0 {
+		return 1.0
+	}
+	tod := secondsOfDay(now)
+
+	// Find the anchors either side of now, the one before it may be yesterday's last
+	i := sort.Search(len(ir.points), func(i int) bool { return ir.points[i].at > tod })
+	before, after := ir.points[len(ir.points)-1], ir.points[0]
+	if i > 0 {
+		before = ir.points[i-1]
+	}
+	if i < len(ir.points) {
+		after = ir.points[i]
+	}
+	span := after.at - before.at
+	if span <= 0 {
+		span += 86400
+	}
+	elapsed := tod - before.at
+	if elapsed < 0 {
+		elapsed += 86400
+	}
+	x := elapsed / span
+	if ir.c.Options["Interpolation"] == "cosine" {
+		x = (1 - math.Cos(x*math.Pi)) / 2
+	}
+	return before.rate + (after.rate-before.rate)*x
+}
+
+func (ir *InterpolatedRater) parse() {
+	for tod, rate := range ir.c.Options["Points"].(map[string]float64) {
+		t, _ := time.Parse("15:04", tod)
+		ir.points = append(ir.points, point{at: float64(t.Hour()*3600 + t.Minute()*60), rate: rate})
+	}
+	sort.Slice(ir.points, func(i, j int) bool { return ir.points[i].at < ir.points[j].at })
+}
+
+// secondsOfDay returns how far into its day now is, in seconds
+func secondsOfDay(now time.Time) float64 {
+	return float64(now.Hour()*3600+now.Minute()*60+now.Second()) + float64(now.Nanosecond())/1e9
+}
+
+// EventRate takes a given sample and current count and returns the rated count
+func (ir *InterpolatedRater) EventRate(s *config.Sample, now time.Time, count int) int {
+	return EventRate(s, now, count)
+}
+
+// TokenRate takes a token and returns the rated value
+func (ir *InterpolatedRater) TokenRate(t config.Token, now time.Time) float64 {
+	return TokenRate(t, now)
+}
@@ -0,0 +1,59 @@
+package rater
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterpolatedRater(t *testing.T) {
+	// Setup environment
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "rater", "curvesrater.yml"))
+
+	c := config.NewConfig()
+	r := c.FindRater("daily")
+	assert.Equal(t, map[string]float64{"00:00": 0.5, "06:00": 1.0, "18:00": 3.0}, r.Options["Points"])
+	ir := InterpolatedRater{c: r}
+
+	loc, _ := time.LoadLocation("Local")
+	at := func(hour, min int) time.Time {
+		return time.Date(2001, 10, 20, hour, min, 0, 0, loc)
+	}
+	assert.InDelta(t, 0.5, ir.GetRate(at(0, 0)), 1e-9)
+	assert.InDelta(t, 0.75, ir.GetRate(at(3, 0)), 1e-9)
+	assert.InDelta(t, 1.0, ir.GetRate(at(6, 0)), 1e-9)
+	assert.InDelta(t, 2.0, ir.GetRate(at(12, 0)), 1e-9)
+	// Wraps around midnight from the last point of the day to the first
+	assert.InDelta(t, 1.75, ir.GetRate(at(21, 0)), 1e-9)
+
+	r = c.FindRater("smoothdaily")
+	ir = InterpolatedRater{c: r}
+	assert.InDelta(t, 1.0, ir.GetRate(at(6, 0)), 1e-9)
+	assert.InDelta(t, 2.0, ir.GetRate(at(12, 0)), 1e-9)
+	assert.InDelta(t, 2.0, ir.GetRate(at(0, 0)), 1e-9)
+	// Cosine eases in, so a quarter of the way along is less than a quarter of the way up
+	assert.InDelta(t, 1+(1-0.7071067811865476), ir.GetRate(at(9, 0)), 1e-9)
+}
+
+func TestInterpolatedRaterEventRate(t *testing.T) {
+	// Setup environment
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "rater", "curvesrater.yml"))
+
+	c := config.NewConfig()
+	s := c.FindSampleByName("curves")
+	s.RaterString = "daily"
+	loc, _ := time.LoadLocation("Local")
+	ret := EventRate(s, time.Date(2001, 10, 20, 12, 0, 0, 0, loc), 10)
+	assert.IsType(t, &InterpolatedRater{}, s.Rater)
+	assert.Equal(t, 20, ret)
+}
@@ -0,0 +1,88 @@
+package rater
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+)
+
+// maxWalkSteps caps how many steps the walk takes to catch up to now, so a jump far into the
+// future costs no more than this and the walk's history is forgotten
+const maxWalkSteps = 1000
+
+// RandomWalkRater wanders randomly around Mean, taking one step every Interval.  Each step moves
+// by a normally distributed amount with StdDev and is pulled back towards Mean by Reversion, so a
+// Reversion of 1 gives independent noise around Mean and a small Reversion gives a slow drift.
+type RandomWalkRater struct {
+	c *config.RaterConfig
+
+	mean, stddev, reversion float64
+	min, max                float64
+	interval                time.Duration
+
+	rate  float64
+	last  time.Time
+	rand  *rand.Rand
+	mutex sync.Mutex
+}
+
+// GetRate implements Rater interface
+func (rr *RandomWalkRater) GetRate(now time.Time) float64 {
+	rr.mutex.Lock()
+	defer rr.mutex.Unlock()
+	if rr.rand == nil {
+		rr.init()
+	}
+	step := now.Truncate(rr.interval)
+	if rr.last.IsZero() {
+		rr.last = step
+		return rr.rate
+	}
+	steps := int(step.Sub(rr.last) / rr.interval)
+	if steps > maxWalkSteps {
+		steps = maxWalkSteps
+	}
+	for i := 0; i < steps; i++ {
+		rr.rate += rr.reversion*(rr.mean-rr.rate) + rr.stddev*rr.rand.NormFloat64()
+		rr.rate = math.Max(rr.min, math.Min(rr.max, rr.rate))
+	}
+	if step.After(rr.last) {
+		rr.last = step
+	}
+	return rr.rate
+}
+
+func (rr *RandomWalkRater) init() {
+	c := config.NewConfig()
+	rr.rand = config.NewRand(c.Global.Seed, rr.c.Name)
+	option := func(k string, def float64) float64 {
+		if v, ok := rr.c.Options[k]; ok {
+			return v.(float64)
+		}
+		return def
+	}
+	rr.mean = option("Mean", 1.0)
+	rr.stddev = option("StdDev", 0.05)
+	rr.reversion = option("Reversion", 0.1)
+	rr.min = option("Min", 0.0)
+	rr.max = option("Max", math.Inf(1))
+	rr.interval = time.Minute
+	if v, ok := rr.c.Options["Interval"]; ok {
+		rr.interval, _ = time.ParseDuration(fmt.Sprint(v))
+	}
+	rr.rate = math.Max(rr.min, math.Min(rr.max, rr.mean))
+}
+
+// EventRate takes a given sample and current count and returns the rated count
+func (rr *RandomWalkRater) EventRate(s *config.Sample, now time.Time, count int) int {
+	return EventRate(s, now, count)
+}
+
+// TokenRate takes a token and returns the rated value
+func (rr *RandomWalkRater) TokenRate(t config.Token, now time.Time) float64 {
+	return TokenRate(t, now)
+}
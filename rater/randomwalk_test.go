@@ -0,0 +1,50 @@
+package rater
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRandomWalkRater(t *testing.T) {
+	// Setup environment
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "rater", "curvesrater.yml"))
+
+	c := config.NewConfig()
+	r := c.FindRater("walk")
+	rr := RandomWalkRater{c: r}
+
+	start := time.Date(2001, 10, 20, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, 1.0, rr.GetRate(start))
+	// Within the same interval the rate holds still
+	assert.Equal(t, 1.0, rr.GetRate(start.Add(5*time.Second)))
+
+	var rates []float64
+	for i := 1; i <= 500; i++ {
+		rate := rr.GetRate(start.Add(time.Duration(i) * 10 * time.Second))
+		assert.True(t, rate >= 0.5 && rate <= 1.5, "rate %f out of bounds", rate)
+		rates = append(rates, rate)
+	}
+	moved := 0
+	for i := 1; i < len(rates); i++ {
+		if rates[i] != rates[i-1] {
+			moved++
+		}
+	}
+	assert.True(t, moved > 400)
+
+	// The same seed walks the same way
+	a := RandomWalkRater{c: c.FindRater("walk")}
+	b := RandomWalkRater{c: c.FindRater("walk")}
+	for i := 0; i < 50; i++ {
+		now := start.Add(time.Duration(i) * time.Minute)
+		assert.Equal(t, a.GetRate(now), b.GetRate(now))
+	}
+}
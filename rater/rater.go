@@ -14,7 +14,7 @@ func EventRate(s *config.Sample, now time.Time, count int) (ret int) {
 		s.Rater = GetRater(s.RaterString)
 		log.Infof("Setting rater to type %s, for sample '%s'", reflect.TypeOf(s.Rater), s.Name)
 	}
-	rate := s.Rater.GetRate(now)
+	rate := s.Rater.GetRate(now) * s.ScenarioRate(now)
 	ratedCount := rate * float64(count)
 	if ratedCount < 0 {
 		ret = int(ratedCount - 0.5)
@@ -39,10 +39,25 @@ func GetRater(name string) (ret config.Rater) {
 	} else if r.Name == "default" {
 		r := c.FindRater("default")
 		ret = &DefaultRater{c: r}
-	} else if r.Type == "config" {
-		ret = &ConfigRater{c: r}
 	} else {
-		ret = &ScriptRater{c: r}
+		switch r.Type {
+		case "config":
+			ret = &ConfigRater{c: r}
+		case "interpolated":
+			ret = &InterpolatedRater{c: r}
+		case "burst":
+			ret = &BurstRater{c: r}
+		case "calendar":
+			ret = &CalendarRater{c: r}
+		case "sinusoidal":
+			ret = &SinusoidalRater{c: r}
+		case "randomwalk":
+			ret = &RandomWalkRater{c: r}
+		case "composite":
+			ret = &CompositeRater{c: r}
+		default:
+			ret = &ScriptRater{c: r}
+		}
 	}
 	return ret
 }
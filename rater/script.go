@@ -1,6 +1,8 @@
 package rater
 
 import (
+	"math/rand"
+	"sync"
 	"time"
 
 	config "github.com/coccyx/gogen/internal"
@@ -13,26 +15,44 @@ import (
 type ScriptRater struct {
 	c *config.RaterConfig
 
-	L        *lua.LState
+	script   *config.LuaScript
 	luaState *lua.LTable
+	rand     *rand.Rand
+	lib      *config.LuaLibrary
+	mutex    sync.Mutex
 }
 
 // GetRate implements Rater interface
 func (sr *ScriptRater) GetRate(now time.Time) float64 {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	if sr.rand == nil {
+		c := config.NewConfig()
+		sr.rand = config.NewRand(c.Global.Seed, sr.c.Name)
+		sr.lib = c.LuaLibrary()
+	}
 	if sr.luaState == nil {
 		sr.luaState = new(lua.LTable)
 		for k, v := range sr.c.Init {
 			sr.luaState.RawSet(lua.LString(k), lua.LString(v))
 		}
 	}
-	L := lua.NewState()
-	defer L.Close()
-	L.SetGlobal("state", sr.luaState)
-	L.SetGlobal("options", luar.New(L, sr.c.Options))
-	if err := L.DoString(sr.c.Script); err != nil {
+	if sr.script == nil {
+		script, err := config.NewLuaScript(sr.c.Name, sr.c.Script, sr.luaState, func(L *lua.LState) {
+			sr.lib.Open(L)
+			L.SetGlobal("options", luar.New(L, sr.c.Options))
+		})
+		if err != nil {
+			log.Errorf("Error compiling script for rater '%s': %s", sr.c.Name, err)
+			return 0
+		}
+		sr.script = script
+	}
+	ret, err := sr.script.Run(sr.rand)
+	if err != nil {
 		log.Errorf("Error executing script for rater '%s': %s", sr.c.Name, err)
 	}
-	return float64(lua.LVAsNumber(L.Get(-1)))
+	return float64(lua.LVAsNumber(ret))
 }
 
 // EventRate takes a given sample and current count and returns the rated count
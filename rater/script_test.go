@@ -24,6 +24,19 @@ func TestScriptRater(t *testing.T) {
 	assert.Equal(t, float64(2), ret)
 }
 
+func TestScriptRaterModules(t *testing.T) {
+	// Setup environment
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "lua", "modules.yml"))
+
+	c := config.NewConfig()
+	r := c.FindRater("modulerater")
+	dr := ScriptRater{c: r}
+	assert.Equal(t, float64(2), dr.GetRate(time.Now()))
+}
+
 func TestScriptRaterEventRate(t *testing.T) {
 	// Setup environment
 	os.Setenv("GOGEN_HOME", "..")
@@ -41,3 +54,18 @@ func TestScriptRaterEventRate(t *testing.T) {
 	assert.True(t, assert.ObjectsAreEqual(r, s.Rater.(*ScriptRater).c))
 	assert.Equal(t, 2, ret)
 }
+
+func BenchmarkScriptRater(b *testing.B) {
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "rater", "luarater.yml"))
+
+	c := config.NewConfig()
+	dr := ScriptRater{c: c.FindRater("multiply")}
+	now := time.Now()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		dr.GetRate(now)
+	}
+}
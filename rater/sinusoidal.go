@@ -0,0 +1,51 @@
+package rater
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+)
+
+// SinusoidalRater follows a sine wave between Min and Max, peaking at Peak and repeating every
+// Period, which by default gives a smooth diurnal pattern peaking at noon
+type SinusoidalRater struct {
+	c *config.RaterConfig
+}
+
+// GetRate implements Rater interface
+func (sr *SinusoidalRater) GetRate(now time.Time) float64 {
+	min, max := 0.0, 1.0
+	if v, ok := sr.c.Options["Min"]; ok {
+		min = v.(float64)
+	}
+	if v, ok := sr.c.Options["Max"]; ok {
+		max = v.(float64)
+	}
+	peak := 12 * time.Hour
+	if v, ok := sr.c.Options["Peak"]; ok {
+		t, _ := time.Parse("15:04", fmt.Sprint(v))
+		peak = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	period := 24 * time.Hour
+	if v, ok := sr.c.Options["Period"]; ok {
+		period, _ = time.ParseDuration(fmt.Sprint(v))
+	}
+
+	// Measure from a local midnight so a peak at a time of day lines up with the wall clock
+	_, offset := now.Zone()
+	local := float64(now.Unix()+int64(offset)) + float64(now.Nanosecond())/1e9
+	x := (local - peak.Seconds()) / period.Seconds()
+	return (max+min)/2 + (max-min)/2*math.Cos(2*math.Pi*x)
+}
+
+// EventRate takes a given sample and current count and returns the rated count
+func (sr *SinusoidalRater) EventRate(s *config.Sample, now time.Time, count int) int {
+	return EventRate(s, now, count)
+}
+
+// TokenRate takes a token and returns the rated value
+func (sr *SinusoidalRater) TokenRate(t config.Token, now time.Time) float64 {
+	return TokenRate(t, now)
+}
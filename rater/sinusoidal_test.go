@@ -0,0 +1,38 @@
+package rater
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSinusoidalRater(t *testing.T) {
+	// Setup environment
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "rater", "curvesrater.yml"))
+
+	c := config.NewConfig()
+	r := c.FindRater("diurnal")
+	sr := SinusoidalRater{c: r}
+
+	loc, _ := time.LoadLocation("Local")
+	at := func(hour, min int) time.Time {
+		return time.Date(2001, 10, 20, hour, min, 0, 0, loc)
+	}
+	assert.InDelta(t, 1.5, sr.GetRate(at(14, 0)), 1e-9)
+	assert.InDelta(t, 0.5, sr.GetRate(at(2, 0)), 1e-9)
+	assert.InDelta(t, 1.0, sr.GetRate(at(8, 0)), 1e-9)
+	assert.InDelta(t, 1.0, sr.GetRate(at(20, 0)), 1e-9)
+
+	r = c.FindRater("hourly")
+	sr = SinusoidalRater{c: r}
+	assert.InDelta(t, 2.0, sr.GetRate(at(9, 30)), 1e-9)
+	assert.InDelta(t, 0.0, sr.GetRate(at(13, 0)), 1e-9)
+	assert.InDelta(t, 1.0, sr.GetRate(at(17, 15)), 1e-9)
+}
@@ -0,0 +1,317 @@
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	log "github.com/coccyx/gogen/logger"
+	"github.com/coccyx/gogen/metrics"
+	"github.com/coccyx/gogen/rater"
+	"github.com/coccyx/gogen/timer"
+)
+
+// sampleStatus describes a sample's settings and what it has generated so far
+type sampleStatus struct {
+	Name            string  `json:"name"`
+	Generator       string  `json:"generator"`
+	Running         bool    `json:"running"`
+	Disabled        bool    `json:"disabled"`
+	Paused          bool    `json:"paused"`
+	Count           int     `json:"count"`
+	Interval        int     `json:"interval"`
+	Rater           string  `json:"rater,omitempty"`
+	EventsGenerated float64 `json:"eventsGenerated"`
+	EventsWritten   float64 `json:"eventsWritten"`
+	BytesWritten    float64 `json:"bytesWritten"`
+	OutputErrors    float64 `json:"outputErrors"`
+}
+
+// sampleUpdate changes a running sample.  Fields left out are unchanged, and if For is set the
+// changes are reverted after that duration.
+type sampleUpdate struct {
+	Disabled *bool   `json:"disabled,omitempty"`
+	Count    *int    `json:"count,omitempty"`
+	Interval *int    `json:"interval,omitempty"`
+	Rater    *string `json:"rater,omitempty"`
+	For      string  `json:"for,omitempty"`
+}
+
+// burstRequest asks for Count events to be generated immediately
+type burstRequest struct {
+	Count int `json:"count"`
+}
+
+// apiError is returned with an HTTP status code as an error
+type apiError struct {
+	code int
+	msg  string
+}
+
+func (e *apiError) Error() string {
+	return e.msg
+}
+
+func newAPIError(code int, format string, args ...interface{}) *apiError {
+	return &apiError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// api serves a REST API to see and control the samples while we're generating:
+//
+//	GET   /api/samples                 list samples with their settings and stats
+//	GET   /api/samples/<name>          get one sample
+//	PATCH /api/samples/<name>          change disabled, count, interval or rater, optionally "for" a duration
+//	POST  /api/samples/<name>/enable   enable a sample, starting it if it was disabled at startup
+//	POST  /api/samples/<name>/disable  stop a sample generating
+//	POST  /api/samples/<name>/pause    pause a sample
+//	POST  /api/samples/<name>/resume   resume a paused sample
+//	POST  /api/samples/<name>/burst    generate {"count": n} events immediately
+//	POST  /api/pause                   pause all samples
+//	POST  /api/resume                  resume all samples
+type api struct {
+	ts *timerSet
+}
+
+// serveAPI starts serving the API on addr, returning the server so it can be closed
+func serveAPI(addr string, ts *timerSet) (*http.Server, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{Handler: &api{ts: ts}}
+	log.Infof("Serving API at http://%s/api/samples", l.Addr())
+	go func() {
+		if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Errorf("Error serving API on '%s': %s", addr, err)
+		}
+	}()
+	return srv, nil
+}
+
+func (a *api) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ret, err := a.route(r)
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		code := http.StatusInternalServerError
+		if ae, ok := err.(*apiError); ok {
+			code = ae.code
+		}
+		w.WriteHeader(code)
+		ret = map[string]string{"error": err.Error()}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(ret)
+}
+
+func (a *api) route(r *http.Request) (interface{}, error) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "api" {
+		return nil, newAPIError(http.StatusNotFound, "Not found: %s", r.URL.Path)
+	}
+	switch {
+	case len(parts) == 2 && (parts[1] == "pause" || parts[1] == "resume"):
+		if r.Method != http.MethodPost {
+			return nil, newAPIError(http.StatusMethodNotAllowed, "Method %s not allowed", r.Method)
+		}
+		a.ts.setPaused(parts[1] == "pause")
+		return a.list(), nil
+	case len(parts) == 2 && parts[1] == "samples":
+		if r.Method != http.MethodGet {
+			return nil, newAPIError(http.StatusMethodNotAllowed, "Method %s not allowed", r.Method)
+		}
+		return a.list(), nil
+	case len(parts) == 3 && parts[1] == "samples":
+		s := a.ts.find(parts[2])
+		if s == nil {
+			return nil, newAPIError(http.StatusNotFound, "Sample '%s' not found", parts[2])
+		}
+		switch r.Method {
+		case http.MethodGet:
+			return a.status(s), nil
+		case http.MethodPatch, http.MethodPost:
+			var u sampleUpdate
+			if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+				return nil, newAPIError(http.StatusBadRequest, "Error decoding request: %s", err)
+			}
+			if err := a.update(s, u); err != nil {
+				return nil, err
+			}
+			return a.status(s), nil
+		}
+		return nil, newAPIError(http.StatusMethodNotAllowed, "Method %s not allowed", r.Method)
+	case len(parts) == 4 && parts[1] == "samples":
+		if r.Method != http.MethodPost {
+			return nil, newAPIError(http.StatusMethodNotAllowed, "Method %s not allowed", r.Method)
+		}
+		s := a.ts.find(parts[2])
+		if s == nil {
+			return nil, newAPIError(http.StatusNotFound, "Sample '%s' not found", parts[2])
+		}
+		if err := a.action(s, parts[3], r); err != nil {
+			return nil, err
+		}
+		return a.status(s), nil
+	}
+	return nil, newAPIError(http.StatusNotFound, "Not found: %s", r.URL.Path)
+}
+
+func (a *api) list() []sampleStatus {
+	samples := a.ts.samples()
+	ret := make([]sampleStatus, 0, len(samples))
+	for _, s := range samples {
+		ret = append(ret, a.status(s))
+	}
+	return ret
+}
+
+func (a *api) status(s *config.Sample) sampleStatus {
+	ret := sampleStatus{
+		Name:            s.Name,
+		Generator:       s.Generator,
+		EventsGenerated: metrics.EventsGenerated.Value(s.Name),
+		EventsWritten:   metrics.EventsWritten.Value(s.Name),
+		BytesWritten:    metrics.BytesWritten.Value(s.Name),
+		OutputErrors:    metrics.OutputErrors.Value(s.Name),
+	}
+	st, running := a.ts.settings(s)
+	ret.Running = running
+	ret.Disabled, ret.Paused = st.Disabled, st.Paused
+	ret.Count, ret.Interval, ret.Rater = st.Count, st.Interval, st.Rater
+	return ret
+}
+
+// running returns the sample's timer, or an error if it isn't running
+func (a *api) running(s *config.Sample) (*timer.Timer, error) {
+	t := a.ts.get(s.Name)
+	if t == nil {
+		return nil, newAPIError(http.StatusConflict, "Sample '%s' is not running, enable it first", s.Name)
+	}
+	return t, nil
+}
+
+func (a *api) action(s *config.Sample, action string, r *http.Request) error {
+	switch action {
+	case "enable", "disable":
+		disabled := action == "disable"
+		return a.update(s, sampleUpdate{Disabled: &disabled})
+	case "pause", "resume":
+		t, err := a.running(s)
+		if err != nil {
+			return err
+		}
+		if action == "pause" {
+			t.Pause()
+		} else {
+			t.Resume()
+		}
+		return nil
+	case "burst":
+		t, err := a.running(s)
+		if err != nil {
+			return err
+		}
+		var b burstRequest
+		if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+			return newAPIError(http.StatusBadRequest, "Error decoding request: %s", err)
+		}
+		if b.Count <= 0 {
+			return newAPIError(http.StatusBadRequest, "Burst count must be greater than 0")
+		}
+		if s.Generator == "replay" {
+			return newAPIError(http.StatusBadRequest, "Cannot burst replay sample '%s'", s.Name)
+		}
+		log.Infof("Bursting %d events for sample '%s'", b.Count, s.Name)
+		go t.Burst(b.Count)
+		return nil
+	}
+	return newAPIError(http.StatusNotFound, "Unknown action '%s'", action)
+}
+
+// update applies u to s, reverting it later if asked to
+func (a *api) update(s *config.Sample, u sampleUpdate) error {
+	var revert time.Duration
+	if u.For != "" {
+		var err error
+		if revert, err = time.ParseDuration(u.For); err != nil || revert <= 0 {
+			return newAPIError(http.StatusBadRequest, "Invalid duration '%s'", u.For)
+		}
+	}
+	if u.Count != nil && *u.Count < 0 {
+		return newAPIError(http.StatusBadRequest, "Count must not be negative")
+	}
+	if u.Interval != nil && *u.Interval < 1 {
+		return newAPIError(http.StatusBadRequest, "Interval must be at least 1")
+	}
+	if u.Rater != nil && *u.Rater != "" && !a.ts.hasRater(*u.Rater) {
+		return newAPIError(http.StatusBadRequest, "Rater '%s' not found", *u.Rater)
+	}
+
+	prev, running := a.ts.settings(s)
+	// Samples which aren't running can only be enabled, or disabled again
+	if !running && (u.Disabled == nil || u.Count != nil || u.Interval != nil || u.Rater != nil || revert > 0) {
+		_, err := a.running(s)
+		return err
+	}
+	if err := a.apply(s, u); err != nil {
+		return err
+	}
+	if revert > 0 {
+		undo := sampleUpdate{}
+		if u.Disabled != nil {
+			undo.Disabled = &prev.Disabled
+		}
+		if u.Count != nil {
+			undo.Count = &prev.Count
+		}
+		if u.Interval != nil {
+			undo.Interval = &prev.Interval
+		}
+		if u.Rater != nil {
+			undo.Rater = &prev.Rater
+		}
+		time.AfterFunc(revert, func() {
+			log.Infof("Reverting changes to sample '%s' after %s", s.Name, revert)
+			if err := a.apply(s, undo); err != nil {
+				log.Errorf("Error reverting changes to sample '%s': %s", s.Name, err)
+			}
+		})
+	}
+	return nil
+}
+
+// apply applies u to s.  Enabling starts the sample's timer before the other settings change, and
+// disabling stops it after.
+func (a *api) apply(s *config.Sample, u sampleUpdate) error {
+	if u.Disabled != nil && !*u.Disabled {
+		if err := a.ts.enable(s); err != nil {
+			return newAPIError(http.StatusConflict, "%s", err)
+		}
+	}
+	if u.Count != nil || u.Interval != nil || u.Rater != nil {
+		t, err := a.running(s)
+		if err != nil {
+			return err
+		}
+		if u.Count != nil {
+			log.Infof("Setting count to %d for sample '%s'", *u.Count, s.Name)
+			t.SetCount(*u.Count)
+		}
+		if u.Interval != nil {
+			log.Infof("Setting interval to %d for sample '%s'", *u.Interval, s.Name)
+			t.SetInterval(*u.Interval)
+		}
+		if u.Rater != nil {
+			log.Infof("Setting rater to '%s' for sample '%s'", *u.Rater, s.Name)
+			t.SetRater(*u.Rater, rater.GetRater(*u.Rater))
+		}
+	}
+	if u.Disabled != nil && *u.Disabled {
+		a.ts.disable(s)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func apiRequest(t *testing.T, method string, url string, body string, ret interface{}) int {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	assert.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	if ret != nil {
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(ret))
+	}
+	return resp.StatusCode
+}
+
+func TestAPI(t *testing.T) {
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join("..", "tests", "shutdown", "shutdown.yml"))
+	c := config.NewConfig()
+	s := c.FindSampleByName("shutdown")
+	s.Disabled = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gq := make(chan *config.GenQueueItem, 100)
+	oq := make(chan *config.OutQueueItem)
+	counts := make(chan int, 100)
+	go func() {
+		for item := range gq {
+			counts <- item.Count
+		}
+	}()
+	ts := newTimerSet(ctx, c, gq, oq)
+	srv := httptest.NewServer(&api{ts: ts})
+	defer srv.Close()
+	url := srv.URL + "/api/samples/shutdown"
+
+	var list []sampleStatus
+	assert.Equal(t, http.StatusOK, apiRequest(t, "GET", srv.URL+"/api/samples", "", &list))
+	assert.Equal(t, 1, len(list))
+	assert.Equal(t, sampleStatus{Name: "shutdown", Generator: "sample", Disabled: true, Count: 2, Interval: 1, Rater: "default"}, list[0])
+
+	// Disabled at startup, so nothing can be changed until it's enabled
+	var status sampleStatus
+	assert.Equal(t, http.StatusConflict, apiRequest(t, "PATCH", url, `{"count": 5}`, nil))
+	assert.Equal(t, http.StatusOK, apiRequest(t, "POST", url+"/enable", "", &status))
+	assert.True(t, status.Running)
+	assert.False(t, status.Disabled)
+
+	assert.Equal(t, http.StatusOK, apiRequest(t, "PATCH", url, `{"count": 5, "interval": 2, "for": "200ms"}`, &status))
+	assert.Equal(t, 5, status.Count)
+	assert.Equal(t, 2, status.Interval)
+	time.Sleep(400 * time.Millisecond)
+	assert.Equal(t, http.StatusOK, apiRequest(t, "GET", url, "", &status))
+	assert.Equal(t, 2, status.Count)
+	assert.Equal(t, 1, status.Interval)
+
+	assert.Equal(t, http.StatusOK, apiRequest(t, "POST", srv.URL+"/api/pause", "", &list))
+	assert.True(t, list[0].Paused)
+	assert.Equal(t, http.StatusOK, apiRequest(t, "POST", url+"/burst", `{"count": 50}`, nil))
+	found := false
+	for !found {
+		select {
+		case count := <-counts:
+			found = count == 50
+		case <-time.After(2 * time.Second):
+			assert.Fail(t, "burst not queued")
+			found = true
+		}
+	}
+	assert.Equal(t, http.StatusOK, apiRequest(t, "POST", url+"/resume", "", &status))
+	assert.False(t, status.Paused)
+
+	// Disabling stops the timer, but generation carries on until it's enabled again
+	assert.Equal(t, http.StatusOK, apiRequest(t, "POST", url+"/disable", "", &status))
+	assert.False(t, status.Running)
+	assert.True(t, status.Disabled)
+	select {
+	case <-ts.done:
+		assert.False(t, ts.timerDone())
+	case <-time.After(2 * time.Second):
+		assert.Fail(t, "timer not stopped")
+	}
+	assert.Equal(t, http.StatusOK, apiRequest(t, "POST", url+"/disable", "", nil))
+	assert.Equal(t, http.StatusConflict, apiRequest(t, "PATCH", url, `{"count": 5}`, nil))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			apiRequest(t, "GET", url, "", nil)
+		}
+	}()
+	assert.Equal(t, http.StatusOK, apiRequest(t, "POST", url+"/enable", "", &status))
+	<-done
+	assert.True(t, status.Running)
+	assert.False(t, status.Disabled)
+	assert.Equal(t, 2, status.Count)
+
+	assert.Equal(t, http.StatusBadRequest, apiRequest(t, "PATCH", url, `{"rater": "nosuchrater"}`, nil))
+	assert.Equal(t, http.StatusBadRequest, apiRequest(t, "PATCH", url, `{"count": 5, "for": "soon"}`, nil))
+	assert.Equal(t, http.StatusBadRequest, apiRequest(t, "POST", url+"/burst", `{"count": 0}`, nil))
+	assert.Equal(t, http.StatusNotFound, apiRequest(t, "GET", srv.URL+"/api/samples/nosuchsample", "", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, apiRequest(t, "DELETE", url, "", nil))
+}
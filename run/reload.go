@@ -0,0 +1,112 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	log "github.com/coccyx/gogen/logger"
+)
+
+// watchInterval is how often we check config files for changes
+const watchInterval = 2 * time.Second
+
+// watchExtensions are the kinds of files configs are built from, other files in watched
+// directories are ignored
+var watchExtensions = map[string]bool{".yml": true, ".yaml": true, ".json": true, ".sample": true, ".csv": true, ".lua": true}
+
+// watchConfig asks for a reload whenever the files c was built from change, until ctx is cancelled
+func watchConfig(ctx context.Context, c *config.Config, reload chan<- struct{}) {
+	paths := c.WatchPaths()
+	log.Infof("Watching %s for config changes", strings.Join(paths, ", "))
+	last := configState(paths)
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		if state := configState(paths); state != last {
+			last = state
+			select {
+			case reload <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// configState describes the name, size and modification time of every config file under paths
+func configState(paths []string) string {
+	var b strings.Builder
+	for _, p := range paths {
+		filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() && watchExtensions[filepath.Ext(path)] {
+				fmt.Fprintf(&b, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+			}
+			return nil
+		})
+	}
+	return b.String()
+}
+
+// reload rebuilds the config and swaps in the new samples.  Samples whose configuration hasn't
+// changed keep running untouched, changed samples are restarted, new ones started and removed
+// ones stopped.  If the new config is invalid we carry on with the old one.
+func (ts *timerSet) reload() {
+	log.Infof("Reloading config")
+	nc, err := ts.c.Reload()
+	if err != nil {
+		log.Errorf("Rejecting new config, continuing with the old one: %s", err)
+		return
+	}
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	if ts.finished {
+		log.Infof("Generation has finished, ignoring new config")
+		return
+	}
+	old := make(map[string]*config.Sample, len(ts.c.Samples))
+	for _, s := range ts.c.Samples {
+		old[s.Name] = s
+	}
+	var added, changed, removed int
+	samples := make([]*config.Sample, 0, len(nc.Samples))
+	for _, s := range nc.Samples {
+		if prev, ok := old[s.Name]; ok {
+			delete(old, s.Name)
+			if prev.SameConfig(s) {
+				samples = append(samples, prev)
+				continue
+			}
+			log.Infof("Sample '%s' changed, restarting it", s.Name)
+			ts.stopLocked(s.Name)
+			changed++
+		} else {
+			log.Infof("Sample '%s' added", s.Name)
+			added++
+		}
+		samples = append(samples, s)
+		if !s.Disabled {
+			if err := ts.startLocked(s); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+	for name := range old {
+		log.Infof("Sample '%s' removed, stopping it", name)
+		ts.stopLocked(name)
+		removed++
+	}
+	ts.c.Samples = samples
+	ts.c.ReloadRaters(nc)
+	ts.c.Generators = nc.Generators
+	ts.c.Templates = nc.Templates
+	log.Infof("Config reloaded, %d samples added, %d changed and %d removed", added, changed, removed)
+}
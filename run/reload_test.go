@@ -0,0 +1,197 @@
+package run
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coccyx/gogen/generator"
+	config "github.com/coccyx/gogen/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReload(t *testing.T) {
+	os.Setenv("GOGEN_HOME", "..")
+	dir, err := ioutil.TempDir("", "gogen_reload")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yml")
+	write := func(config string) {
+		assert.NoError(t, ioutil.WriteFile(path, []byte(config), 0644))
+	}
+	write(`
+samples:
+  - name: keep
+    lines:
+      - _raw: keep event
+  - name: change
+    count: 1
+    lines:
+      - _raw: change event
+`)
+	c := config.BuildConfig(config.ConfigConfig{FullConfig: path})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gq := make(chan *config.GenQueueItem, 100)
+	go func() {
+		for range gq {
+		}
+	}()
+	ts := newTimerSet(ctx, c, gq, nil)
+	for _, s := range c.Samples {
+		assert.NoError(t, ts.start(s))
+	}
+	keep := ts.get("keep")
+	change := ts.get("change")
+
+	// Samples find their raters while running, as the config reloads
+	done := make(chan bool)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				c.FindRater("default")
+			}
+		}
+	}()
+	defer close(done)
+
+	write(`
+samples:
+  - name: keep
+    lines:
+      - _raw: keep event
+  - name: change
+    count: 2
+    lines:
+      - _raw: change event
+  - name: new
+    lines:
+      - _raw: new event
+`)
+	ts.reload()
+	assert.Equal(t, 3, len(ts.samples()))
+	assert.True(t, keep == ts.get("keep"))
+	assert.False(t, change == ts.get("change"))
+	assert.Equal(t, 2, ts.get("change").Settings().Count)
+	assert.NotNil(t, ts.get("new"))
+
+	// Invalid configs are ignored
+	write("samples: [")
+	ts.reload()
+	assert.Equal(t, 3, len(ts.samples()))
+	assert.NotNil(t, ts.get("new"))
+
+	write(`
+samples:
+  - name: keep
+    lines:
+      - _raw: keep event
+`)
+	ts.reload()
+	assert.Equal(t, 1, len(ts.samples()))
+	assert.True(t, keep == ts.get("keep"))
+	assert.Nil(t, ts.get("change"))
+	assert.Nil(t, ts.get("new"))
+}
+
+func TestReloadGenerators(t *testing.T) {
+	os.Setenv("GOGEN_HOME", "..")
+	dir, err := ioutil.TempDir("", "gogen_reload")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yml")
+	write := func(config string) {
+		assert.NoError(t, ioutil.WriteFile(path, []byte(config), 0644))
+	}
+	write(`
+generators:
+  - name: script
+    script: |
+      send({{_raw = "old script"}})
+samples:
+  - name: lua
+    generator: script
+    interval: 1
+    lines:
+      - _raw: unused
+  - name: switch
+    interval: 1
+    count: 1
+    lines:
+      - _raw: sample event
+`)
+	os.Setenv("GOGEN_FULLCONFIG", path)
+	defer os.Setenv("GOGEN_FULLCONFIG", "")
+	c := config.BuildConfig(config.ConfigConfig{FullConfig: path})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gq := make(chan *config.GenQueueItem, 100)
+	oq := make(chan *config.OutQueueItem, 100)
+	go generator.Start(ctx, gq, make(chan int, 1), c.Global.Seed)
+	ts := newTimerSet(ctx, c, gq, oq)
+	for _, s := range c.Samples {
+		assert.NoError(t, ts.start(s))
+	}
+	// waitFor reads generated events until each sample has generated the one expected
+	waitFor := func(expected map[string]string) {
+		timeout := time.After(5 * time.Second)
+		for len(expected) > 0 {
+			select {
+			case item := <-oq:
+				for _, e := range item.Events {
+					if expected[item.S.Name] == e["_raw"] {
+						delete(expected, item.S.Name)
+					}
+				}
+			case <-timeout:
+				assert.Fail(t, "events not generated", "%v", expected)
+				return
+			}
+		}
+	}
+	waitFor(map[string]string{"lua": "old script", "switch": "sample event"})
+
+	// The same generator worker picks up the changed script and generator
+	write(`
+generators:
+  - name: script
+    script: |
+      send({{_raw = "new script"}})
+  - name: switched
+    script: |
+      send({{_raw = "lua event"}})
+samples:
+  - name: lua
+    generator: script
+    interval: 1
+    lines:
+      - _raw: unused
+  - name: switch
+    generator: switched
+    interval: 1
+    count: 1
+    lines:
+      - _raw: sample event
+`)
+	ts.reload()
+	waitFor(map[string]string{"lua": "new script", "switch": "lua event"})
+}
+
+func TestConfigState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gogen_reload")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	state := configState([]string{dir})
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "gogen.log"), []byte("log line"), 0644))
+	assert.Equal(t, state, configState([]string{dir}))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "sample.yml"), []byte("name: foo"), 0644))
+	assert.NotEqual(t, state, configState([]string{dir}))
+}
@@ -1,15 +1,25 @@
 package run
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/coccyx/gogen/generator"
 	config "github.com/coccyx/gogen/internal"
 	log "github.com/coccyx/gogen/logger"
+	"github.com/coccyx/gogen/metrics"
 	"github.com/coccyx/gogen/outputter"
-	"github.com/coccyx/gogen/timer"
+	"github.com/coccyx/gogen/rater"
 )
 
+// closeTimeout is how long we wait for workers to finish after the drain timeout
+const closeTimeout = 5 * time.Second
+
 // ROT reads out data every ROTInterval seconds
 func ROT(c *config.Config, gq chan *config.GenQueueItem, oq chan *config.OutQueueItem) {
 	for {
@@ -19,40 +29,164 @@ func ROT(c *config.Config, gq chan *config.GenQueueItem, oq chan *config.OutQueu
 	}
 }
 
-// Run runs the mainline of the program
+// Run runs the mainline of the program until all timers are done or we receive SIGINT or SIGTERM.
+// SIGHUP reloads the config.
 func Run(c *config.Config) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	hups := make(chan os.Signal, 1)
+	signal.Notify(hups, syscall.SIGHUP)
+	defer signal.Stop(hups)
+	reload := make(chan struct{}, 1)
+	finished := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-hups:
+				select {
+				case reload <- struct{}{}:
+				default:
+				}
+			case <-finished:
+				return
+			}
+		}
+	}()
+	go func() {
+		select {
+		case sig := <-sigs:
+			fmt.Fprintf(os.Stderr, "Received %s, shutting down\n", sig)
+			cancel()
+			// A second signal skips draining
+			select {
+			case <-sigs:
+				fmt.Fprintf(os.Stderr, "Received second signal, exiting immediately\n")
+				os.Exit(1)
+			case <-finished:
+			}
+		case <-finished:
+		}
+	}()
+	runContext(ctx, c, reload)
+	close(finished)
+	if ctx.Err() != nil {
+		Summary(os.Stderr, c)
+	}
+}
+
+// RunContext runs the mainline of the program until all timers are done or ctx is cancelled.
+// After cancellation, queued work is drained and outputters closed, dropping whatever is left
+// once Global.DrainTimeout has passed.
+func RunContext(ctx context.Context, c *config.Config) {
+	runContext(ctx, c, nil)
+}
+
+// runContext is RunContext, reloading the config whenever we receive on reload
+func runContext(ctx context.Context, c *config.Config, reload chan struct{}) {
+	start := time.Now()
+	// Sequences are saved however we finish, so the next run continues them
+	defer config.SaveSequences()
+	// Manifests record which scenario phases were active in this run, however we finish
+	config.ResetScenarioManifests()
+	defer config.SaveScenarioManifests()
+	// Likewise burst raters schedule afresh for each run and record what they injected
+	rater.ResetBurstSchedules()
+	defer rater.SaveBurstSchedules()
+	drainTimeout, err := time.ParseDuration(c.Global.DrainTimeout)
+	if err != nil && c.Global.DrainTimeout != "" {
+		log.Errorf("Invalid drainTimeout '%s', draining without a timeout: %s", c.Global.DrainTimeout, err)
+	}
+	// Workers drop remaining work once drainCtx is cancelled
+	drainCtx, drainCancel := context.WithCancel(context.Background())
+	defer drainCancel()
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-finished:
+			return
+		}
+		if drainTimeout <= 0 {
+			return
+		}
+		t := time.NewTimer(drainTimeout)
+		defer t.Stop()
+		select {
+		case <-t.C:
+			log.Errorf("Drain timeout of %s reached, dropping remaining events", drainTimeout)
+			drainCancel()
+		case <-finished:
+		}
+	}()
+
 	log.Info("Starting ReadOutThread")
 	go outputter.ROT(c)
 	log.Info("Starting Timers")
-	timerdone := make(chan int)
 	gq := make(chan *config.GenQueueItem, config.MaxGenQueueLength)
 	gqs := make(chan int)
 	oq := make(chan *config.OutQueueItem, config.MaxOutQueueLength)
 	oqs := make(chan int)
+	metrics.NewGaugeFunc("gogen_gen_queue_depth", "Items waiting in the generator queue", func() float64 { return float64(len(gq)) })
+	metrics.NewGaugeFunc("gogen_out_queue_depth", "Items waiting in the output queue", func() float64 { return float64(len(oq)) })
+	if c.Global.MetricsAddr != "" {
+		metrics.Serve(c.Global.MetricsAddr)
+	}
 	gens := 0
 	outs := 0
-	timers := 0
+	ts := newTimerSet(ctx, c, gq, oq)
 	for i := 0; i < len(c.Samples); i++ {
 		s := c.Samples[i]
 		if !s.Disabled {
-			t := timer.Timer{S: s, GQ: gq, OQ: oq, Done: timerdone}
-			go t.NewTimer()
-			timers++
+			if err := ts.start(s); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+	log.Infof("%d Timers started", ts.running)
+	if c.Global.APIAddr != "" {
+		srv, err := serveAPI(c.Global.APIAddr, ts)
+		if err != nil {
+			log.Errorf("Error starting API on '%s': %s", c.Global.APIAddr, err)
+		} else {
+			defer srv.Close()
 		}
 	}
-	log.Infof("%d Timers started", timers)
+	if c.Global.WatchConfig {
+		if reload == nil {
+			reload = make(chan struct{}, 1)
+		}
+		go watchConfig(ctx, c, reload)
+	}
+	if reload != nil {
+		go func() {
+			for {
+				select {
+				case <-reload:
+					ts.reload()
+				case <-ctx.Done():
+					return
+				case <-finished:
+					return
+				}
+			}
+		}()
+	}
 
 	log.Infof("Starting Generators")
 	for i := 0; i < c.Global.GeneratorWorkers; i++ {
 		log.Infof("Starting Generator %d", i)
-		go generator.Start(gq, gqs)
+		go generator.Start(drainCtx, gq, gqs, c.Global.Seed)
 		gens++
 	}
 
 	log.Infof("Starting Outputters")
 	for i := 0; i < c.Global.OutputWorkers; i++ {
 		log.Infof("Starting Outputter %d", i)
-		go outputter.Start(oq, oqs, i)
+		go outputter.Start(drainCtx, oq, oqs, i, c.Global.Seed)
 		outs++
 	}
 
@@ -64,10 +198,8 @@ func Run(c *config.Config) {
 Loop1:
 	for {
 		select {
-		case <-timerdone:
-			timers--
-			log.Debugf("Timer done, timers left %d", timers)
-			if timers == 0 {
+		case <-ts.done:
+			if ts.timerDone() {
 				break Loop1
 			}
 		}
@@ -78,6 +210,7 @@ Loop1:
 	close(gq)
 
 	// Check for all the workers to signal back they're done
+	abandon := abandonAfter(drainCtx)
 Loop2:
 	for {
 		select {
@@ -87,6 +220,9 @@ Loop2:
 			if gens == 0 {
 				break Loop2
 			}
+		case <-abandon:
+			log.Errorf("%d generators did not finish after drain timeout, abandoning them", gens)
+			return
 		}
 	}
 
@@ -101,15 +237,42 @@ Loop3:
 			if outs == 0 {
 				break Loop3
 			}
+		case <-abandon:
+			log.Errorf("%d outputters did not close after drain timeout, abandoning them", outs)
+			return
 		}
 	}
+	log.Infof("Finished in %s", time.Since(start))
+}
 
-	// for _, s := range c.Samples {
-	// 	err := s.Out.Close()
-	// 	if err != nil {
-	// 		log.Errorf("Error closing output for sample '%s': %s", s.Name, err)
-	// 	}
-	// }
+// abandonAfter returns a channel which fires closeTimeout after drainCtx is cancelled, giving
+// workers a last chance to close their outputters before we stop waiting for them
+func abandonAfter(drainCtx context.Context) <-chan time.Time {
+	c := make(chan time.Time, 1)
+	go func() {
+		<-drainCtx.Done()
+		time.Sleep(closeTimeout)
+		c <- time.Now()
+	}()
+	return c
+}
 
-	// time.Sleep(100 * time.Millisecond)
+// Summary writes events and bytes written and output errors per sample and in total
+func Summary(w io.Writer, c *config.Config) {
+	var events, bytes, errors float64
+	fmt.Fprintf(w, "%-30s %15s %15s %10s\n", "Sample", "Events", "Bytes", "Errors")
+	for _, s := range c.Samples {
+		e := metrics.EventsWritten.Value(s.Name)
+		b := metrics.BytesWritten.Value(s.Name)
+		errs := metrics.OutputErrors.Value(s.Name)
+		// Samples can be disabled while running, so only skip those which never wrote anything
+		if s.Disabled && e == 0 && errs == 0 {
+			continue
+		}
+		events += e
+		bytes += b
+		errors += errs
+		fmt.Fprintf(w, "%-30s %15.0f %15.0f %10.0f\n", s.Name, e, b, errs)
+	}
+	fmt.Fprintf(w, "%-30s %15.0f %15.0f %10.0f\n", "Total", events, bytes, errors)
 }
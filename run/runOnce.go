@@ -1,7 +1,7 @@
 package run
 
 import (
-	"math/rand"
+	"context"
 	"time"
 
 	"github.com/coccyx/gogen/generator"
@@ -19,16 +19,17 @@ func (r Runner) Once(name string) {
 	go outputter.ROT(c)
 	s := c.FindSampleByName(name)
 
-	source := rand.NewSource(time.Now().UnixNano())
-	randgen := rand.New(source)
+	randgen := config.NewRand(c.Global.Seed, s.Name)
 	// Generate one event for our named sample
 	if s.Description == "" {
 		log.Fatalf("Description not set for sample '%s'", s.Name)
 	}
 
 	log.Debugf("Generating for Push() sample '%s'", s.Name)
+	origOutputs := s.Outputs
 	origOutputter := s.Output.Outputter
 	origOutputTemplate := s.Output.OutputTemplate
+	s.Outputs = []*config.Output{s.Output}
 	s.Output.Outputter = "buf"
 	s.Output.OutputTemplate = "json"
 	gq := make(chan *config.GenQueueItem)
@@ -36,8 +37,8 @@ func (r Runner) Once(name string) {
 	oq := make(chan *config.OutQueueItem)
 	oqs := make(chan int)
 
-	go generator.Start(gq, gqs)
-	go outputter.Start(oq, oqs, 1)
+	go generator.Start(context.Background(), gq, gqs, c.Global.Seed)
+	go outputter.Start(context.Background(), oq, oqs, 1, c.Global.Seed)
 
 	gqi := &config.GenQueueItem{Count: 1, Earliest: time.Now(), Latest: time.Now(), S: s, OQ: oq, Rand: randgen, Event: -1}
 	gq <- gqi
@@ -68,6 +69,7 @@ Loop2:
 		}
 	}
 
+	s.Outputs = origOutputs
 	s.Output.Outputter = origOutputter
 	s.Output.OutputTemplate = origOutputTemplate
 
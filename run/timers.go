@@ -0,0 +1,201 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	config "github.com/coccyx/gogen/internal"
+	log "github.com/coccyx/gogen/logger"
+	"github.com/coccyx/gogen/timer"
+)
+
+// timerSet keeps track of the running timers so they can be controlled while we're generating,
+// and so we know when they've all finished
+type timerSet struct {
+	ctx  context.Context
+	c    *config.Config
+	gq   chan *config.GenQueueItem
+	oq   chan *config.OutQueueItem
+	done chan int
+	// untargeted is how many samples share the global target rate
+	untargeted int
+
+	mutex   sync.Mutex
+	timers  map[string]*timer.Timer
+	cancels map[string]context.CancelFunc
+	// disabled is the timers stopped by disabling their sample through the API, kept so they can
+	// be enabled again.  Generation doesn't finish while any are waiting to be enabled.
+	disabled map[string]*timer.Timer
+	running  int
+	finished bool
+	paused   bool
+}
+
+func newTimerSet(ctx context.Context, c *config.Config, gq chan *config.GenQueueItem, oq chan *config.OutQueueItem) *timerSet {
+	ts := &timerSet{ctx: ctx, c: c, gq: gq, oq: oq, done: make(chan int), timers: make(map[string]*timer.Timer), cancels: make(map[string]context.CancelFunc), disabled: make(map[string]*timer.Timer)}
+	// Global targets are shared evenly by the samples which don't set their own
+	for _, s := range c.Samples {
+		if !s.Disabled && s.TargetEPS == 0 && s.TargetGBPerDay == 0 {
+			ts.untargeted++
+		}
+	}
+	return ts
+}
+
+// start starts a timer for s
+func (ts *timerSet) start(s *config.Sample) error {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	return ts.startLocked(s)
+}
+
+// startLocked starts a timer for s, must be called holding mutex
+func (ts *timerSet) startLocked(s *config.Sample) error {
+	if ts.finished {
+		return fmt.Errorf("Cannot start sample '%s', generation has finished", s.Name)
+	}
+	if _, ok := ts.timers[s.Name]; ok {
+		return fmt.Errorf("Sample '%s' is already running", s.Name)
+	}
+	ctx, cancel := context.WithCancel(ts.ctx)
+	t := &timer.Timer{S: s, GQ: ts.gq, OQ: ts.oq, Done: ts.done, Seed: ts.c.Global.Seed, Ctx: ctx, TargetEPS: s.TargetEPS, TargetGBPerDay: s.TargetGBPerDay}
+	if s.TargetEPS == 0 && s.TargetGBPerDay == 0 && ts.untargeted > 0 {
+		t.TargetEPS = ts.c.Global.TargetEPS / float64(ts.untargeted)
+		t.TargetGBPerDay = ts.c.Global.TargetGBPerDay / float64(ts.untargeted)
+	}
+	if t.TargetEPS > 0 && t.TargetGBPerDay > 0 {
+		log.Errorf("Both targetEPS and targetGBPerDay set for sample '%s', using targetEPS", s.Name)
+	}
+	if t.TargetEPS > 0 || t.TargetGBPerDay > 0 {
+		log.Infof("Generating sample '%s' at target %.2f events/sec, %.2f GB/day", s.Name, t.TargetEPS, t.TargetGBPerDay)
+	}
+	if ts.paused {
+		t.Pause()
+	}
+	ts.timers[s.Name] = t
+	ts.cancels[s.Name] = cancel
+	ts.running++
+	go t.NewTimer()
+	return nil
+}
+
+// timerDone records a timer finishing, returning true once they all have.  No more timers can be
+// started after that as the generator queue will be closed.
+func (ts *timerSet) timerDone() bool {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	ts.running--
+	log.Debugf("Timer done, timers left %d", ts.running)
+	if ts.running <= 0 && len(ts.disabled) == 0 {
+		ts.finished = true
+	}
+	return ts.finished
+}
+
+// stopLocked stops the named sample's timer, must be called holding mutex.  The timer still
+// counts as running until it reports it's done.
+func (ts *timerSet) stopLocked(name string) {
+	delete(ts.disabled, name)
+	if cancel, ok := ts.cancels[name]; ok {
+		cancel()
+		delete(ts.cancels, name)
+		delete(ts.timers, name)
+	}
+}
+
+// enable starts the timer for s if it isn't running, restarting it if it was disabled
+func (ts *timerSet) enable(s *config.Sample) error {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	if _, ok := ts.timers[s.Name]; ok {
+		return nil
+	}
+	log.Infof("Enabling sample '%s'", s.Name)
+	t, ok := ts.disabled[s.Name]
+	if ok {
+		delete(ts.disabled, s.Name)
+		t.SetDisabled(false)
+	} else {
+		s.Disabled = false
+	}
+	err := ts.startLocked(s)
+	if err != nil {
+		if ok {
+			ts.disabled[s.Name] = t
+			t.SetDisabled(true)
+		} else {
+			s.Disabled = true
+		}
+	}
+	return err
+}
+
+// disable stops the timer for s if it's running
+func (ts *timerSet) disable(s *config.Sample) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	t, ok := ts.timers[s.Name]
+	if !ok {
+		return
+	}
+	log.Infof("Disabling sample '%s'", s.Name)
+	t.SetDisabled(true)
+	ts.stopLocked(s.Name)
+	ts.disabled[s.Name] = t
+}
+
+// settings returns the current settings for s, and whether its timer is running
+func (ts *timerSet) settings(s *config.Sample) (timer.Settings, bool) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	if t, ok := ts.timers[s.Name]; ok {
+		return t.Settings(), true
+	}
+	if t, ok := ts.disabled[s.Name]; ok {
+		return t.Settings(), false
+	}
+	return timer.Settings{Count: s.Count, Interval: s.Interval, Rater: s.RaterString, Disabled: s.Disabled}, false
+}
+
+// samples returns the samples in the current config
+func (ts *timerSet) samples() []*config.Sample {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	return append([]*config.Sample(nil), ts.c.Samples...)
+}
+
+// find returns the named sample from the current config, or nil if it doesn't exist
+func (ts *timerSet) find(name string) *config.Sample {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	return ts.c.FindSampleByName(name)
+}
+
+// hasRater returns true if the current config has the named rater
+func (ts *timerSet) hasRater(name string) bool {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	return ts.c.FindRater(name) != nil
+}
+
+// get returns the timer for the named sample, or nil if it hasn't been started
+func (ts *timerSet) get(name string) *timer.Timer {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	return ts.timers[name]
+}
+
+// setPaused pauses or resumes all timers, including those started later
+func (ts *timerSet) setPaused(paused bool) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	ts.paused = paused
+	for _, t := range ts.timers {
+		if paused {
+			t.Pause()
+		} else {
+			t.Resume()
+		}
+	}
+}
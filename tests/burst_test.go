@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/coccyx/gogen/run"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBurstBackfill(t *testing.T) {
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "rater", "burstrater.yml"))
+	schedule := "/tmp/gogen_burst_schedule.json"
+	os.Remove(schedule)
+	defer os.Remove(schedule)
+	c := config.NewConfig()
+	run.Run(c)
+
+	counts := make(map[string]int)
+	for _, line := range strings.Split(strings.TrimSpace(c.Buf.String()), "\n") {
+		counts[strings.TrimSuffix(line, " request")]++
+	}
+
+	f, err := os.Open(schedule)
+	assert.NoError(t, err)
+	defer f.Close()
+	type event struct {
+		Rater     string
+		Type      string
+		Start     time.Time
+		End       time.Time
+		Magnitude float64
+	}
+	var events []event
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var e event
+		if !assert.NoError(t, dec.Decode(&e)) {
+			break
+		}
+		assert.Equal(t, "spiky", e.Rater)
+		events = append(events, e)
+	}
+	assert.NotEmpty(t, events)
+
+	// Every minute of the 12 hours has 10 events, apart from bursts and outages in the schedule
+	start := time.Date(2001, 10, 20, 0, 0, 0, 0, time.Local)
+	quiet, spiked, down := 0, 0, 0
+	for i := 0; i < 12*60; i++ {
+		now := start.Add(time.Duration(i) * time.Minute)
+		rate := 1.0
+		for _, e := range events {
+			if !now.Before(e.Start) && now.Before(e.End) {
+				if e.Type == "outage" {
+					rate = 0
+					break
+				}
+				if e.Magnitude > rate {
+					rate = e.Magnitude
+				}
+			}
+		}
+		assert.Equal(t, int(rate*10+0.5), counts[now.Format("2006-01-02T15:04")], now.String())
+		switch {
+		case rate == 0:
+			down++
+		case rate > 1:
+			spiked++
+		default:
+			quiet++
+		}
+	}
+	assert.True(t, spiked > 0 && down > 0 && quiet > 0, "spiked %d down %d quiet %d", spiked, down, quiet)
+}
@@ -0,0 +1,36 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/coccyx/gogen/run"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalendarBackfill(t *testing.T) {
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "rater", "calendarrater.yml"))
+	c := config.NewConfig()
+	run.Run(c)
+
+	// A year of days at 10 events a day, shaped by the calendar
+	counts := make(map[string]int)
+	for _, line := range strings.Split(strings.TrimSpace(c.Buf.String()), "\n") {
+		counts[strings.TrimSuffix(line, " sale")]++
+	}
+	assert.Equal(t, 365, len(counts))
+	assert.Equal(t, 10, counts["2023-03-15"])
+	assert.Equal(t, 5, counts["2023-03-18"])
+	assert.Equal(t, 15, counts["2023-03-31"])
+	assert.Equal(t, 30, counts["2023-11-30"])
+	assert.Equal(t, 10, counts["2023-11-23"])
+	assert.Equal(t, 100, counts["2023-11-24"])
+	assert.Equal(t, 4, counts["2023-12-25"])
+	assert.Equal(t, 15, counts["2023-12-31"])
+}
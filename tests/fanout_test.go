@@ -0,0 +1,41 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/coccyx/gogen/metrics"
+	"github.com/coccyx/gogen/run"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFanout(t *testing.T) {
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "fanout", "fanout.yml"))
+	c := config.NewConfig()
+	s := c.FindSampleByName("fanout")
+	assert.Equal(t, 3, len(s.Outputs))
+	assert.Equal(t, s.Outputs[0], s.Output)
+	archive := s.Outputs[1]
+	os.Remove(archive.FileName)
+	defer os.Remove(archive.FileName)
+	run.Run(c)
+
+	// Every output gets the whole batch in its own format, and one failing doesn't affect the others
+	assert.Equal(t, 100, strings.Count(c.Buf.String(), "fanout event\n"))
+	b, err := ioutil.ReadFile(archive.FileName)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, strings.Count(string(b), `"_raw":"fanout event"`))
+	assert.Equal(t, float64(100), metrics.DestinationEventsWritten.Value("primary"))
+	assert.Equal(t, float64(100), metrics.DestinationEventsWritten.Value("archive"))
+	assert.True(t, metrics.DestinationErrors.Value("unreachable") > 0)
+	assert.Equal(t, float64(0), metrics.DestinationErrors.Value("archive"))
+	// The sample's own stats only count its first output
+	assert.Equal(t, float64(100), metrics.EventsWritten.Value("fanout"))
+}
@@ -0,0 +1,9 @@
+local json = require("gogen.json")
+
+local M = {}
+
+function M.event(msg)
+  return { _raw = json.encode({ msg = msg }) }
+end
+
+return M
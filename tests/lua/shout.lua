@@ -0,0 +1,3 @@
+return function(s)
+  return string.upper(s)
+end
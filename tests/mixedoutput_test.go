@@ -0,0 +1,34 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/coccyx/gogen/run"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMixedOutput(t *testing.T) {
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "mixedoutput", "mixedoutput.yml"))
+	c := config.NewConfig()
+	audit := c.FindSampleByName("audit")
+	os.Remove(audit.Output.FileName)
+	defer os.Remove(audit.Output.FileName)
+	assert.Equal(t, "raw", audit.Output.OutputTemplate)
+	run.Run(c)
+
+	// Each sample's events should only go to its own output, whichever worker sent them
+	assert.Equal(t, 200, strings.Count(c.Buf.String(), "web event\n"))
+	assert.NotContains(t, c.Buf.String(), "audit event")
+	b, err := ioutil.ReadFile(audit.Output.FileName)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, strings.Count(string(b), "audit event\n"))
+	assert.NotContains(t, string(b), "web event")
+}
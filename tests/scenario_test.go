@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/coccyx/gogen/run"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScenario(t *testing.T) {
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "scenario", "scenario.yml"))
+	manifest := "/tmp/gogen_scenario_manifest.json"
+	os.Remove(manifest)
+	defer os.Remove(manifest)
+	c := config.NewConfig()
+	run.Run(c)
+
+	// 30 intervals backfilled: 10 normal, 5 of errors at double rate, 10 failed over, then 5 normal
+	counts := make(map[string]int)
+	for _, line := range strings.Split(strings.TrimSpace(c.Buf.String()), "\n") {
+		counts[line]++
+	}
+	assert.Equal(t, 150, counts["web status=200"])
+	assert.Equal(t, 100, counts["web status=500"])
+	assert.Equal(t, 100, counts["failover status=200"])
+
+	b, err := ioutil.ReadFile(manifest)
+	assert.NoError(t, err)
+	var m struct {
+		Scenario string
+		Start    time.Time
+		Phases   []struct {
+			Name      string
+			Start     time.Time
+			End       time.Time
+			Active    bool
+			FirstSeen time.Time
+			LastSeen  time.Time
+		}
+	}
+	assert.NoError(t, json.Unmarshal(b, &m))
+	assert.Equal(t, "outage", m.Scenario)
+	assert.Equal(t, 2, len(m.Phases))
+	errors, failover := m.Phases[0], m.Phases[1]
+	assert.Equal(t, "errors", errors.Name)
+	assert.True(t, errors.Active)
+	assert.Equal(t, m.Start.Add(10*time.Minute), errors.Start)
+	assert.Equal(t, m.Start.Add(15*time.Minute), errors.End)
+	assert.Equal(t, errors.Start, errors.FirstSeen)
+	assert.Equal(t, errors.Start.Add(4*time.Minute), errors.LastSeen)
+	// Each sample parses its own begin, so the failover sample's intervals can be a little later
+	assert.True(t, failover.Active)
+	assert.True(t, !failover.FirstSeen.Before(failover.Start) && failover.FirstSeen.Before(failover.Start.Add(time.Second)))
+	last := failover.Start.Add(9 * time.Minute)
+	assert.True(t, !failover.LastSeen.Before(last) && failover.LastSeen.Before(last.Add(time.Second)))
+}
@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/coccyx/gogen/run"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeed(t *testing.T) {
+	for _, name := range []string{"seedtokens", "seedlua"} {
+		// With one generator and one outputter, the same seed gives byte for byte the same output
+		first := runSeed(42, 1, name)
+		assert.Len(t, strings.Split(strings.TrimSpace(first), "\n"), 100, name)
+		assert.Equal(t, first, runSeed(42, 1, name), name)
+		assert.NotEqual(t, first, runSeed(43, 1, name), name)
+
+		// More generator workers race to output, but generate the same events
+		assert.Equal(t, sortedLines(first), sortedLines(runSeed(42, 4, name)), name)
+	}
+}
+
+// runSeed runs only the named sample from the seed config and returns its output
+func runSeed(seed int64, workers int, name string) string {
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "seed", "seed.yml"))
+	c := config.NewConfig()
+	c.Global.Seed = seed
+	c.Global.GeneratorWorkers = workers
+	c.Global.OutputWorkers = 1
+	for _, s := range c.Samples {
+		s.Disabled = s.Name != name
+	}
+	run.Run(c)
+	return c.Buf.String()
+}
+
+func sortedLines(output string) []string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	sort.Strings(lines)
+	return lines
+}
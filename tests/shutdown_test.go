@@ -0,0 +1,38 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/coccyx/gogen/run"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdown(t *testing.T) {
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "shutdown", "shutdown.yml"))
+	c := config.NewConfig()
+
+	// The sample backfills and then runs in realtime forever, so only cancelling stops it
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	run.RunContext(ctx, c)
+	assert.True(t, time.Since(start) < 3*time.Second)
+
+	events := strings.Count(c.Buf.String(), "shutdown event\n")
+	assert.True(t, events >= 6, "expected at least 6 events, got %d", events)
+
+	var summary bytes.Buffer
+	run.Summary(&summary, c)
+	assert.Contains(t, summary.String(), "shutdown")
+	assert.Contains(t, summary.String(), "Total")
+}
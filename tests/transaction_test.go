@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/coccyx/gogen/run"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransaction(t *testing.T) {
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "transaction", "transaction.yml"))
+	c := config.NewConfig()
+	db := c.FindSampleByName("db")
+	assert.True(t, db.Disabled)
+	os.Remove(db.Output.FileName)
+	defer os.Remove(db.Output.FileName)
+	run.Run(c)
+
+	// Every transaction has one event in each sample, in order, with the configured latencies
+	times := make(map[string]map[string]time.Time)
+	record := func(out string) {
+		for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+			parts := strings.Fields(line)
+			assert.Equal(t, 3, len(parts), line)
+			ts, err := time.Parse("2006-01-02T15:04:05.000000Z07:00", parts[0])
+			assert.NoError(t, err)
+			id := strings.TrimPrefix(parts[2], "txn=")
+			if times[id] == nil {
+				times[id] = make(map[string]time.Time)
+			}
+			times[id][parts[1]] = ts
+		}
+	}
+	record(c.Buf.String())
+	b, err := ioutil.ReadFile(db.Output.FileName)
+	assert.NoError(t, err)
+	assert.NotContains(t, c.Buf.String(), " db ")
+	record(string(b))
+
+	assert.Equal(t, 10, len(times))
+	for id, steps := range times {
+		assert.Equal(t, 3, len(steps), id)
+		lbToApp := steps["app"].Sub(steps["lb"])
+		appToDB := steps["db"].Sub(steps["app"])
+		// Timestamps are truncated to microseconds
+		assert.True(t, lbToApp > 10*time.Millisecond-time.Microsecond && lbToApp < 50*time.Millisecond+time.Microsecond, "%s lb to app %s", id, lbToApp)
+		assert.True(t, appToDB > time.Millisecond-time.Microsecond && appToDB < 5*time.Millisecond+time.Microsecond, "%s app to db %s", id, appToDB)
+	}
+}
+
+func TestTransactionGeneratorStep(t *testing.T) {
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := ".."
+	os.Setenv("GOGEN_FULLCONFIG", filepath.Join(home, "tests", "transaction", "luastep.yml"))
+	defer os.Setenv("GOGEN_FULLCONFIG", "")
+	c := config.NewConfig()
+	// A step using a Lua generator could send any number of events, so the transaction is disabled
+	assert.Nil(t, c.FindSampleByName("checkout"))
+	assert.NotNil(t, c.FindSampleByName("lb"))
+}
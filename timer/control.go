@@ -0,0 +1,116 @@
+package timer
+
+import (
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+)
+
+// Settings is a snapshot of the parts of a sample which can be changed while its Timer is running
+type Settings struct {
+	Count    int
+	Interval int
+	Rater    string
+	Disabled bool
+	Paused   bool
+}
+
+// Settings returns the sample's current settings
+func (t *Timer) Settings() Settings {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return Settings{Count: t.S.Count, Interval: t.S.Interval, Rater: t.S.RaterString, Disabled: t.S.Disabled, Paused: t.paused}
+}
+
+// Pause stops the timer queueing work until Resume is called
+func (t *Timer) Pause() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.paused = true
+}
+
+// Resume starts a paused timer queueing work again
+func (t *Timer) Resume() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.paused = false
+	t.wake()
+}
+
+// SetDisabled disables or enables the sample.  A disabled sample's timer queues no work until it's enabled.
+func (t *Timer) SetDisabled(disabled bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.S.Disabled = disabled
+	t.wake()
+}
+
+// SetCount changes the number of events generated each interval
+func (t *Timer) SetCount(count int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.S.Count = count
+}
+
+// SetInterval changes the number of seconds between intervals
+func (t *Timer) SetInterval(interval int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.S.Interval = interval
+	if t.rc != nil {
+		t.rc.interval = float64(interval)
+	}
+}
+
+// SetRater changes the sample's rater to r, which was configured as name
+func (t *Timer) SetRater(name string, r config.Rater) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.S.RaterString = name
+	t.S.Rater = r
+}
+
+// Burst immediately queues count events in addition to the sample's regular intervals
+func (t *Timer) Burst(count int) {
+	t.mutex.Lock()
+	item := t.newItem(t.S.Now(), count)
+	t.mutex.Unlock()
+	t.queue(item)
+}
+
+// wait blocks while the timer is paused or the sample disabled, returning false if the timer was
+// cancelled first
+func (t *Timer) wait() bool {
+	for {
+		t.mutex.Lock()
+		if !t.paused && !t.S.Disabled {
+			t.mutex.Unlock()
+			return t.Ctx.Err() == nil
+		}
+		if t.resume == nil {
+			t.resume = make(chan struct{})
+		}
+		resume := t.resume
+		t.mutex.Unlock()
+		select {
+		case <-resume:
+		case <-t.Ctx.Done():
+			return false
+		}
+	}
+}
+
+// wake releases anything blocked in wait, must be called holding mutex
+func (t *Timer) wake() {
+	if t.resume != nil {
+		close(t.resume)
+		t.resume = nil
+	}
+}
+
+// interval returns the sample's interval as a duration
+func (t *Timer) interval() time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return time.Duration(t.S.Interval) * time.Second
+}
@@ -0,0 +1,65 @@
+package timer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func waitResult(timer *Timer) chan bool {
+	ret := make(chan bool, 1)
+	go func() {
+		ret <- timer.wait()
+	}()
+	return ret
+}
+
+func TestPause(t *testing.T) {
+	s := &config.Sample{Name: "pause", Interval: 1, Realtime: true}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	timer := &Timer{S: s, Ctx: ctx}
+	assert.True(t, <-waitResult(timer))
+
+	timer.Pause()
+	assert.True(t, timer.Settings().Paused)
+	waiting := waitResult(timer)
+	select {
+	case <-waiting:
+		assert.Fail(t, "wait returned while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	timer.Resume()
+	assert.True(t, <-waiting)
+
+	// Disabling blocks the same way, and cancelling gets us out
+	timer.SetDisabled(true)
+	assert.True(t, s.Disabled)
+	waiting = waitResult(timer)
+	select {
+	case <-waiting:
+		assert.Fail(t, "wait returned while disabled")
+	case <-time.After(50 * time.Millisecond):
+	}
+	cancel()
+	assert.False(t, <-waiting)
+}
+
+func TestSettings(t *testing.T) {
+	s := &config.Sample{Name: "settings", Interval: 1, Count: 10, Realtime: true}
+	gq := make(chan *config.GenQueueItem, 1)
+	timer := &Timer{S: s, GQ: gq, Ctx: context.Background()}
+	timer.SetCount(20)
+	timer.SetInterval(5)
+	timer.SetRater("double", nil)
+	assert.Equal(t, Settings{Count: 20, Interval: 5, Rater: "double"}, timer.Settings())
+	assert.Equal(t, 5*time.Second, timer.interval())
+
+	timer.Burst(100)
+	item := <-gq
+	assert.Equal(t, 100, item.Count)
+	assert.Equal(t, s, item.S)
+}
@@ -0,0 +1,128 @@
+package timer
+
+import (
+	"math"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/coccyx/gogen/metrics"
+)
+
+const (
+	// targetSpreadPerSecond is how many batches per second a target rate sample is split into in realtime
+	targetSpreadPerSecond = 10
+	// targetMaxBoost limits how far above the nominal count an interval can go to catch up
+	targetMaxBoost = 10
+	// targetDefaultEventSize is the assumed event size in bytes before we've seen any output
+	targetDefaultEventSize = 100
+	// targetSizeSmoothing is the weight of each new observation of average event size
+	targetSizeSmoothing = 0.3
+)
+
+// rateController decides each interval's count for a sample generating to a target events per
+// second or GB per day.  For GB per day it learns the average event size from the bytes and events
+// written for the sample and corrects for any shortfall or overshoot of the total so far, counting
+// events still in the queues as written at the average size.
+type rateController struct {
+	name        string
+	eps         float64
+	bytesPerSec float64
+	interval    float64
+	intervals   int64
+	queued      int64
+	eventSize   float64
+
+	baseEvents float64
+	baseBytes  float64
+	lastEvents float64
+	lastBytes  float64
+}
+
+func newRateController(s *config.Sample, eps float64, gbPerDay float64) *rateController {
+	rc := &rateController{name: s.Name, interval: float64(s.Interval), eventSize: targetDefaultEventSize}
+	if rc.interval <= 0 {
+		rc.interval = 1
+	}
+	if eps > 0 {
+		rc.eps = eps
+	} else {
+		rc.bytesPerSec = gbPerDay * 1024 * 1024 * 1024 / 86400
+	}
+	// Start from the average size of the sample's lines, tokens will move it around a bit
+	var total int
+	for _, l := range s.Lines {
+		total += len(l["_raw"]) + 1
+	}
+	if total > len(s.Lines) {
+		rc.eventSize = float64(total) / float64(len(s.Lines))
+	}
+	// Metrics are cumulative for the process, so only count what's written from here on
+	rc.baseEvents = metrics.EventsWritten.Value(s.Name)
+	rc.baseBytes = metrics.BytesWritten.Value(s.Name)
+	rc.lastEvents, rc.lastBytes = rc.baseEvents, rc.baseBytes
+	return rc
+}
+
+// next returns the count for the next interval
+func (rc *rateController) next() int {
+	rc.intervals++
+	var count int64
+	if rc.eps > 0 {
+		// Carry fractions of events over to later intervals
+		count = int64(rc.eps*rc.interval*float64(rc.intervals)) - rc.queued
+	} else {
+		events := metrics.EventsWritten.Value(rc.name)
+		bytes := metrics.BytesWritten.Value(rc.name)
+		if events > rc.lastEvents {
+			size := (bytes - rc.lastBytes) / (events - rc.lastEvents)
+			rc.eventSize += targetSizeSmoothing * (size - rc.eventSize)
+		}
+		rc.lastEvents, rc.lastBytes = events, bytes
+
+		written := bytes - rc.baseBytes
+		inflight := float64(rc.queued) - (events - rc.baseEvents)
+		if inflight < 0 {
+			inflight = 0
+		}
+		desired := rc.bytesPerSec * rc.interval * float64(rc.intervals)
+		count = int64(math.Floor((desired-written-inflight*rc.eventSize)/rc.eventSize + 0.5))
+		max := int64(math.Ceil(rc.bytesPerSec * rc.interval / rc.eventSize * targetMaxBoost))
+		if count > max {
+			count = max
+		}
+	}
+	if count < 0 {
+		count = 0
+	}
+	rc.queued += count
+	return int(count)
+}
+
+// spread queues count events evenly over the sample's interval rather than in one batch, returning
+// once the interval has passed
+func (t *Timer) spread(count int) {
+	s := t.S
+	t.mutex.Lock()
+	secs := s.Interval
+	t.mutex.Unlock()
+	if secs < 1 {
+		secs = 1
+	}
+	interval := time.Duration(secs) * time.Second
+	start := time.Now()
+	pieces := secs * targetSpreadPerSecond
+	if pieces > count {
+		pieces = count
+	}
+	for i := 0; i < pieces; i++ {
+		c := count*(i+1)/pieces - count*i/pieces
+		t.mutex.Lock()
+		item := t.newItem(s.Now(), c)
+		t.mutex.Unlock()
+		t.queue(item)
+		if !t.sleep(time.Until(start.Add(interval * time.Duration(i+1) / time.Duration(pieces)))) {
+			return
+		}
+	}
+	t.sleep(time.Until(start.Add(interval)))
+}
@@ -0,0 +1,70 @@
+package timer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	config "github.com/coccyx/gogen/internal"
+	"github.com/coccyx/gogen/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateControllerEPS(t *testing.T) {
+	s := &config.Sample{Name: "targeteps", Interval: 1}
+	rc := newRateController(s, 2.5, 0)
+	counts := []int{rc.next(), rc.next(), rc.next(), rc.next()}
+	assert.Equal(t, []int{2, 3, 2, 3}, counts)
+}
+
+func TestRateControllerGBPerDay(t *testing.T) {
+	// 1 GB/day at 10 second intervals is ~124k bytes per interval
+	s := &config.Sample{Name: "targetgb", Interval: 10, Lines: []map[string]string{{"_raw": "1234567890"}}}
+	rc := newRateController(s, 0, 1)
+	perInterval := 1024.0 * 1024 * 1024 / 86400 * 10
+
+	// Events turn out to be 100 bytes rather than the 11 the sample suggests, the controller
+	// should overshoot at first and then settle down to the target
+	var written float64
+	for i := 0; i < 50; i++ {
+		count := rc.next()
+		metrics.EventsWritten.Add(s.Name, float64(count))
+		metrics.BytesWritten.Add(s.Name, float64(count)*100)
+		written += float64(count) * 100
+	}
+	assert.InDelta(t, 100, rc.eventSize, 1)
+	assert.InDelta(t, perInterval*50, written, perInterval*0.1+11*1000)
+
+	// Once settled each interval is about the target
+	count := rc.next()
+	assert.InDelta(t, perInterval/100, float64(count), perInterval/100*0.2)
+}
+
+func TestRateControllerInflight(t *testing.T) {
+	// Events queued but not yet written should count towards the target
+	s := &config.Sample{Name: "targetinflight", Interval: 1, Lines: []map[string]string{{"_raw": "123456789"}}}
+	rc := newRateController(s, 0, 1)
+	first := rc.next()
+	assert.True(t, first > 0)
+	assert.InDelta(t, first, rc.next(), 2)
+	assert.InDelta(t, first, rc.next(), 2)
+}
+
+func TestSpread(t *testing.T) {
+	s := &config.Sample{Name: "spread", Interval: 1, Realtime: true}
+	gq := make(chan *config.GenQueueItem, 100)
+	timer := &Timer{S: s, GQ: gq, Ctx: context.Background()}
+	start := time.Now()
+	timer.spread(25)
+	assert.True(t, time.Since(start) >= time.Second)
+	close(gq)
+	items := 0
+	total := 0
+	for i := range gq {
+		items++
+		total += i.Count
+		assert.True(t, i.Count == 2 || i.Count == 3)
+	}
+	assert.Equal(t, 10, items)
+	assert.Equal(t, 25, total)
+}
@@ -1,6 +1,9 @@
 package timer
 
 import (
+	"context"
+	"math/rand"
+	"sync"
 	"time"
 
 	config "github.com/coccyx/gogen/internal"
@@ -15,11 +18,37 @@ type Timer struct {
 	GQ   chan *config.GenQueueItem
 	OQ   chan *config.OutQueueItem
 	Done chan int
+	Seed int64
+	// Ctx stops the timer when cancelled, if set
+	Ctx context.Context
+
+	// TargetEPS or TargetGBPerDay, if set, override the sample's count and rater
+	TargetEPS      float64
+	TargetGBPerDay float64
+
+	rand *rand.Rand
+	rc   *rateController
+
+	// mutex guards the sample's settings and our state against changes made while running
+	mutex  sync.Mutex
+	paused bool
+	resume chan struct{}
 }
 
 // NewTimer creates a new Timer for a sample which will put work into the generator queue on each interval
 func (t *Timer) NewTimer() {
 	s := t.S
+	// With a seed set, every interval gets its own generator derived from the sample's stream, so
+	// the output of an interval doesn't depend on which GeneratorWorker picks it up
+	if t.Seed != 0 {
+		t.rand = config.NewRand(t.Seed, s.Name)
+	}
+	if t.Ctx == nil {
+		t.Ctx = context.Background()
+	}
+	if (t.TargetEPS > 0 || t.TargetGBPerDay > 0) && s.Generator != "replay" {
+		t.rc = newRateController(s, t.TargetEPS, t.TargetGBPerDay)
+	}
 	// If we're not realtime, then we should be backfilling
 	if !s.Realtime {
 		// Set the end time based on configuration, either now or a specified time in the config
@@ -31,65 +60,127 @@ func (t *Timer) NewTimer() {
 			endtime = n
 		}
 		// Run through as many intervals until we're at endtime
-		for s.Current.Before(endtime) {
+		for s.Current.Before(endtime) && t.Ctx.Err() == nil {
 			// log.Debugf("Backfilling, at %s, ending at %s", t.S.Current, endtime)
 			t.genWork()
 			t.inc()
 		}
 		// If we had no endtime set, then keep going in realtime mode
-		if s.EndParsed.IsZero() {
+		if s.EndParsed.IsZero() && t.Ctx.Err() == nil {
+			t.mutex.Lock()
 			s.Realtime = true
+			t.mutex.Unlock()
 		}
 	}
 	// Endtime can be greater than now, so continue until we've reached the end time... Realtime won't get set, so we'll end after this
 	if !t.S.Realtime {
-		for s.Current.Before(s.EndParsed) {
+		for s.Current.Before(s.EndParsed) && t.Ctx.Err() == nil {
 			t.genWork()
 			t.inc()
 		}
 	}
 	// In realtime mode, continue until we get an interrupt
 	if s.Realtime {
-		for {
+		for t.Ctx.Err() == nil {
 			if s.Generator == "replay" {
-				time.Sleep(s.ReplayOffsets[t.cur])
+				if !t.sleep(s.ReplayOffsets[t.cur]) {
+					break
+				}
 				t.genWork()
 				t.cur++
 				if t.cur >= len(s.ReplayOffsets) {
 					t.cur = 0
 				}
+			} else if t.rc != nil {
+				// Target rate samples spread each interval's events across the interval
+				t.genWork()
 			} else {
-				timer := time.NewTimer(time.Duration(s.Interval) * time.Second)
-				<-timer.C
+				if !t.sleep(t.interval()) {
+					break
+				}
 				t.genWork()
 			}
 		}
-	} else {
-		t.Done <- 1
+	}
+	t.Done <- 1
+}
+
+// sleep waits for d, returning false if the timer was cancelled first
+func (t *Timer) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-t.Ctx.Done():
+		return false
+	}
+}
+
+// queue puts an item in the generator queue, dropping it if the timer is cancelled first
+func (t *Timer) queue(item *config.GenQueueItem) {
+	select {
+	case t.GQ <- item:
+	case <-t.Ctx.Done():
 	}
 }
 
 func (t *Timer) genWork() {
+	if !t.wait() {
+		return
+	}
 	s := t.S
+	t.mutex.Lock()
 	now := s.Now()
-	var item *config.GenQueueItem
 	if s.Generator == "replay" {
-		earliest := now
-		latest := now
-		count := 1
-		item = &config.GenQueueItem{S: s, Count: count, Event: t.cur, Earliest: earliest, Latest: latest, Now: now, OQ: t.OQ}
-	} else {
-		earliest := now.Add(s.EarliestParsed)
-		latest := now.Add(s.LatestParsed)
-		count := rater.EventRate(s, now, s.Count)
-		item = &config.GenQueueItem{S: s, Count: count, Event: -1, Earliest: earliest, Latest: latest, Now: now, OQ: t.OQ}
+		// Scenarios can only stop replay samples, skipping their events while they're stopped
+		if s.ScenarioRate(now) == 0 {
+			t.mutex.Unlock()
+			return
+		}
+		item := &config.GenQueueItem{S: s, Count: 1, Event: t.cur, Earliest: now, Latest: now, Now: now, OQ: t.OQ}
+		if t.rand != nil {
+			item.Rand = rand.New(rand.NewSource(t.rand.Int63()))
+		}
+		t.mutex.Unlock()
+		t.queue(item)
+		return
+	}
+	if t.rc != nil {
+		// Scenarios change target rate samples on top of their target
+		count := int(float64(t.rc.next())*s.ScenarioRate(now) + 0.5)
+		if s.Realtime {
+			t.mutex.Unlock()
+			t.spread(count)
+			return
+		}
+		item := t.newItem(now, count)
+		t.mutex.Unlock()
+		t.queue(item)
+		return
+	}
+	item := t.newItem(now, rater.EventRate(s, now, s.Count))
+	t.mutex.Unlock()
+	t.queue(item)
+}
+
+// newItem returns a GenQueueItem for count events at now, must be called holding mutex
+func (t *Timer) newItem(now time.Time, count int) *config.GenQueueItem {
+	s := t.S
+	earliest := now.Add(s.EarliestParsed)
+	latest := now.Add(s.LatestParsed)
+	item := &config.GenQueueItem{S: s, Count: count, Event: -1, Earliest: earliest, Latest: latest, Now: now, OQ: t.OQ}
+	if t.rand != nil {
+		item.Rand = rand.New(rand.NewSource(t.rand.Int63()))
 	}
 	// log.Debugf("Placing item in queue for sample '%s': %#v", t.S.Name, item)
-	t.GQ <- item
+	return item
 }
 
 func (t *Timer) inc() {
 	s := t.S
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
 	if s.Generator == "replay" {
 		s.Current = s.Current.Add(s.ReplayOffsets[t.cur])
 		t.cur++
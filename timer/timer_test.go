@@ -124,3 +124,33 @@ Loop:
 	}
 	assert.Equal(t, 10, len(gqs))
 }
+
+func TestBackfillTargetEPS(t *testing.T) {
+	os.Setenv("GOGEN_HOME", "..")
+	os.Setenv("GOGEN_ALWAYS_REFRESH", "1")
+	home := filepath.Join("..", "tests", "timer")
+	os.Setenv("GOGEN_SAMPLES_DIR", home)
+
+	s := tests.FindSampleInFile(home, "backfill")
+
+	gq := make(chan *config.GenQueueItem, 1000)
+	done := make(chan int)
+	timer := &Timer{S: s, GQ: gq, Done: done, TargetEPS: 3}
+	go timer.NewTimer()
+	<-done
+	total := 0
+	items := 0
+Loop:
+	for {
+		select {
+		case i := <-gq:
+			assert.Equal(t, 15, i.Count)
+			total += i.Count
+			items++
+		default:
+			break Loop
+		}
+	}
+	assert.Equal(t, 6, items)
+	assert.Equal(t, 90, total)
+}